@@ -6,8 +6,17 @@ import (
 	"os"
 	"os/exec"
 
+	"github.com/gakwaya-panel/api/internal/alerts"
+	"github.com/gakwaya-panel/api/internal/backup"
 	"github.com/gakwaya-panel/api/internal/handlers"
+	"github.com/gakwaya-panel/api/internal/logship"
+	"github.com/gakwaya-panel/api/internal/metrics"
 	"github.com/gakwaya-panel/api/internal/models"
+	"github.com/gakwaya-panel/api/internal/proxy"
+	"github.com/gakwaya-panel/api/internal/retention"
+	"github.com/gakwaya-panel/api/internal/scanner"
+	"github.com/gakwaya-panel/api/internal/secrets"
+	"github.com/gakwaya-panel/api/internal/uptime"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	_ "github.com/mattn/go-sqlite3"
@@ -89,8 +98,53 @@ func main() {
 		log.Fatalf("Database connection error: %v", err)
 	}
 
+	// Load the master key and encrypt env/build args still stored as plaintext
+	if err := secrets.Init(); err != nil {
+		log.Fatalf("Failed to load secrets master key: %v", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		rotateKeys(db, len(os.Args) > 2 && os.Args[2] == "--generate")
+		return
+	}
+	if n, err := secrets.Seal(db); err != nil {
+		log.Fatalf("Failed to encrypt stored secrets: %v", err)
+	} else if n > 0 {
+		log.Printf("[INFO] Encrypted %d plaintext secret values", n)
+	}
+
+	// Refuse to start with a misspelt image scanner or block severity
+	if err := scanner.CheckEnv(); err != nil {
+		log.Fatalf("Invalid image scan settings: %v", err)
+	}
+
+	// Remove old per-deploy build images once a night
+	retention.StartNightlySweep(db)
+
+	// Run scheduled volume backups
+	backup.StartScheduler(db)
+
+	// Sample container CPU, memory, network and block I/O into time series
+	metrics.Start(db)
+
+	// Watch container events and evaluate alert rules
+	alerts.Start(db)
+
+	// Probe application endpoints for uptime checks
+	uptime.Start(db)
+
+	// Store application container output so it outlives redeploys
+	logship.Start(db)
+
+	// Route application domains to their containers. Both listeners are
+	// opt-in so an upgrade never takes over the host's ports unasked.
+	proxy.Start(db, os.Getenv("PROXY_HTTP_ADDR"), os.Getenv("PROXY_HTTPS_ADDR"))
+
 	r := gin.Default()
 	r.Use(CORSMiddleware())
+	r.Use(handlers.RequestMetrics())
+
+	// Prometheus scrape endpoint, protected by METRICS_TOKEN
+	r.GET("/metrics", handlers.PrometheusMetrics(db))
 
 	r.OPTIONS("/*path", func(c *gin.Context) {
 		log.Println("CORS preflight request handled")
@@ -124,6 +178,27 @@ func main() {
 		appGroup.DELETE(":id", handlers.DeleteApplication(db))
 		appGroup.POST(":id/deploy", handlers.DeployApplication(db))
 		appGroup.POST(":id/deploy-from-git", handlers.DeployFromGit(db))
+		appGroup.POST(":id/prune-images", handlers.PruneApplicationImages(db))
+		appGroup.GET(":id/scan", handlers.GetApplicationScan(db))
+		appGroup.GET(":id/deployments", handlers.ListDeployments(db))
+		appGroup.GET(":id/deployments/:deployment_id", handlers.GetDeployment(db))
+		appGroup.POST(":id/backups", handlers.CreateBackup(db))
+		appGroup.GET(":id/backups", handlers.ListBackups(db))
+		appGroup.GET(":id/backup-schedules", handlers.ListBackupSchedules(db))
+		appGroup.POST(":id/backup-schedules", handlers.CreateBackupSchedule(db))
+		appGroup.GET(":id/env", handlers.GetApplicationEnv(db))
+		appGroup.GET(":id/metrics", handlers.GetApplicationMetrics(db))
+		appGroup.GET(":id/uptime-checks", handlers.ListApplicationUptimeChecks(db))
+		appGroup.GET(":id/logs", handlers.SearchApplicationLogs(db))
+		appGroup.POST(":id/uptime-checks", handlers.CreateUptimeCheck(db))
+		appGroup.POST(":id/env/import", handlers.ImportApplicationEnv(db))
+		appGroup.GET(":id/env/export", handlers.ExportApplicationEnv(db))
+		appGroup.GET(":id/files", handlers.ListContainerFiles(db))
+		appGroup.GET(":id/files/stat", handlers.StatContainerFile(db))
+		appGroup.GET(":id/files/download", handlers.DownloadContainerFiles(db))
+		appGroup.POST(":id/files/upload", handlers.UploadContainerFiles(db))
+		appGroup.GET(":id/files/content", handlers.ReadContainerFile(db))
+		appGroup.PUT(":id/files/content", handlers.WriteContainerFile(db))
 	}
 
 	// Docker integration endpoints (protected)
@@ -131,18 +206,135 @@ func main() {
 	{
 		dockerGroup.GET("/containers", handlers.ListDockerContainers())
 		dockerGroup.POST("/run", handlers.RunDockerContainer(db))
-		dockerGroup.POST("/stop/:id", handlers.StopDockerContainer())
-		dockerGroup.DELETE("/remove/:id", handlers.RemoveDockerContainer())
+		dockerGroup.POST("/stop/:id", handlers.StopDockerContainer(db))
+		dockerGroup.DELETE("/remove/:id", handlers.RemoveDockerContainer(db))
 		dockerGroup.GET("/logs/:id", handlers.GetDockerContainerLogs())
+		dockerGroup.GET("/logs/:id/stream", handlers.StreamDockerContainerLogs())
 		dockerGroup.POST("/prune", handlers.DockerSystemPrune())
 		dockerGroup.POST("/prune-all", handlers.DockerSystemPruneAll())
 		dockerGroup.GET("/info", handlers.DockerSystemInfo())
-		dockerGroup.POST("/restart/:id", handlers.RestartDockerContainer())
+		dockerGroup.POST("/restart/:id", handlers.RestartDockerContainer(db))
 		dockerGroup.GET("/inspect/:id", handlers.InspectDockerContainer())
+		dockerGroup.GET("/stats/stream", handlers.StreamDockerContainerStats())
 		dockerGroup.GET("/stats/:id", handlers.StatsDockerContainer())
 		dockerGroup.POST("/exec/:id", handlers.ExecDockerContainer())
 		dockerGroup.GET("/terminal/:id", handlers.TerminalDockerContainer())
 		dockerGroup.GET("/exposed-ports", handlers.GetExposedPorts())
+		dockerGroup.GET("/ports", handlers.ListHostPorts(db))
+		dockerGroup.GET("/images", handlers.ListDockerImages(db))
+		dockerGroup.POST("/images/pull", handlers.PullDockerImage())
+		dockerGroup.POST("/images/import", handlers.ImportDockerImage())
+		dockerGroup.GET("/images/:id", handlers.InspectDockerImage())
+		dockerGroup.GET("/images/:id/history", handlers.DockerImageHistory())
+		dockerGroup.POST("/images/:id/tag", handlers.TagDockerImage())
+		dockerGroup.GET("/images/:id/export", handlers.ExportDockerImage())
+		dockerGroup.DELETE("/images/:id", handlers.RemoveDockerImage(db))
+		dockerGroup.POST("/images/:id/scan", handlers.ScanDockerImage(db))
+		dockerGroup.GET("/images/:id/scans", handlers.ListDockerImageScans(db))
+		dockerGroup.GET("/networks", handlers.ListDockerNetworks(db))
+		dockerGroup.POST("/networks", handlers.CreateDockerNetwork())
+		dockerGroup.GET("/networks/:id", handlers.InspectDockerNetwork(db))
+		dockerGroup.DELETE("/networks/:id", handlers.RemoveDockerNetwork(db))
+		dockerGroup.GET("/volumes", handlers.ListDockerVolumes(db))
+		dockerGroup.POST("/volumes", handlers.CreateDockerVolume())
+		dockerGroup.GET("/volumes/:name", handlers.InspectDockerVolume(db))
+		dockerGroup.DELETE("/volumes/:name", handlers.RemoveDockerVolume(db))
+	}
+
+	// Deploy/build job endpoints (protected)
+	jobGroup := r.Group("/api/jobs", handlers.JWTAuthMiddleware())
+	{
+		jobGroup.GET("", handlers.ListJobs())
+		jobGroup.GET(":id", handlers.GetJob())
+		jobGroup.POST(":id/cancel", handlers.CancelJob())
+	}
+
+	// Backup endpoints (protected)
+	backupGroup := r.Group("/api/backups", handlers.JWTAuthMiddleware())
+	{
+		backupGroup.GET(":id/download", handlers.DownloadBackup(db))
+		backupGroup.POST(":id/restore", handlers.RestoreBackup(db))
+		backupGroup.DELETE(":id", handlers.DeleteBackup(db))
+	}
+
+	// Backup schedule endpoints (protected); schedules are created per application
+	scheduleGroup := r.Group("/api/backup-schedules", handlers.JWTAuthMiddleware())
+	{
+		scheduleGroup.GET(":id", handlers.GetBackupSchedule(db))
+		scheduleGroup.PUT(":id", handlers.UpdateBackupSchedule(db))
+		scheduleGroup.DELETE(":id", handlers.DeleteBackupSchedule(db))
+	}
+
+	// Reverse proxy endpoints (protected)
+	proxyGroup := r.Group("/api/proxy", handlers.JWTAuthMiddleware())
+	{
+		proxyGroup.GET("/routes", handlers.ListProxyRoutes())
+		proxyGroup.POST("/reload", handlers.ReloadProxyRoutes(db))
+		proxyGroup.GET("/certificates", handlers.ListCertificates())
+	}
+
+	// Shared env group endpoints (protected)
+	envGroup := r.Group("/api/env-groups", handlers.JWTAuthMiddleware())
+	{
+		envGroup.GET("", handlers.ListEnvGroups(db))
+		envGroup.POST("", handlers.CreateEnvGroup(db))
+		envGroup.GET(":id", handlers.GetEnvGroup(db))
+		envGroup.PUT(":id", handlers.UpdateEnvGroup(db))
+		envGroup.DELETE(":id", handlers.DeleteEnvGroup(db))
+	}
+
+	// Managed database endpoints (protected); databases are applications, so
+	// deploy, stop, backups and deletion use the application endpoints
+	databaseGroup := r.Group("/api/databases", handlers.JWTAuthMiddleware())
+	{
+		databaseGroup.GET("", handlers.ListDatabases(db))
+		databaseGroup.POST("", handlers.CreateDatabase(db))
+		databaseGroup.GET("/engines", handlers.ListDatabaseEngines())
+		databaseGroup.GET(":id", handlers.GetDatabase(db))
+		databaseGroup.POST(":id/query", handlers.QueryDatabase(db))
+	}
+
+	// Uptime check endpoints (protected); checks are created per application
+	uptimeGroup := r.Group("/api/uptime-checks", handlers.JWTAuthMiddleware())
+	{
+		uptimeGroup.GET("", handlers.ListUptimeChecks(db))
+		uptimeGroup.GET(":id", handlers.GetUptimeCheck(db))
+		uptimeGroup.PUT(":id", handlers.UpdateUptimeCheck(db))
+		uptimeGroup.DELETE(":id", handlers.DeleteUptimeCheck(db))
+		uptimeGroup.POST(":id/run", handlers.RunUptimeCheck(db))
+		uptimeGroup.GET(":id/results", handlers.GetUptimeCheckResults(db))
+		uptimeGroup.GET(":id/outages", handlers.GetUptimeCheckOutages(db))
+	}
+
+	// Alerting endpoints (protected)
+	alertGroup := r.Group("/api/alerts", handlers.JWTAuthMiddleware())
+	{
+		alertGroup.GET("", handlers.ListAlerts(db))
+		alertGroup.GET("/rules", handlers.ListAlertRules(db))
+		alertGroup.POST("/rules", handlers.CreateAlertRule(db))
+		alertGroup.PUT("/rules/:id", handlers.UpdateAlertRule(db))
+		alertGroup.DELETE("/rules/:id", handlers.DeleteAlertRule(db))
+		alertGroup.GET("/channels", handlers.ListAlertChannels(db))
+		alertGroup.POST("/channels", handlers.CreateAlertChannel(db))
+		alertGroup.PUT("/channels/:id", handlers.UpdateAlertChannel(db))
+		alertGroup.DELETE("/channels/:id", handlers.DeleteAlertChannel(db))
+		alertGroup.POST("/channels/:id/test", handlers.TestAlertChannel(db))
+		alertGroup.GET("/silences", handlers.ListAlertSilences(db))
+		alertGroup.POST("/silences", handlers.CreateAlertSilence(db))
+		alertGroup.DELETE("/silences/:id", handlers.DeleteAlertSilence(db))
+	}
+
+	// Stored log search endpoints (protected)
+	logGroup := r.Group("/api/logs", handlers.JWTAuthMiddleware())
+	{
+		logGroup.GET("", handlers.SearchLogs(db))
+		logGroup.GET("/status", handlers.GetLogStatus(db))
+	}
+
+	// Audit log endpoints (protected)
+	auditGroup := r.Group("/api/audit", handlers.JWTAuthMiddleware())
+	{
+		auditGroup.GET("", handlers.ListAuditLog(db))
 	}
 
 	log.Printf("\n\n\n\n----\n\n Starting server on :%s\n\n---\n\n\n\n\n\n\n", port)
@@ -152,3 +344,21 @@ func main() {
 func runMigrations(db *sql.DB) error {
 	return models.Migrate(db)
 }
+
+// rotateKeys re-encrypts all stored secrets under the current master key.
+// With --generate it first creates a new key and replaces the key file.
+func rotateKeys(db *sql.DB, generate bool) {
+	if generate {
+		n, backup, err := secrets.RotateKeyFile(db)
+		if err != nil {
+			log.Fatalf("Key rotation failed: %v", err)
+		}
+		log.Printf("Re-encrypted %d values with a new master key in %s; the old key was saved to %s", n, secrets.KeyFile(), backup)
+		return
+	}
+	n, err := secrets.Rotate(db)
+	if err != nil {
+		log.Fatalf("Key rotation failed: %v", err)
+	}
+	log.Printf("Re-encrypted %d values with the current master key; SECRETS_PREVIOUS_KEYS can now be cleared", n)
+}
@@ -0,0 +1,240 @@
+// Package alerts raises alerts from application events and measurements,
+// folds repeated occurrences into one incident and notifies webhook, chat
+// and email channels.
+package alerts
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/models"
+)
+
+// Rule types
+const (
+	RuleContainerDied = "container_died" // the container stopped without being asked to
+	RuleCrashLoop     = "crash_loop"     // Threshold deaths within ForMinutes
+	RuleDeployFailed  = "deploy_failed"  // a deployment was recorded as failed
+	RuleCPUHigh       = "cpu_high"       // CPU above Threshold percent for ForMinutes
+	RuleMemoryHigh    = "memory_high"    // memory above Threshold percent of the limit for ForMinutes
+	RuleDiskUsage     = "disk_usage"     // the filesystem of Path above Threshold percent
+	RuleCertExpiring  = "cert_expiring"  // a proxy certificate expires within Threshold days
+	RuleUptimeDown    = "uptime_down"    // an uptime check of the application went down
+)
+
+// ruleTypes maps each rule type to whether it is panel-wide, i.e. ignores
+// the application
+var ruleTypes = map[string]bool{
+	RuleContainerDied: false,
+	RuleCrashLoop:     false,
+	RuleDeployFailed:  false,
+	RuleCPUHigh:       false,
+	RuleMemoryHigh:    false,
+	RuleDiskUsage:     true,
+	RuleCertExpiring:  true,
+	RuleUptimeDown:    false,
+}
+
+// Alert statuses
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// ValidType reports whether typ is a known rule type
+func ValidType(typ string) bool {
+	_, ok := ruleTypes[typ]
+	return ok
+}
+
+// PanelWide reports whether rules of typ watch the panel host rather than
+// an application
+func PanelWide(typ string) bool {
+	return ruleTypes[typ]
+}
+
+// Defaults fills the unset type-specific settings of a rule
+func Defaults(r *models.AlertRule) {
+	switch r.Type {
+	case RuleCrashLoop:
+		if r.Threshold == 0 {
+			r.Threshold = 3
+		}
+		if r.ForMinutes == 0 {
+			r.ForMinutes = 10
+		}
+	case RuleCPUHigh, RuleMemoryHigh:
+		if r.Threshold == 0 {
+			r.Threshold = 90
+		}
+		if r.ForMinutes == 0 {
+			r.ForMinutes = 5
+		}
+	case RuleDiskUsage:
+		if r.Threshold == 0 {
+			r.Threshold = 90
+		}
+		if r.Path == "" {
+			r.Path = "/"
+		}
+	case RuleCertExpiring:
+		if r.Threshold == 0 {
+			r.Threshold = 14
+		}
+	}
+}
+
+// mu serializes state changes so that one incident is never opened twice
+var mu sync.Mutex
+
+// Raise fires the enabled rules of typ that apply to an application; it is
+// used for event rules without a condition of their own
+func Raise(db *sql.DB, typ string, appID int64, subject, message string) {
+	rules, err := rulesOfType(db, typ, appID)
+	if err != nil {
+		log.Printf("[WARN] alerts: could not load %s rules: %v", typ, err)
+		return
+	}
+	for _, r := range rules {
+		fire(db, r, appID, subject, message)
+	}
+}
+
+// Resolve resolves the firing alerts of typ for an application and subject
+func Resolve(db *sql.DB, typ string, appID int64, subject, message string) {
+	rules, err := rulesOfType(db, typ, appID)
+	if err != nil {
+		log.Printf("[WARN] alerts: could not load %s rules: %v", typ, err)
+		return
+	}
+	for _, r := range rules {
+		resolve(db, r, appID, subject, message)
+	}
+}
+
+// fire opens an incident of rule r, or records another occurrence of the
+// open one, and notifies unless it is silenced or was notified already
+func fire(db *sql.DB, r models.AlertRule, appID int64, subject, message string) {
+	mu.Lock()
+	defer mu.Unlock()
+	now := time.Now()
+	muted, err := silenced(db, r.ID, appID)
+	if err != nil {
+		log.Printf("[WARN] alerts: could not check silences: %v", err)
+	}
+	a, err := openAlert(db, r.ID, appID, subject)
+	if err == sql.ErrNoRows {
+		res, err := db.Exec(`INSERT INTO alerts (rule_id, type, application_id, subject, message, status, silenced, count, started_at, last_seen_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, 1, ?, ?)`, r.ID, r.Type, appID, subject, message, StatusFiring, muted, now, now)
+		if err != nil {
+			log.Printf("[WARN] alerts: could not record alert of rule %d: %v", r.ID, err)
+			return
+		}
+		a = models.Alert{RuleID: r.ID, RuleName: r.Name, Type: r.Type, ApplicationID: appID, Subject: subject, Message: message,
+			Status: StatusFiring, Silenced: muted, Count: 1, StartedAt: now, LastSeenAt: now}
+		a.ID, _ = res.LastInsertId()
+	} else if err != nil {
+		log.Printf("[WARN] alerts: could not read alert of rule %d: %v", r.ID, err)
+		return
+	} else {
+		a.Count++
+		a.Message, a.Silenced, a.LastSeenAt = message, muted, now
+		if _, err := db.Exec("UPDATE alerts SET count = ?, message = ?, silenced = ?, last_seen_at = ? WHERE id = ?", a.Count, message, muted, now, a.ID); err != nil {
+			log.Printf("[WARN] alerts: could not update alert %d: %v", a.ID, err)
+			return
+		}
+	}
+	if muted {
+		return
+	}
+	repeat := time.Duration(r.RepeatMinutes) * time.Minute
+	if a.LastNotifiedAt != nil && (repeat == 0 || now.Sub(*a.LastNotifiedAt) < repeat) {
+		return
+	}
+	if _, err := db.Exec("UPDATE alerts SET last_notified_at = ? WHERE id = ?", now, a.ID); err != nil {
+		log.Printf("[WARN] alerts: could not update alert %d: %v", a.ID, err)
+	}
+	notify(db, r, a)
+}
+
+// resolve closes the open incident of rule r, if any, and announces it on
+// the channels that were told it fired
+func resolve(db *sql.DB, r models.AlertRule, appID int64, subject, message string) {
+	mu.Lock()
+	defer mu.Unlock()
+	a, err := openAlert(db, r.ID, appID, subject)
+	if err == sql.ErrNoRows {
+		return
+	} else if err != nil {
+		log.Printf("[WARN] alerts: could not read alert of rule %d: %v", r.ID, err)
+		return
+	}
+	now := time.Now()
+	a.Status, a.ResolvedAt = StatusResolved, &now
+	if message != "" {
+		a.Message = message
+	}
+	if _, err := db.Exec("UPDATE alerts SET status = ?, message = ?, resolved_at = ? WHERE id = ?", a.Status, a.Message, now, a.ID); err != nil {
+		log.Printf("[WARN] alerts: could not resolve alert %d: %v", a.ID, err)
+		return
+	}
+	if a.LastNotifiedAt == nil {
+		return
+	}
+	if muted, err := silenced(db, r.ID, appID); err != nil || muted {
+		return
+	}
+	notify(db, r, a)
+}
+
+// notify sends a in the background to the channels of rule r
+func notify(db *sql.DB, r models.AlertRule, a models.Alert) {
+	channels, err := ruleChannels(db, r)
+	if err != nil {
+		log.Printf("[WARN] alerts: could not load channels: %v", err)
+		return
+	}
+	if len(channels) == 0 {
+		return
+	}
+	n := newNotification(db, r, a)
+	go func() {
+		for _, ch := range channels {
+			if err := Send(ch, n); err != nil {
+				log.Printf("[WARN] alerts: notification of alert %d to channel %q failed: %v", a.ID, ch.Name, err)
+			}
+		}
+	}()
+}
+
+// ruleChannels returns the enabled channels of a rule; a rule without
+// channels uses all of them
+func ruleChannels(db *sql.DB, r models.AlertRule) ([]models.AlertChannel, error) {
+	all, err := Channels(db)
+	if err != nil {
+		return nil, err
+	}
+	wanted := map[int64]bool{}
+	for _, id := range r.Channels {
+		wanted[id] = true
+	}
+	var out []models.AlertChannel
+	for _, ch := range all {
+		if ch.Enabled && (len(wanted) == 0 || wanted[ch.ID]) {
+			out = append(out, ch)
+		}
+	}
+	return out, nil
+}
+
+// appName returns the name of an application, or its ID when it is gone
+func appName(db *sql.DB, appID int64) string {
+	var name string
+	if err := db.QueryRow("SELECT name FROM applications WHERE id = ?", appID).Scan(&name); err != nil {
+		return fmt.Sprintf("application %d", appID)
+	}
+	return name
+}
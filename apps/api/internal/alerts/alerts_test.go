@@ -0,0 +1,197 @@
+package alerts
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/models"
+	"github.com/gakwaya-panel/api/internal/secrets"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// setup returns a migrated database with one webhook channel whose
+// notifications arrive on the returned channel
+func setup(t *testing.T) (*sql.DB, <-chan Notification) {
+	t.Helper()
+	key, err := secrets.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SECRETS_MASTER_KEY", key)
+	if err := secrets.Init(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", t.TempDir()+"/panel.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := models.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan Notification, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("webhook body: %v", err)
+		}
+		received <- n
+	}))
+	t.Cleanup(srv.Close)
+	if _, err := SaveChannel(db, models.AlertChannel{Name: "hook", Type: ChannelWebhook, URL: srv.URL, Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	return db, received
+}
+
+func newRule(t *testing.T, db *sql.DB, repeatMinutes int) models.AlertRule {
+	t.Helper()
+	r := models.AlertRule{Name: "died", Type: RuleContainerDied, RepeatMinutes: repeatMinutes, Enabled: true}
+	id, err := SaveRule(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.ID = id
+	return r
+}
+
+func expectNotification(t *testing.T, received <-chan Notification, status string, count int) Notification {
+	t.Helper()
+	select {
+	case n := <-received:
+		if n.Status != status || n.Count != count {
+			t.Errorf("notification %s with count %d, want %s with count %d", n.Status, n.Count, status, count)
+		}
+		return n
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no %s notification", status)
+	}
+	return Notification{}
+}
+
+func expectNone(t *testing.T, received <-chan Notification) {
+	t.Helper()
+	select {
+	case n := <-received:
+		t.Errorf("unexpected %s notification of alert %d", n.Status, n.AlertID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestFireDeduplicates(t *testing.T) {
+	db, received := setup(t)
+	r := newRule(t, db, 0)
+
+	fire(db, r, 1, "", "first")
+	first := expectNotification(t, received, StatusFiring, 1)
+	fire(db, r, 1, "", "second")
+	fire(db, r, 1, "", "third")
+	expectNone(t, received)
+
+	a, err := openAlert(db, r.ID, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID != first.AlertID || a.Count != 3 || a.Message != "third" {
+		t.Errorf("open alert %d has count %d and message %q, want alert %d, 3, %q", a.ID, a.Count, a.Message, first.AlertID, "third")
+	}
+
+	// Other subjects and applications are separate incidents
+	fire(db, r, 2, "", "other app")
+	expectNotification(t, received, StatusFiring, 1)
+	fire(db, r, 1, "/data", "other subject")
+	expectNotification(t, received, StatusFiring, 1)
+
+	resolve(db, r, 1, "", "back")
+	resolved := expectNotification(t, received, StatusResolved, 3)
+	if resolved.AlertID != first.AlertID || resolved.ResolvedAt == nil {
+		t.Errorf("resolved notification = %+v", resolved)
+	}
+	resolve(db, r, 1, "", "again")
+	expectNone(t, received)
+
+	fire(db, r, 1, "", "new incident")
+	if n := expectNotification(t, received, StatusFiring, 1); n.AlertID == first.AlertID {
+		t.Error("firing after a resolve reused the resolved alert")
+	}
+}
+
+func TestFireRepeats(t *testing.T) {
+	db, received := setup(t)
+	r := newRule(t, db, 30)
+
+	fire(db, r, 1, "", "first")
+	n := expectNotification(t, received, StatusFiring, 1)
+	fire(db, r, 1, "", "within the repeat interval")
+	expectNone(t, received)
+
+	if _, err := db.Exec("UPDATE alerts SET last_notified_at = ? WHERE id = ?", time.Now().Add(-31*time.Minute), n.AlertID); err != nil {
+		t.Fatal(err)
+	}
+	fire(db, r, 1, "", "after the repeat interval")
+	expectNotification(t, received, StatusFiring, 3)
+}
+
+func TestSilences(t *testing.T) {
+	db, received := setup(t)
+	r := newRule(t, db, 0)
+	other := newRule(t, db, 0)
+	now := time.Now()
+	// Stored from a non-UTC zone, as a client in another timezone would send it
+	zone := time.FixedZone("UTC+3", 3*3600)
+	silences := []models.AlertSilence{
+		{ApplicationID: 1, StartsAt: now.Add(-time.Minute).In(zone), EndsAt: now.Add(time.Hour).In(zone)},
+		{RuleID: other.ID, StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour)},
+		{ApplicationID: 3, StartsAt: now.Add(time.Hour), EndsAt: now.Add(2 * time.Hour)},
+		{ApplicationID: 4, StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour)},
+	}
+	for _, s := range silences {
+		if _, err := AddSilence(db, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		rule  models.AlertRule
+		appID int64
+		muted bool
+	}{
+		{"silenced application", r, 1, true},
+		{"silenced rule", other, 2, true},
+		{"other application", r, 2, false},
+		{"silence not started", r, 3, false},
+		{"silence ended", r, 4, false},
+	}
+	for _, tt := range tests {
+		muted, err := silenced(db, tt.rule.ID, tt.appID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if muted != tt.muted {
+			t.Errorf("%s: silenced = %v, want %v", tt.name, muted, tt.muted)
+		}
+	}
+
+	fire(db, r, 1, "", "muted")
+	expectNone(t, received)
+	if a, err := openAlert(db, r.ID, 1, ""); err != nil || !a.Silenced {
+		t.Errorf("silenced alert = %+v, %v; want it recorded as silenced", a, err)
+	}
+	// Never notified, so the resolve is not announced either
+	resolve(db, r, 1, "", "")
+	expectNone(t, received)
+
+	active, err := Silences(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 3 {
+		t.Errorf("Silences returned %d silences, want the 3 that have not ended", len(active))
+	}
+}
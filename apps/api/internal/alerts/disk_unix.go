@@ -0,0 +1,20 @@
+//go:build !windows
+
+package alerts
+
+import "syscall"
+
+// diskUsage returns how full the filesystem holding path is, in percent of
+// the space available to unprivileged users, like df
+func diskUsage(path string) (float64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	used := uint64(st.Blocks) - uint64(st.Bfree)
+	total := used + uint64(st.Bavail)
+	if total == 0 {
+		return 0, nil
+	}
+	return float64(used) / float64(total) * 100, nil
+}
@@ -0,0 +1,8 @@
+package alerts
+
+import "errors"
+
+// diskUsage is not implemented on Windows hosts
+func diskUsage(path string) (float64, error) {
+	return 0, errors.New("disk usage is not supported on Windows")
+}
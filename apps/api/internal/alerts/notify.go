@@ -0,0 +1,237 @@
+package alerts
+
+import (
+	"bytes"
+	"crypto/tls"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/models"
+)
+
+// Channel types
+const (
+	ChannelWebhook = "webhook"
+	ChannelSlack   = "slack"
+	ChannelDiscord = "discord"
+	ChannelEmail   = "email"
+)
+
+// ValidChannelType reports whether typ is a known channel type
+func ValidChannelType(typ string) bool {
+	switch typ {
+	case ChannelWebhook, ChannelSlack, ChannelDiscord, ChannelEmail:
+		return true
+	}
+	return false
+}
+
+// sendTimeout bounds the delivery of one notification
+const sendTimeout = 15 * time.Second
+
+// ErrSMTPNotConfigured is returned by email channels while SMTP_HOST is unset
+var ErrSMTPNotConfigured = errors.New("SMTP is not configured; set SMTP_HOST")
+
+// Notification is what a channel receives; webhook channels get it as JSON
+type Notification struct {
+	Status        string     `json:"status"`
+	AlertID       int64      `json:"alert_id"`
+	RuleID        int64      `json:"rule_id"`
+	Rule          string     `json:"rule"`
+	Type          string     `json:"type"`
+	ApplicationID int64      `json:"application_id,omitempty"`
+	Application   string     `json:"application,omitempty"`
+	Subject       string     `json:"subject,omitempty"`
+	Message       string     `json:"message"`
+	Count         int        `json:"count"`
+	StartedAt     time.Time  `json:"started_at"`
+	ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+}
+
+func newNotification(db *sql.DB, r models.AlertRule, a models.Alert) Notification {
+	n := Notification{
+		Status: a.Status, AlertID: a.ID, RuleID: r.ID, Rule: r.Name, Type: r.Type,
+		ApplicationID: a.ApplicationID, Subject: a.Subject, Message: a.Message,
+		Count: a.Count, StartedAt: a.StartedAt, ResolvedAt: a.ResolvedAt,
+	}
+	if a.ApplicationID != 0 {
+		n.Application = appName(db, a.ApplicationID)
+	}
+	return n
+}
+
+// TestNotification is sent by the channel test endpoint
+func TestNotification() Notification {
+	return Notification{
+		Status:    "test",
+		Rule:      "test",
+		Type:      "test",
+		Message:   "This is a test notification from gakwaya-panel.",
+		Count:     1,
+		StartedAt: time.Now(),
+	}
+}
+
+// Title is a one-line summary such as "[FIRING] High CPU: my-app"
+func (n Notification) Title() string {
+	title := "[" + strings.ToUpper(n.Status) + "] " + n.Rule
+	if n.Application != "" {
+		title += ": " + n.Application
+	} else if n.Subject != "" {
+		title += ": " + n.Subject
+	}
+	return title
+}
+
+// Text is the plain text body of chat and email notifications
+func (n Notification) Text() string {
+	var b strings.Builder
+	b.WriteString(n.Message)
+	b.WriteString("\n\nStarted: " + n.StartedAt.UTC().Format(time.RFC1123))
+	if n.ResolvedAt != nil {
+		b.WriteString("\nResolved: " + n.ResolvedAt.UTC().Format(time.RFC1123))
+	}
+	if n.Count > 1 {
+		fmt.Fprintf(&b, "\nOccurrences: %d", n.Count)
+	}
+	return b.String()
+}
+
+// Send delivers a notification to one channel
+func Send(ch models.AlertChannel, n Notification) error {
+	switch ch.Type {
+	case ChannelWebhook:
+		return postJSON(ch.URL, n)
+	case ChannelSlack:
+		return postJSON(ch.URL, map[string]string{"text": "*" + n.Title() + "*\n" + n.Text()})
+	case ChannelDiscord:
+		return postJSON(ch.URL, map[string]string{"content": "**" + n.Title() + "**\n" + n.Text()})
+	case ChannelEmail:
+		return sendEmail(ch.To, n.Title(), n.Text())
+	}
+	return fmt.Errorf("unknown channel type %q", ch.Type)
+}
+
+var httpClient = &http.Client{Timeout: sendTimeout}
+
+func postJSON(url string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gakwaya-panel-alerts")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook answered %s: %s", resp.Status, strings.TrimSpace(string(snippet)))
+	}
+	return nil
+}
+
+// sendEmail delivers a plain text message through SMTP_HOST:SMTP_PORT.
+// SMTP_TLS is "tls" for implicit TLS, "starttls" to require STARTTLS,
+// "none" for plain connections (e.g. a local sink) and otherwise uses
+// STARTTLS when the server offers it. SMTP_USERNAME and SMTP_PASSWORD
+// enable PLAIN authentication.
+func sendEmail(to []string, subject, body string) error {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return ErrSMTPNotConfigured
+	}
+	if len(to) == 0 {
+		return errors.New("no recipients")
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "gakwaya-panel@localhost"
+	}
+	mode := strings.ToLower(os.Getenv("SMTP_TLS"))
+	addr := net.JoinHostPort(host, port)
+	tlsConfig := &tls.Config{ServerName: host}
+
+	dialer := &net.Dialer{Timeout: sendTimeout}
+	var conn net.Conn
+	var err error
+	if mode == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(2 * sendTimeout))
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if mode != "tls" && mode != "none" {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		} else if mode == "starttls" {
+			return errors.New("SMTP server does not offer STARTTLS")
+		}
+	}
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		if err := c.Auth(smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("recipient %s: %w", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	var msg strings.Builder
+	msg.WriteString("From: " + from + "\r\n")
+	msg.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+	if _, err := io.WriteString(w, msg.String()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
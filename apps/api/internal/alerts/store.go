@@ -0,0 +1,298 @@
+package alerts
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/models"
+	"github.com/gakwaya-panel/api/internal/secrets"
+)
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+const ruleColumns = "id, name, type, application_id, threshold, for_minutes, path, channels, repeat_minutes, enabled, created_at"
+
+func scanRule(row rowScanner) (models.AlertRule, error) {
+	var r models.AlertRule
+	var channels string
+	if err := row.Scan(&r.ID, &r.Name, &r.Type, &r.ApplicationID, &r.Threshold, &r.ForMinutes, &r.Path, &channels, &r.RepeatMinutes, &r.Enabled, &r.CreatedAt); err != nil {
+		return r, err
+	}
+	if channels != "" {
+		_ = json.Unmarshal([]byte(channels), &r.Channels)
+	}
+	if r.Channels == nil {
+		r.Channels = []int64{}
+	}
+	return r, nil
+}
+
+// Rules returns every alert rule
+func Rules(db *sql.DB) ([]models.AlertRule, error) {
+	return queryRules(db, "SELECT "+ruleColumns+" FROM alert_rules ORDER BY id")
+}
+
+// GetRule returns one alert rule
+func GetRule(db *sql.DB, id int64) (models.AlertRule, error) {
+	return scanRule(db.QueryRow("SELECT "+ruleColumns+" FROM alert_rules WHERE id = ?", id))
+}
+
+// rulesOfType returns the enabled rules of a type that apply to appID;
+// appID 0 returns the rules of every application
+func rulesOfType(db *sql.DB, typ string, appID int64) ([]models.AlertRule, error) {
+	if appID == 0 {
+		return queryRules(db, "SELECT "+ruleColumns+" FROM alert_rules WHERE enabled = 1 AND type = ? ORDER BY id", typ)
+	}
+	return queryRules(db, "SELECT "+ruleColumns+" FROM alert_rules WHERE enabled = 1 AND type = ? AND application_id IN (0, ?) ORDER BY id", typ, appID)
+}
+
+func queryRules(db *sql.DB, query string, args ...any) ([]models.AlertRule, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []models.AlertRule{}
+	for rows.Next() {
+		r, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// SaveRule creates the rule, or updates it when r.ID is set, and returns its ID
+func SaveRule(db *sql.DB, r models.AlertRule) (int64, error) {
+	if r.Channels == nil {
+		r.Channels = []int64{}
+	}
+	channels, _ := json.Marshal(r.Channels)
+	if r.ID != 0 {
+		_, err := db.Exec(`UPDATE alert_rules SET name = ?, type = ?, application_id = ?, threshold = ?, for_minutes = ?, path = ?, channels = ?, repeat_minutes = ?, enabled = ? WHERE id = ?`,
+			r.Name, r.Type, r.ApplicationID, r.Threshold, r.ForMinutes, r.Path, string(channels), r.RepeatMinutes, r.Enabled, r.ID)
+		return r.ID, err
+	}
+	res, err := db.Exec(`INSERT INTO alert_rules (name, type, application_id, threshold, for_minutes, path, channels, repeat_minutes, enabled, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.Name, r.Type, r.ApplicationID, r.Threshold, r.ForMinutes, r.Path, string(channels), r.RepeatMinutes, r.Enabled, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// DeleteRule removes a rule and resolves its firing alerts without notifying
+func DeleteRule(db *sql.DB, id int64) (bool, error) {
+	res, err := db.Exec("DELETE FROM alert_rules WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return false, nil
+	}
+	_, err = db.Exec("UPDATE alerts SET status = ?, resolved_at = ? WHERE rule_id = ? AND status = ?", StatusResolved, time.Now(), id, StatusFiring)
+	return true, err
+}
+
+// channelConfig is the encrypted part of a channel
+type channelConfig struct {
+	URL string   `json:"url,omitempty"`
+	To  []string `json:"to,omitempty"`
+}
+
+const channelColumns = "id, name, type, config, enabled, created_at"
+
+func scanChannel(row rowScanner) (models.AlertChannel, error) {
+	var ch models.AlertChannel
+	var config string
+	if err := row.Scan(&ch.ID, &ch.Name, &ch.Type, &config, &ch.Enabled, &ch.CreatedAt); err != nil {
+		return ch, err
+	}
+	config, err := secrets.Decrypt(config)
+	if err != nil {
+		return ch, err
+	}
+	var cfg channelConfig
+	if config != "" {
+		_ = json.Unmarshal([]byte(config), &cfg)
+	}
+	ch.URL, ch.To = cfg.URL, cfg.To
+	return ch, nil
+}
+
+// Channels returns every notification channel
+func Channels(db *sql.DB) ([]models.AlertChannel, error) {
+	rows, err := db.Query("SELECT " + channelColumns + " FROM alert_channels ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []models.AlertChannel{}
+	for rows.Next() {
+		ch, err := scanChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ch)
+	}
+	return out, rows.Err()
+}
+
+// GetChannel returns one notification channel
+func GetChannel(db *sql.DB, id int64) (models.AlertChannel, error) {
+	return scanChannel(db.QueryRow("SELECT "+channelColumns+" FROM alert_channels WHERE id = ?", id))
+}
+
+// SaveChannel creates the channel, or updates it when ch.ID is set, and
+// returns its ID
+func SaveChannel(db *sql.DB, ch models.AlertChannel) (int64, error) {
+	config, _ := json.Marshal(channelConfig{URL: ch.URL, To: ch.To})
+	sealed, err := secrets.Encrypt(string(config))
+	if err != nil {
+		return 0, err
+	}
+	if ch.ID != 0 {
+		_, err := db.Exec("UPDATE alert_channels SET name = ?, type = ?, config = ?, enabled = ? WHERE id = ?", ch.Name, ch.Type, sealed, ch.Enabled, ch.ID)
+		return ch.ID, err
+	}
+	res, err := db.Exec("INSERT INTO alert_channels (name, type, config, enabled, created_at) VALUES (?, ?, ?, ?, ?)", ch.Name, ch.Type, sealed, ch.Enabled, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// DeleteChannel removes a channel; rules still listing it skip it
+func DeleteChannel(db *sql.DB, id int64) (bool, error) {
+	res, err := db.Exec("DELETE FROM alert_channels WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+const silenceColumns = "id, rule_id, application_id, reason, starts_at, ends_at, created_by, created_at"
+
+// Silences returns the silences that have not ended yet
+func Silences(db *sql.DB) ([]models.AlertSilence, error) {
+	rows, err := db.Query("SELECT "+silenceColumns+" FROM alert_silences WHERE ends_at > ? ORDER BY ends_at", time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []models.AlertSilence{}
+	for rows.Next() {
+		var s models.AlertSilence
+		if err := rows.Scan(&s.ID, &s.RuleID, &s.ApplicationID, &s.Reason, &s.StartsAt, &s.EndsAt, &s.CreatedBy, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// AddSilence stores a silence and returns its ID. Times are stored in UTC
+// because the silence queries compare them as text.
+func AddSilence(db *sql.DB, s models.AlertSilence) (int64, error) {
+	res, err := db.Exec("INSERT INTO alert_silences (rule_id, application_id, reason, starts_at, ends_at, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		s.RuleID, s.ApplicationID, s.Reason, s.StartsAt.UTC(), s.EndsAt.UTC(), s.CreatedBy, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// DeleteSilence ends a silence early by removing it
+func DeleteSilence(db *sql.DB, id int64) (bool, error) {
+	res, err := db.Exec("DELETE FROM alert_silences WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// silenced reports whether a silence covers the rule and application now
+func silenced(db *sql.DB, ruleID, appID int64) (bool, error) {
+	now := time.Now().UTC()
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM alert_silences WHERE starts_at <= ? AND ends_at > ?
+		AND rule_id IN (0, ?) AND application_id IN (0, ?)`, now, now, ruleID, appID).Scan(&n)
+	return n > 0, err
+}
+
+const alertColumns = "a.id, a.rule_id, COALESCE(r.name, ''), a.type, a.application_id, a.subject, a.message, a.status, a.silenced, a.count, a.started_at, a.last_seen_at, a.resolved_at, a.last_notified_at"
+
+func scanAlert(row rowScanner) (models.Alert, error) {
+	var a models.Alert
+	var resolved, notified sql.NullTime
+	err := row.Scan(&a.ID, &a.RuleID, &a.RuleName, &a.Type, &a.ApplicationID, &a.Subject, &a.Message, &a.Status, &a.Silenced, &a.Count, &a.StartedAt, &a.LastSeenAt, &resolved, &notified)
+	if resolved.Valid {
+		a.ResolvedAt = &resolved.Time
+	}
+	if notified.Valid {
+		a.LastNotifiedAt = &notified.Time
+	}
+	return a, err
+}
+
+// List returns alerts, newest first, filtered by status and application
+// when they are set
+func List(db *sql.DB, status string, appID int64, limit int) ([]models.Alert, error) {
+	query := "SELECT " + alertColumns + " FROM alerts a LEFT JOIN alert_rules r ON r.id = a.rule_id WHERE 1 = 1"
+	var args []any
+	if status != "" {
+		query += " AND a.status = ?"
+		args = append(args, status)
+	}
+	if appID != 0 {
+		query += " AND a.application_id = ?"
+		args = append(args, appID)
+	}
+	query += " ORDER BY a.id DESC LIMIT ?"
+	args = append(args, limit)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []models.Alert{}
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// openAlert returns the firing alert of a rule, application and subject
+func openAlert(db *sql.DB, ruleID, appID int64, subject string) (models.Alert, error) {
+	return scanAlert(db.QueryRow("SELECT "+alertColumns+` FROM alerts a LEFT JOIN alert_rules r ON r.id = a.rule_id
+		WHERE a.rule_id = ? AND a.application_id = ? AND a.subject = ? AND a.status = ?`, ruleID, appID, subject, StatusFiring))
+}
+
+// firingFor returns the firing alerts of a rule
+func firingFor(db *sql.DB, ruleID int64) ([]models.Alert, error) {
+	rows, err := db.Query("SELECT "+alertColumns+" FROM alerts a LEFT JOIN alert_rules r ON r.id = a.rule_id WHERE a.rule_id = ? AND a.status = ?", ruleID, StatusFiring)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Alert
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,357 @@
+package alerts
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/gakwaya-panel/api/internal/dockerutil"
+	"github.com/gakwaya-panel/api/internal/jobs"
+	"github.com/gakwaya-panel/api/internal/metrics"
+	"github.com/gakwaya-panel/api/internal/models"
+	"github.com/gakwaya-panel/api/internal/proxy"
+)
+
+// evalInterval is how often threshold rules are evaluated
+const evalInterval = time.Minute
+
+// stopGrace is how long after a kill event a container's death counts as
+// requested (docker stop, restart, a deploy replacing it)
+const stopGrace = 2 * time.Minute
+
+// maxCrashWindow bounds the death history kept per application
+const maxCrashWindow = 24 * time.Hour
+
+var (
+	historyMu sync.Mutex
+	kills     = map[string]time.Time{}  // container ID -> last kill event
+	ooms      = map[string]time.Time{}  // container ID -> last OOM event
+	deaths    = map[int64][]time.Time{} // application ID -> unexpected deaths
+)
+
+// Start watches container events and evaluates the threshold rules every
+// minute in the background
+func Start(db *sql.DB) {
+	go watchEvents(db)
+	go func() {
+		for range time.Tick(evalInterval) {
+			evaluate(db)
+		}
+	}()
+}
+
+// watchEvents follows the Docker event stream, reconnecting when it drops
+func watchEvents(db *sql.DB) {
+	for {
+		if err := followEvents(db); err != nil {
+			log.Printf("[WARN] alerts: docker events: %v", err)
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
+
+func followEvents(db *sql.DB) error {
+	cli, err := dockerutil.NewClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msgs, errs := cli.Events(ctx, types.EventsOptions{Filters: filters.NewArgs(
+		filters.Arg("type", "container"),
+		filters.Arg("event", "kill"),
+		filters.Arg("event", "oom"),
+		filters.Arg("event", "die"),
+		filters.Arg("event", "start"),
+	)})
+	for {
+		select {
+		case msg := <-msgs:
+			handleEvent(db, msg)
+		case err := <-errs:
+			return err
+		}
+	}
+}
+
+// handleEvent turns container events into container_died and crash_loop
+// alerts. A death counts when no kill event asked for it, or when the
+// kernel killed the container for running out of memory.
+func handleEvent(db *sql.DB, msg events.Message) {
+	id := msg.Actor.ID
+	now := time.Now()
+	historyMu.Lock()
+	switch msg.Action {
+	case "kill":
+		kills[id] = now
+		historyMu.Unlock()
+		return
+	case "oom":
+		ooms[id] = now
+		historyMu.Unlock()
+		return
+	}
+	killed := now.Sub(kills[id]) < stopGrace
+	oom := now.Sub(ooms[id]) < stopGrace
+	if msg.Action == "die" {
+		delete(kills, id)
+		delete(ooms, id)
+	}
+	historyMu.Unlock()
+
+	var appID int64
+	var name string
+	err := db.QueryRow("SELECT id, name FROM applications WHERE container_id = ?", id).Scan(&appID, &name)
+	if err == sql.ErrNoRows {
+		return
+	} else if err != nil {
+		log.Printf("[WARN] alerts: could not look up container %s: %v", id, err)
+		return
+	}
+
+	if msg.Action == "start" {
+		Resolve(db, RuleContainerDied, appID, "", fmt.Sprintf("The container of %s is running again.", name))
+		return
+	}
+	if (killed && !oom) || deploying(appID) {
+		return
+	}
+	message := fmt.Sprintf("The container of %s exited with code %s.", name, msg.Actor.Attributes["exitCode"])
+	if oom {
+		message = fmt.Sprintf("The container of %s was killed for running out of memory (exit code %s).", name, msg.Actor.Attributes["exitCode"])
+	}
+	Raise(db, RuleContainerDied, appID, "", message)
+
+	historyMu.Lock()
+	list := append(deaths[appID], now)
+	for len(list) > 0 && now.Sub(list[0]) > maxCrashWindow {
+		list = list[1:]
+	}
+	deaths[appID] = list
+	historyMu.Unlock()
+
+	rules, err := rulesOfType(db, RuleCrashLoop, appID)
+	if err != nil {
+		log.Printf("[WARN] alerts: could not load %s rules: %v", RuleCrashLoop, err)
+		return
+	}
+	for _, r := range rules {
+		Defaults(&r)
+		window := time.Duration(r.ForMinutes) * time.Minute
+		if n := deathsWithin(appID, window); float64(n) >= r.Threshold {
+			fire(db, r, appID, "", fmt.Sprintf("The container of %s died %d times in the last %d minutes.", name, n, r.ForMinutes))
+		}
+	}
+}
+
+// deploying reports whether a job of the application is queued or running,
+// so a container replaced by a deploy does not count as dead
+func deploying(appID int64) bool {
+	for _, j := range jobs.List(appID) {
+		if j.Status == jobs.StatusQueued || j.Status == jobs.StatusRunning {
+			return true
+		}
+	}
+	return false
+}
+
+func deathsWithin(appID int64, window time.Duration) int {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	n := 0
+	for _, t := range deaths[appID] {
+		if time.Since(t) <= window {
+			n++
+		}
+	}
+	return n
+}
+
+// evaluate checks the threshold rules and resolves what has recovered
+func evaluate(db *sql.DB) {
+	for _, typ := range []string{RuleCrashLoop, RuleCPUHigh, RuleMemoryHigh, RuleDiskUsage, RuleCertExpiring} {
+		rules, err := rulesOfType(db, typ, 0)
+		if err != nil {
+			log.Printf("[WARN] alerts: could not load %s rules: %v", typ, err)
+			continue
+		}
+		for _, r := range rules {
+			Defaults(&r)
+			switch typ {
+			case RuleCrashLoop:
+				evaluateCrashLoop(db, r)
+			case RuleCPUHigh, RuleMemoryHigh:
+				evaluateUsage(db, r)
+			case RuleDiskUsage:
+				evaluateDisk(db, r)
+			case RuleCertExpiring:
+				evaluateCertificates(db, r)
+			}
+		}
+	}
+	pruneHistory()
+}
+
+// evaluateCrashLoop resolves crash loops once a whole window passed
+// without a death
+func evaluateCrashLoop(db *sql.DB, r models.AlertRule) {
+	firing, err := firingFor(db, r.ID)
+	if err != nil {
+		log.Printf("[WARN] alerts: could not load alerts of rule %d: %v", r.ID, err)
+		return
+	}
+	for _, a := range firing {
+		if deathsWithin(a.ApplicationID, time.Duration(r.ForMinutes)*time.Minute) == 0 {
+			resolve(db, r, a.ApplicationID, a.Subject, fmt.Sprintf("The container of %s has not died for %d minutes.", appName(db, a.ApplicationID), r.ForMinutes))
+		}
+	}
+}
+
+// evaluateUsage fires when every sample of the last ForMinutes was above
+// the threshold and resolves once the latest sample is at or below it, or
+// samples stop arriving
+func evaluateUsage(db *sql.DB, r models.AlertRule) {
+	interval := metrics.Interval()
+	if interval == 0 {
+		return
+	}
+	apps := []int64{r.ApplicationID}
+	if r.ApplicationID == 0 {
+		var err error
+		if apps, err = deployedApplications(db); err != nil {
+			log.Printf("[WARN] alerts: could not load applications: %v", err)
+			return
+		}
+	}
+	window := time.Duration(r.ForMinutes) * time.Minute
+	now := time.Now()
+	active := map[int64]bool{}
+	for _, appID := range apps {
+		w, err := metrics.Summary(db, appID, now.Add(-window))
+		if err != nil {
+			log.Printf("[WARN] alerts: could not read metrics of application %d: %v", appID, err)
+			active[appID] = true
+			continue
+		}
+		if w.Points == 0 || now.Sub(w.Last) > 3*interval {
+			continue
+		}
+		low, last, what := w.MinCPU, w.LastCPU, "CPU"
+		if r.Type == RuleMemoryHigh {
+			low, last, what = w.MinMemoryPercent, w.LastMemoryPercent, "Memory"
+			if last < 0 {
+				continue
+			}
+		}
+		active[appID] = true
+		covered := w.First.Sub(now.Add(-window)) <= 2*interval
+		switch {
+		case covered && low > r.Threshold:
+			fire(db, r, appID, "", fmt.Sprintf("%s usage of %s has been above %g%% for %d minutes (now %.1f%%).", what, appName(db, appID), r.Threshold, r.ForMinutes, last))
+		case last <= r.Threshold:
+			resolve(db, r, appID, "", fmt.Sprintf("%s usage of %s is back to %.1f%%.", what, appName(db, appID), last))
+		}
+	}
+	resolveInactive(db, r, func(a models.Alert) bool { return active[a.ApplicationID] }, "No recent samples; the container is not running.")
+}
+
+func deployedApplications(db *sql.DB) ([]int64, error) {
+	rows, err := db.Query("SELECT id FROM applications WHERE container_id IS NOT NULL AND container_id != ''")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+func evaluateDisk(db *sql.DB, r models.AlertRule) {
+	used, err := diskUsage(r.Path)
+	if err != nil {
+		log.Printf("[WARN] alerts: disk usage of %s: %v", r.Path, err)
+		return
+	}
+	if used > r.Threshold {
+		fire(db, r, 0, r.Path, fmt.Sprintf("The filesystem of %s is %.1f%% full (threshold %g%%).", r.Path, used, r.Threshold))
+	} else {
+		resolve(db, r, 0, r.Path, fmt.Sprintf("The filesystem of %s is %.1f%% full.", r.Path, used))
+	}
+	resolveInactive(db, r, func(a models.Alert) bool { return a.Subject == r.Path }, "The rule now watches another path.")
+}
+
+func evaluateCertificates(db *sql.DB, r models.AlertRule) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	hosts := map[string]bool{}
+	for _, cert := range proxy.Certificates(ctx) {
+		if cert.NotAfter == nil {
+			continue
+		}
+		hosts[cert.Host] = true
+		days := time.Until(*cert.NotAfter).Hours() / 24
+		if days < r.Threshold {
+			message := fmt.Sprintf("The certificate for %s expires in %d days, on %s.", cert.Host, int(math.Max(days, 0)), cert.NotAfter.UTC().Format("2006-01-02"))
+			if days <= 0 {
+				message = fmt.Sprintf("The certificate for %s expired on %s.", cert.Host, cert.NotAfter.UTC().Format("2006-01-02"))
+			}
+			if cert.Error != "" {
+				message += " Renewal failed: " + cert.Error
+			}
+			fire(db, r, 0, cert.Host, message)
+		} else {
+			resolve(db, r, 0, cert.Host, fmt.Sprintf("The certificate for %s is valid until %s.", cert.Host, cert.NotAfter.UTC().Format("2006-01-02")))
+		}
+	}
+	resolveInactive(db, r, func(a models.Alert) bool { return hosts[a.Subject] }, "The host is no longer routed.")
+}
+
+// resolveInactive resolves the firing alerts of r that keep reports no
+// longer apply, e.g. of deleted applications or hosts
+func resolveInactive(db *sql.DB, r models.AlertRule, keep func(models.Alert) bool, message string) {
+	firing, err := firingFor(db, r.ID)
+	if err != nil {
+		log.Printf("[WARN] alerts: could not load alerts of rule %d: %v", r.ID, err)
+		return
+	}
+	for _, a := range firing {
+		if !keep(a) {
+			resolve(db, r, a.ApplicationID, a.Subject, message)
+		}
+	}
+}
+
+// pruneHistory forgets stale kill, OOM and death records
+func pruneHistory() {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	for id, t := range kills {
+		if time.Since(t) > stopGrace {
+			delete(kills, id)
+		}
+	}
+	for id, t := range ooms {
+		if time.Since(t) > stopGrace {
+			delete(ooms, id)
+		}
+	}
+	for appID, list := range deaths {
+		if len(list) == 0 || time.Since(list[len(list)-1]) > maxCrashWindow {
+			delete(deaths, appID)
+		}
+	}
+}
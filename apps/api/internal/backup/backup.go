@@ -0,0 +1,443 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/gakwaya-panel/api/internal/models"
+	"github.com/gakwaya-panel/api/internal/volumes"
+)
+
+// Backup statuses
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// ErrNothingToBackUp is returned when an application has no volume or bind path to back up
+var ErrNothingToBackUp = errors.New("application has no volumes or bind paths to back up")
+
+// ErrVolumeExists is returned when restoring into a new volume that already exists
+var ErrVolumeExists = errors.New("target volume already exists")
+
+// helperImage returns BACKUP_HELPER_IMAGE, defaulting to alpine
+func helperImage() string {
+	if img := os.Getenv("BACKUP_HELPER_IMAGE"); img != "" {
+		return img
+	}
+	return "alpine:3.20"
+}
+
+// DefaultKeep returns BACKUP_RETENTION (backups kept per source), defaulting to 7
+func DefaultKeep() int {
+	if v, err := strconv.Atoi(os.Getenv("BACKUP_RETENTION")); err == nil && v > 0 {
+		return v
+	}
+	return 7
+}
+
+// Sources returns the named volumes and bind mounts of an application that
+// can be backed up. tmpfs mounts are skipped.
+func Sources(app models.Application) ([]mount.Mount, error) {
+	mounts, err := volumes.Mounts(app.Volumes)
+	if err != nil {
+		return nil, err
+	}
+	var out []mount.Mount
+	for _, m := range mounts {
+		if m.Type == mount.TypeVolume || m.Type == mount.TypeBind {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+// objectKey returns the storage key of a new backup
+func objectKey(appID int64, source string, at time.Time) string {
+	name := strings.Trim(strings.NewReplacer("/", "_", ":", "_").Replace(source), "_")
+	return fmt.Sprintf("app-%d/%s-%s.tar.gz", appID, name, at.UTC().Format("20060102T150405Z"))
+}
+
+// ensureImage pulls the helper image if it is not present
+func ensureImage(ctx context.Context, cli *client.Client, image string) error {
+	if _, _, err := cli.ImageInspectWithRaw(ctx, image); err == nil {
+		return nil
+	}
+	rc, err := cli.ImagePull(ctx, image, types.ImagePullOptions{})
+	if err != nil {
+		return fmt.Errorf("pull %s: %w", image, err)
+	}
+	defer rc.Close()
+	_, err = io.Copy(io.Discard, rc)
+	return err
+}
+
+// runHelper runs cmd in a throwaway helper container with mounts and copies
+// its stdout to stdout. The container is removed afterwards.
+func runHelper(ctx context.Context, cli *client.Client, mounts []mount.Mount, cmd []string, stdout io.Writer) error {
+	created, err := cli.ContainerCreate(ctx,
+		&container.Config{Image: helperImage(), Cmd: cmd, AttachStdout: true, AttachStderr: true},
+		&container.HostConfig{Mounts: mounts},
+		nil, nil, "")
+	if err != nil {
+		return err
+	}
+	defer cli.ContainerRemove(context.Background(), created.ID, types.ContainerRemoveOptions{Force: true})
+
+	// Attach before starting so no output is lost; attached streams carry
+	// binary data intact, unlike the logs endpoint
+	attach, err := cli.ContainerAttach(ctx, created.ID, types.ContainerAttachOptions{Stream: true, Stdout: true, Stderr: true})
+	if err != nil {
+		return err
+	}
+	defer attach.Close()
+	waitCh, errCh := cli.ContainerWait(ctx, created.ID, container.WaitConditionNextExit)
+	if err := cli.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(stdout, &stderr, attach.Reader); err != nil {
+		return err
+	}
+	select {
+	case res := <-waitCh:
+		if res.StatusCode != 0 {
+			return fmt.Errorf("helper exited with code %d: %s", res.StatusCode, strings.TrimSpace(stderr.String()))
+		}
+	case err := <-errCh:
+		return err
+	}
+	return nil
+}
+
+// stopApp stops the application's container if it is running and returns a
+// function that starts it again
+func stopApp(ctx context.Context, cli *client.Client, containerID string) (func(), error) {
+	if containerID == "" {
+		return func() {}, nil
+	}
+	info, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil || info.State == nil || !info.State.Running {
+		return func() {}, nil
+	}
+	if err := cli.ContainerStop(ctx, containerID, container.StopOptions{}); err != nil {
+		return nil, fmt.Errorf("stop application: %w", err)
+	}
+	return func() {
+		if err := cli.ContainerStart(context.Background(), containerID, types.ContainerStartOptions{}); err != nil {
+			log.Printf("[WARN] backup: could not restart container %s: %v", containerID, err)
+		}
+	}, nil
+}
+
+// Run backs up the application's volumes and bind paths (only those in
+// only, when given) to the configured storage. Each source becomes one
+// gzipped tarball and one row in backups. With stop set, the application is
+// stopped for the duration so the copy is consistent.
+func Run(ctx context.Context, cli *client.Client, db *sql.DB, app models.Application, only []string, stop bool) ([]models.Backup, error) {
+	sources, err := Sources(app)
+	if err != nil {
+		return nil, err
+	}
+	if len(only) > 0 {
+		wanted := map[string]bool{}
+		for _, s := range only {
+			wanted[s] = true
+		}
+		var filtered []mount.Mount
+		for _, m := range sources {
+			if wanted[m.Source] {
+				filtered = append(filtered, m)
+			}
+		}
+		sources = filtered
+	}
+	if len(sources) == 0 {
+		return nil, ErrNothingToBackUp
+	}
+	store, err := FromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureImage(ctx, cli, helperImage()); err != nil {
+		return nil, err
+	}
+	if stop {
+		restart, err := stopApp(ctx, cli, app.ContainerID)
+		if err != nil {
+			return nil, err
+		}
+		defer restart()
+	}
+
+	var out []models.Backup
+	for _, m := range sources {
+		b := models.Backup{
+			ApplicationID: app.ID,
+			Kind:          string(m.Type),
+			Source:        m.Source,
+			Storage:       store.Name(),
+			Status:        StatusRunning,
+			CreatedAt:     time.Now(),
+		}
+		res, err := db.Exec("INSERT INTO backups (application_id, kind, source, storage, status, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+			b.ApplicationID, b.Kind, b.Source, b.Storage, b.Status, b.CreatedAt)
+		if err != nil {
+			return out, err
+		}
+		b.ID, _ = res.LastInsertId()
+
+		b.Key = objectKey(app.ID, m.Source, b.CreatedAt)
+		b.Size, b.Checksum, err = snapshot(ctx, cli, store, m, b.Key)
+		if err != nil {
+			b.Key, b.Status, b.Error = "", StatusFailed, err.Error()
+		} else {
+			b.Status = StatusSucceeded
+		}
+		if _, err := db.Exec("UPDATE backups SET key = ?, size = ?, checksum = ?, status = ?, error = ? WHERE id = ?", b.Key, b.Size, b.Checksum, b.Status, b.Error, b.ID); err != nil {
+			log.Printf("[WARN] backup: could not update backup %d: %v", b.ID, err)
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// snapshot tars one mount through a helper container into a temp file and
+// uploads it, returning the stored size and checksum
+func snapshot(ctx context.Context, cli *client.Client, store Storage, m mount.Mount, key string) (int64, string, error) {
+	tmp, err := os.CreateTemp("", "gakwayapanel-backup-*.tar.gz")
+	if err != nil {
+		return 0, "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	src := mount.Mount{Type: m.Type, Source: m.Source, Target: "/source", ReadOnly: true}
+	if err := runHelper(ctx, cli, []mount.Mount{src}, []string{"tar", "-czf", "-", "-C", "/source", "."}, tmp); err != nil {
+		return 0, "", err
+	}
+	size, checksum, err := fileChecksum(tmp)
+	if err != nil {
+		return 0, "", err
+	}
+	if err := store.Put(ctx, key, tmp); err != nil {
+		return 0, "", err
+	}
+	return size, checksum, nil
+}
+
+// fileChecksum returns the size and hex SHA-256 of f and rewinds it
+func fileChecksum(f *os.File) (int64, string, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, "", err
+	}
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checksumWriter counts and hashes what is written through it, so a file
+// can be checksummed while it is written rather than read back
+type checksumWriter struct {
+	h    hash.Hash
+	size int64
+}
+
+func newChecksumWriter() *checksumWriter {
+	return &checksumWriter{h: sha256.New()}
+}
+
+func (w *checksumWriter) Write(p []byte) (int, error) {
+	w.size += int64(len(p))
+	return w.h.Write(p)
+}
+
+// sum returns the hex SHA-256 of what was written
+func (w *checksumWriter) sum() string {
+	return hex.EncodeToString(w.h.Sum(nil))
+}
+
+// Restore extracts a backup into its original source or, when target names
+// a volume that does not exist yet, into that new volume. Restoring in
+// place replaces the source contents and stops the application's container
+// meanwhile. It returns the name or path that was restored into.
+func Restore(ctx context.Context, cli *client.Client, db *sql.DB, b models.Backup, target string) (string, error) {
+	if b.Status != StatusSucceeded {
+		return "", errors.New("only succeeded backups can be restored")
+	}
+	if b.Kind == KindDump {
+		return "", errors.New("database dumps are restored into a database, not a volume")
+	}
+	dst := mount.Mount{Type: mount.Type(b.Kind), Source: b.Source, Target: "/restore"}
+	if target != "" && target != b.Source {
+		if !volumes.ValidName(target) {
+			return "", fmt.Errorf("invalid volume name %q", target)
+		}
+		if _, err := cli.VolumeInspect(ctx, target); err == nil {
+			return "", ErrVolumeExists
+		}
+		if _, err := cli.VolumeCreate(ctx, volume.CreateOptions{Name: target}); err != nil {
+			return "", err
+		}
+		dst = mount.Mount{Type: mount.TypeVolume, Source: target, Target: "/restore"}
+	} else {
+		var containerID sql.NullString
+		err := db.QueryRow("SELECT container_id FROM applications WHERE id = ?", b.ApplicationID).Scan(&containerID)
+		if err != nil && err != sql.ErrNoRows {
+			return "", err
+		}
+		restart, err := stopApp(ctx, cli, containerID.String)
+		if err != nil {
+			return "", err
+		}
+		defer restart()
+	}
+
+	archive, err := fetchVerified(ctx, b)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+	if err := ensureImage(ctx, cli, helperImage()); err != nil {
+		return "", err
+	}
+
+	// Empty the target, then unpack the tarball into it. The helper has
+	// exited by then, and Docker accepts gzipped archives for copies into
+	// stopped containers.
+	created, err := cli.ContainerCreate(ctx,
+		&container.Config{Image: helperImage(), Cmd: []string{"find", "/restore", "-mindepth", "1", "-delete"}},
+		&container.HostConfig{Mounts: []mount.Mount{dst}},
+		nil, nil, "")
+	if err != nil {
+		return "", err
+	}
+	defer cli.ContainerRemove(context.Background(), created.ID, types.ContainerRemoveOptions{Force: true})
+	waitCh, errCh := cli.ContainerWait(ctx, created.ID, container.WaitConditionNextExit)
+	if err := cli.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+		return "", err
+	}
+	select {
+	case res := <-waitCh:
+		if res.StatusCode != 0 {
+			return "", fmt.Errorf("clearing %s failed with code %d", dst.Source, res.StatusCode)
+		}
+	case err := <-errCh:
+		return "", err
+	}
+	if err := cli.CopyToContainer(ctx, created.ID, "/restore", archive, types.CopyToContainerOptions{}); err != nil {
+		return "", fmt.Errorf("extract backup: %w", err)
+	}
+	return dst.Source, nil
+}
+
+// Delete removes a backup from storage and the database
+func Delete(ctx context.Context, db *sql.DB, b models.Backup) error {
+	if b.Key != "" {
+		store, err := Open(b.Storage)
+		if err != nil {
+			return err
+		}
+		if err := store.Delete(ctx, b.Key); err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec("DELETE FROM backups WHERE id = ?", b.ID)
+	return err
+}
+
+// Enforce keeps the newest successful backups of each source of an
+// application and deletes the rest, along with failed backups older than
+// them. keep maps a mode to how many backups of its sources are kept; a
+// mode missing from it uses DefaultKeep.
+func Enforce(ctx context.Context, db *sql.DB, appID int64, keep map[string]int) (int, error) {
+	list, err := List(db, appID)
+	if err != nil {
+		return 0, err
+	}
+	kept := map[string]int{}
+	removed := 0
+	for _, b := range list { // newest first
+		if b.Status == StatusRunning {
+			continue
+		}
+		mode := ModeVolumes
+		if b.Kind == KindDump {
+			mode = ModeDump
+		}
+		n := keep[mode]
+		if n <= 0 {
+			n = DefaultKeep()
+		}
+		if b.Status == StatusSucceeded && kept[b.Source] < n {
+			kept[b.Source]++
+			continue
+		}
+		if b.Status == StatusFailed && kept[b.Source] < n {
+			continue
+		}
+		if err := Delete(ctx, db, b); err != nil {
+			log.Printf("[WARN] backup: could not delete backup %d: %v", b.ID, err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+const backupColumns = "id, application_id, kind, source, storage, key, size, checksum, status, error, created_at"
+
+func scanBackup(row interface{ Scan(...any) error }) (models.Backup, error) {
+	var b models.Backup
+	err := row.Scan(&b.ID, &b.ApplicationID, &b.Kind, &b.Source, &b.Storage, &b.Key, &b.Size, &b.Checksum, &b.Status, &b.Error, &b.CreatedAt)
+	return b, err
+}
+
+// List returns the backups of an application, newest first
+func List(db *sql.DB, appID int64) ([]models.Backup, error) {
+	rows, err := db.Query("SELECT "+backupColumns+" FROM backups WHERE application_id = ? ORDER BY id DESC", appID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []models.Backup{}
+	for rows.Next() {
+		b, err := scanBackup(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// Get returns one backup by ID
+func Get(db *sql.DB, id int64) (models.Backup, error) {
+	return scanBackup(db.QueryRow("SELECT "+backupColumns+" FROM backups WHERE id = ?", id))
+}
@@ -0,0 +1,370 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/gakwaya-panel/api/internal/models"
+)
+
+// KindDump marks logical database dumps in backups.kind
+const KindDump = "dump"
+
+// ErrNoEngine is returned when a dump is requested for an application that
+// is not a managed database and no engine was given
+var ErrNoEngine = errors.New("engine is required for applications that are not managed databases")
+
+// ErrNotRunning is returned when the database container is not running
+var ErrNotRunning = errors.New("database container is not running")
+
+// ErrChecksumMismatch is returned when a stored backup no longer matches its checksum
+var ErrChecksumMismatch = errors.New("backup checksum mismatch")
+
+// dumpSpec describes how to dump and restore one engine. Commands run with
+// /bin/sh -c inside the database container and read credentials from the
+// container's own env, so they also work for containers the panel did not
+// provision. Dumps are gzipped by the panel.
+type dumpSpec struct {
+	ext     string
+	dump    string
+	restore string
+}
+
+var dumpSpecs = map[string]dumpSpec{
+	"postgres": {
+		ext:     "pgdump.gz",
+		dump:    `exec pg_dump -U "${POSTGRES_USER:-postgres}" -d "${POSTGRES_DB:-${POSTGRES_USER:-postgres}}" --format=custom --no-owner`,
+		restore: `exec pg_restore -U "${POSTGRES_USER:-postgres}" -d "${POSTGRES_DB:-${POSTGRES_USER:-postgres}}" --clean --if-exists --no-owner --single-transaction`,
+	},
+	"mysql": {
+		ext: "sql.gz",
+		dump: `export MYSQL_PWD="$MYSQL_ROOT_PASSWORD"; ` +
+			`if [ -n "$MYSQL_DATABASE" ]; then exec mysqldump -uroot --single-transaction --routines --triggers "$MYSQL_DATABASE"; ` +
+			`else exec mysqldump -uroot --single-transaction --routines --triggers --all-databases; fi`,
+		restore: `export MYSQL_PWD="$MYSQL_ROOT_PASSWORD"; exec mysql -uroot ${MYSQL_DATABASE:+"$MYSQL_DATABASE"}`,
+	},
+	"mongodb": {
+		ext: "archive.gz",
+		dump: `exec mongodump --archive --quiet ` +
+			`${MONGO_INITDB_ROOT_USERNAME:+--username "$MONGO_INITDB_ROOT_USERNAME" --password "$MONGO_INITDB_ROOT_PASSWORD" --authenticationDatabase admin}`,
+		restore: `exec mongorestore --archive --drop --quiet ` +
+			`${MONGO_INITDB_ROOT_USERNAME:+--username "$MONGO_INITDB_ROOT_USERNAME" --password "$MONGO_INITDB_ROOT_PASSWORD" --authenticationDatabase admin}`,
+	},
+	"redis": {
+		// redis-cli writes the RDB to a file; copy it out and clean up
+		ext: "rdb.gz",
+		dump: `f=/tmp/gakwayapanel-dump.rdb; ` +
+			`redis-cli ${REDIS_PASSWORD:+-a "$REDIS_PASSWORD"} --no-auth-warning --rdb "$f" >&2 && cat "$f"; ` +
+			`rc=$?; rm -f "$f"; exit $rc`,
+	},
+}
+
+// DumpEngines returns the engines that support logical dumps, sorted
+func DumpEngines() []string {
+	names := make([]string, 0, len(dumpSpecs))
+	for name := range dumpSpecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DumpEngine returns the engine to dump an application with: requested, or
+// the application's managed database engine
+func DumpEngine(app models.Application, requested string) (string, error) {
+	engine := requested
+	if engine == "" {
+		engine = app.ServiceType
+	}
+	if engine == "" {
+		return "", ErrNoEngine
+	}
+	if _, ok := dumpSpecs[engine]; !ok {
+		return "", fmt.Errorf("dumps are not supported for engine %q; use one of %s", engine, strings.Join(DumpEngines(), ", "))
+	}
+	return engine, nil
+}
+
+// runningContainer checks that containerID exists and is running
+func runningContainer(ctx context.Context, cli *client.Client, containerID string) error {
+	if containerID == "" {
+		return ErrNotRunning
+	}
+	info, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return err
+	}
+	if info.State == nil || !info.State.Running {
+		return ErrNotRunning
+	}
+	return nil
+}
+
+// execStream runs script with /bin/sh -c in a container, feeding stdin when
+// given and copying stdout to stdout. Errors carry the tail of stderr.
+func execStream(ctx context.Context, cli *client.Client, containerID, script string, stdin io.Reader, stdout io.Writer) error {
+	exec, err := cli.ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		Cmd:          []string{"/bin/sh", "-c", script},
+		AttachStdin:  stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return err
+	}
+	attach, err := cli.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		return err
+	}
+	defer attach.Close()
+	if stdin != nil {
+		go func() {
+			io.Copy(attach.Conn, stdin)
+			attach.CloseWrite()
+		}()
+	}
+	var stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(stdout, &stderr, attach.Reader); err != nil {
+		return err
+	}
+	res, err := cli.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return err
+	}
+	if res.ExitCode != 0 {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 2000 {
+			msg = msg[len(msg)-2000:]
+		}
+		return fmt.Errorf("exited with code %d: %s", res.ExitCode, msg)
+	}
+	return nil
+}
+
+// Dump takes a logical dump of a database application with engine's dump
+// tool, gzips it into the configured storage and records it with its
+// SHA-256 checksum
+func Dump(ctx context.Context, cli *client.Client, db *sql.DB, app models.Application, engine string) (models.Backup, error) {
+	spec := dumpSpecs[engine]
+	if err := runningContainer(ctx, cli, app.ContainerID); err != nil {
+		return models.Backup{}, err
+	}
+	store, err := FromEnv()
+	if err != nil {
+		return models.Backup{}, err
+	}
+	b := models.Backup{
+		ApplicationID: app.ID,
+		Kind:          KindDump,
+		Source:        engine,
+		Storage:       store.Name(),
+		Status:        StatusRunning,
+		CreatedAt:     time.Now(),
+	}
+	res, err := db.Exec("INSERT INTO backups (application_id, kind, source, storage, status, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		b.ApplicationID, b.Kind, b.Source, b.Storage, b.Status, b.CreatedAt)
+	if err != nil {
+		return b, err
+	}
+	b.ID, _ = res.LastInsertId()
+
+	key := fmt.Sprintf("app-%d/%s-%s.%s", app.ID, engine, b.CreatedAt.UTC().Format("20060102T150405Z"), spec.ext)
+	size, checksum, err := dumpToStore(ctx, cli, store, app.ContainerID, spec, key)
+	if err != nil {
+		b.Status, b.Error = StatusFailed, err.Error()
+	} else {
+		b.Key, b.Size, b.Checksum, b.Status = key, size, checksum, StatusSucceeded
+	}
+	if _, err := db.Exec("UPDATE backups SET key = ?, size = ?, checksum = ?, status = ?, error = ? WHERE id = ?", b.Key, b.Size, b.Checksum, b.Status, b.Error, b.ID); err != nil {
+		log.Printf("[WARN] backup: could not update backup %d: %v", b.ID, err)
+	}
+	return b, nil
+}
+
+// dumpToStore streams the dump through gzip into a temp file, checksumming
+// it on the way, and uploads it
+func dumpToStore(ctx context.Context, cli *client.Client, store Storage, containerID string, spec dumpSpec, key string) (int64, string, error) {
+	tmp, err := os.CreateTemp("", "gakwayapanel-dump-*.gz")
+	if err != nil {
+		return 0, "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sum := newChecksumWriter()
+	gz := gzip.NewWriter(io.MultiWriter(tmp, sum))
+	if err := execStream(ctx, cli, containerID, spec.dump, nil, gz); err != nil {
+		return 0, "", fmt.Errorf("dump %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return 0, "", err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, "", err
+	}
+	if err := store.Put(ctx, key, tmp); err != nil {
+		return 0, "", err
+	}
+	return sum.size, sum.sum(), nil
+}
+
+// RestoreDump loads a dump into a running database application of the
+// same engine, replacing its data. The dump is verified against its
+// checksum first.
+func RestoreDump(ctx context.Context, cli *client.Client, b models.Backup, target models.Application) error {
+	if b.Status != StatusSucceeded {
+		return errors.New("only succeeded backups can be restored")
+	}
+	spec := dumpSpecs[b.Source]
+	if target.ServiceType != "" && target.ServiceType != b.Source {
+		return fmt.Errorf("cannot restore a %s dump into a %s database", b.Source, target.ServiceType)
+	}
+	if err := runningContainer(ctx, cli, target.ContainerID); err != nil {
+		return err
+	}
+	local, err := fetchVerified(ctx, b)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(local.Name())
+	defer local.Close()
+	gz, err := gzip.NewReader(local)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	if b.Source == "redis" {
+		return restoreRedis(ctx, cli, target.ContainerID, gz)
+	}
+	if err := execStream(ctx, cli, target.ContainerID, spec.restore, gz, io.Discard); err != nil {
+		return fmt.Errorf("restore %w", err)
+	}
+	return nil
+}
+
+// restoreRedis replaces the RDB file of a Redis container and restarts it.
+// Append-only files are removed so Redis loads the restored RDB on start.
+func restoreRedis(ctx context.Context, cli *client.Client, containerID string, rdb io.Reader) error {
+	// The tar header needs the size, so unpack to disk rather than memory
+	tmp, err := os.CreateTemp("", "gakwayapanel-restore-*.rdb")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, rdb)
+	if err != nil {
+		return err
+	}
+
+	var dir bytes.Buffer
+	if err := execStream(ctx, cli, containerID, `redis-cli ${REDIS_PASSWORD:+-a "$REDIS_PASSWORD"} --no-auth-warning --raw CONFIG GET dir | tail -n 1`, nil, &dir); err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	dataDir := strings.TrimSpace(dir.String())
+	if dataDir == "" {
+		dataDir = "/data"
+	}
+	script := `redis-cli ${REDIS_PASSWORD:+-a "$REDIS_PASSWORD"} --no-auth-warning CONFIG SET appendonly no >/dev/null && ` +
+		`rm -rf "` + dataDir + `/appendonlydir" "` + dataDir + `/appendonly.aof"`
+	if err := execStream(ctx, cli, containerID, script, nil, io.Discard); err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	// Stop without saving so the running dataset does not overwrite the
+	// dump. The exec usually fails because the server goes away with it, so
+	// its error only counts when the container keeps running.
+	waitCh, errCh := cli.ContainerWait(ctx, containerID, container.WaitConditionNotRunning)
+	if err := execStream(ctx, cli, containerID, `redis-cli ${REDIS_PASSWORD:+-a "$REDIS_PASSWORD"} --no-auth-warning SHUTDOWN NOSAVE`, nil, io.Discard); err != nil {
+		if running := runningContainer(ctx, cli, containerID); running == nil {
+			return fmt.Errorf("restore: shutdown: %w", err)
+		}
+	}
+	select {
+	case res := <-waitCh:
+		if res.Error != nil && res.Error.Message != "" {
+			return fmt.Errorf("restore: wait for shutdown: %s", res.Error.Message)
+		}
+	case err := <-errCh:
+		return fmt.Errorf("restore: wait for shutdown: %w", err)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := tw.WriteHeader(&tar.Header{Name: "dump.rdb", Mode: 0o644, Size: size, ModTime: time.Now(), Uid: 999, Gid: 999})
+		if err == nil {
+			_, err = io.Copy(tw, tmp)
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	copyErr := cli.CopyToContainer(ctx, containerID, dataDir, pr, types.CopyToContainerOptions{})
+	pr.CloseWithError(copyErr)
+	// Start the server again even when the copy failed, so the database is
+	// not left down
+	startErr := cli.ContainerStart(ctx, containerID, types.ContainerStartOptions{})
+	if copyErr != nil {
+		return fmt.Errorf("restore: copy dump: %w", copyErr)
+	}
+	if startErr != nil {
+		return fmt.Errorf("restore: restart: %w", startErr)
+	}
+	return nil
+}
+
+// fetchVerified downloads a backup to a temp file and checks its checksum
+// when one was recorded. The caller removes the file.
+func fetchVerified(ctx context.Context, b models.Backup) (*os.File, error) {
+	store, err := Open(b.Storage)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := store.Get(ctx, b.Key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	tmp, err := os.CreateTemp("", "gakwayapanel-restore-*")
+	if err != nil {
+		return nil, err
+	}
+	fail := func(err error) (*os.File, error) {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	sum := newChecksumWriter()
+	if _, err := io.Copy(io.MultiWriter(tmp, sum), rc); err != nil {
+		return fail(err)
+	}
+	if b.Checksum != "" && sum.sum() != b.Checksum {
+		return fail(ErrChecksumMismatch)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+	return tmp, nil
+}
@@ -0,0 +1,247 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/cron"
+	"github.com/gakwaya-panel/api/internal/dockerutil"
+	"github.com/gakwaya-panel/api/internal/models"
+)
+
+// runTimeout bounds one scheduled backup run
+const runTimeout = 2 * time.Hour
+
+var (
+	runningMu sync.Mutex
+	running   = map[int64]bool{} // application ID -> scheduled run in progress
+)
+
+// Schedule modes
+const (
+	ModeVolumes = "volumes"
+	ModeDump    = "dump"
+)
+
+const scheduleColumns = "id, application_id, cron, keep, stop_app, mode, engine, enabled, last_run_at, created_at"
+
+func scanSchedule(row interface{ Scan(...any) error }) (models.BackupSchedule, error) {
+	var s models.BackupSchedule
+	var lastRun sql.NullTime
+	err := row.Scan(&s.ID, &s.ApplicationID, &s.Cron, &s.Keep, &s.StopApp, &s.Mode, &s.Engine, &s.Enabled, &lastRun, &s.CreatedAt)
+	if lastRun.Valid {
+		s.LastRunAt = &lastRun.Time
+	}
+	s.NextRunAt = NextRun(s)
+	return s, err
+}
+
+// GetSchedule returns a backup schedule
+func GetSchedule(db *sql.DB, id int64) (models.BackupSchedule, error) {
+	return scanSchedule(db.QueryRow("SELECT "+scheduleColumns+" FROM backup_schedules WHERE id = ?", id))
+}
+
+// ListSchedules returns the backup schedules of an application
+func ListSchedules(db *sql.DB, appID int64) ([]models.BackupSchedule, error) {
+	rows, err := db.Query("SELECT "+scheduleColumns+" FROM backup_schedules WHERE application_id = ? ORDER BY id", appID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []models.BackupSchedule{}
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// SaveSchedule creates the schedule, or updates it when s.ID is set, and
+// returns its ID
+func SaveSchedule(db *sql.DB, s models.BackupSchedule) (int64, error) {
+	if s.Mode == "" {
+		s.Mode = ModeVolumes
+	}
+	if s.ID != 0 {
+		_, err := db.Exec("UPDATE backup_schedules SET cron = ?, keep = ?, stop_app = ?, mode = ?, engine = ?, enabled = ? WHERE id = ?",
+			s.Cron, s.Keep, s.StopApp, s.Mode, s.Engine, s.Enabled, s.ID)
+		return s.ID, err
+	}
+	res, err := db.Exec("INSERT INTO backup_schedules (application_id, cron, keep, stop_app, mode, engine, enabled, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		s.ApplicationID, s.Cron, s.Keep, s.StopApp, s.Mode, s.Engine, s.Enabled, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// DeleteSchedule removes a backup schedule; its backups are kept
+func DeleteSchedule(db *sql.DB, id int64) (bool, error) {
+	res, err := db.Exec("DELETE FROM backup_schedules WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ScheduleKeep returns how many backups of each mode an application keeps:
+// the largest keep among its schedules of that mode, so that schedules
+// writing the same sources do not prune each other's backups
+func ScheduleKeep(db *sql.DB, appID int64) (map[string]int, error) {
+	schedules, err := ListSchedules(db, appID)
+	if err != nil {
+		return nil, err
+	}
+	keep := map[string]int{}
+	for _, s := range schedules {
+		n := s.Keep
+		if n <= 0 {
+			n = DefaultKeep()
+		}
+		if n > keep[s.Mode] {
+			keep[s.Mode] = n
+		}
+	}
+	return keep, nil
+}
+
+// NextRun returns when a schedule fires next, or nil if it is disabled or invalid
+func NextRun(s models.BackupSchedule) *time.Time {
+	if !s.Enabled {
+		return nil
+	}
+	sched, err := cron.Parse(s.Cron)
+	if err != nil {
+		return nil
+	}
+	from := s.CreatedAt
+	if s.LastRunAt != nil {
+		from = *s.LastRunAt
+	}
+	next := sched.Next(from.Local())
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// StartScheduler checks the backup schedules every minute and runs the due ones
+func StartScheduler(db *sql.DB) {
+	go func() {
+		for range time.Tick(time.Minute) {
+			runDue(db)
+		}
+	}()
+}
+
+func runDue(db *sql.DB) {
+	rows, err := db.Query("SELECT " + scheduleColumns + " FROM backup_schedules WHERE enabled = 1")
+	if err != nil {
+		log.Printf("[WARN] backup: could not load schedules: %v", err)
+		return
+	}
+	var due []models.BackupSchedule
+	now := time.Now()
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			log.Printf("[WARN] backup: could not read schedule: %v", err)
+			continue
+		}
+		if next := NextRun(s); next != nil && !next.After(now) {
+			due = append(due, s)
+		}
+	}
+	rows.Close()
+
+	for _, s := range due {
+		runningMu.Lock()
+		busy := running[s.ApplicationID]
+		running[s.ApplicationID] = true
+		runningMu.Unlock()
+		if busy {
+			continue
+		}
+		if _, err := db.Exec("UPDATE backup_schedules SET last_run_at = ? WHERE id = ?", now, s.ID); err != nil {
+			log.Printf("[WARN] backup: could not update schedule %d: %v", s.ID, err)
+		}
+		go func(s models.BackupSchedule) {
+			defer func() {
+				runningMu.Lock()
+				delete(running, s.ApplicationID)
+				runningMu.Unlock()
+			}()
+			runScheduled(db, s)
+		}(s)
+	}
+}
+
+func runScheduled(db *sql.DB, s models.BackupSchedule) {
+	ctx, cancel := context.WithTimeout(context.Background(), runTimeout)
+	defer cancel()
+	app, err := loadApplication(db, s.ApplicationID)
+	if err != nil {
+		log.Printf("[WARN] backup: application %d: %v", s.ApplicationID, err)
+		return
+	}
+	cli, err := dockerutil.NewClient()
+	if err != nil {
+		log.Printf("[WARN] backup: docker client: %v", err)
+		return
+	}
+	defer cli.Close()
+
+	var results []models.Backup
+	if s.Mode == ModeDump {
+		var engine string
+		engine, err = DumpEngine(app, s.Engine)
+		if err == nil {
+			var b models.Backup
+			b, err = Dump(ctx, cli, db, app, engine)
+			results = append(results, b)
+		}
+	} else {
+		results, err = Run(ctx, cli, db, app, nil, s.StopApp)
+	}
+	if err != nil {
+		log.Printf("[WARN] backup: application %d: %v", s.ApplicationID, err)
+		return
+	}
+	var removed int
+	for _, b := range results {
+		if b.Status == StatusFailed {
+			log.Printf("[WARN] backup: application %d, %s: %s", s.ApplicationID, b.Source, b.Error)
+		}
+	}
+	keep, err := ScheduleKeep(db, s.ApplicationID)
+	if err == nil {
+		removed, err = Enforce(ctx, db, s.ApplicationID, keep)
+	}
+	if err != nil {
+		log.Printf("[WARN] backup: retention for application %d: %v", s.ApplicationID, err)
+	}
+	log.Printf("[INFO] backup: application %d: %d backups taken, %d old backups removed", s.ApplicationID, len(results), removed)
+}
+
+// loadApplication reads the fields a backup needs
+func loadApplication(db *sql.DB, id int64) (models.Application, error) {
+	var app models.Application
+	var volumesStr, containerID sql.NullString
+	err := db.QueryRow("SELECT id, name, volumes, container_id, service_type FROM applications WHERE id = ?", id).Scan(&app.ID, &app.Name, &volumesStr, &containerID, &app.ServiceType)
+	if err != nil {
+		return app, err
+	}
+	app.ContainerID = containerID.String
+	if volumesStr.String != "" {
+		_ = json.Unmarshal([]byte(volumesStr.String), &app.Volumes)
+	}
+	return app, nil
+}
@@ -0,0 +1,108 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Storage keeps backup tarballs under slash-separated keys
+type Storage interface {
+	Name() string
+	Put(ctx context.Context, key string, f *os.File) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// ErrObjectNotFound is returned by Get for missing keys
+var ErrObjectNotFound = errors.New("backup object not found")
+
+// FromEnv returns the storage selected by BACKUP_STORAGE ("local" or "s3")
+func FromEnv() (Storage, error) {
+	return Open(os.Getenv("BACKUP_STORAGE"))
+}
+
+// Open returns the storage with the given name, configured from the environment
+func Open(name string) (Storage, error) {
+	switch strings.ToLower(name) {
+	case "", "local":
+		dir := os.Getenv("BACKUP_DIR")
+		if dir == "" {
+			dir = "backups"
+		}
+		return &Local{Dir: dir}, nil
+	case "s3":
+		return s3FromEnv()
+	}
+	return nil, fmt.Errorf("unknown backup storage %q", name)
+}
+
+// Local stores backups in a directory on the panel host
+type Local struct {
+	Dir string
+}
+
+func (l *Local) Name() string { return "local" }
+
+func (l *Local) path(key string) (string, error) {
+	p := filepath.Join(l.Dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(p, filepath.Clean(l.Dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid backup key %q", key)
+	}
+	return p, nil
+}
+
+func (l *Local) Put(_ context.Context, key string, f *os.File) error {
+	dst, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	tmp := dst + ".part"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, f); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+func (l *Local) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+	return f, err
+}
+
+func (l *Local) Delete(_ context.Context, key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
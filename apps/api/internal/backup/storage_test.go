@@ -0,0 +1,73 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalPath(t *testing.T) {
+	dir := t.TempDir()
+	l := &Local{Dir: dir}
+	for _, key := range []string{"app-1/volumes.tar.gz", "a/b/c.sql.gz", "app-1/../app-2/x"} {
+		p, err := l.path(key)
+		if err != nil {
+			t.Errorf("path(%q): %v", key, err)
+			continue
+		}
+		if rel, err := filepath.Rel(dir, p); err != nil || strings.HasPrefix(rel, "..") {
+			t.Errorf("path(%q) = %q, outside %q", key, p, dir)
+		}
+	}
+	for _, key := range []string{"", ".", "..", "../x", "app-1/../../x", "a/../../../etc/passwd"} {
+		if p, err := l.path(key); err == nil {
+			t.Errorf("path(%q) = %q, want an error", key, p)
+		}
+	}
+	// A sibling directory sharing the prefix is outside too
+	sibling := &Local{Dir: filepath.Join(dir, "backups")}
+	if p, err := sibling.path("../backups-old/x"); err == nil {
+		t.Errorf("path escaped into the sibling directory %q", p)
+	}
+}
+
+func TestLocalRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	l := &Local{Dir: filepath.Join(t.TempDir(), "backups")}
+	src, err := os.CreateTemp(t.TempDir(), "src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if _, err := src.WriteString("dump"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Put(ctx, "app-1/dump.sql.gz", src); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	r, err := l.Get(ctx, "app-1/dump.sql.gz")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "dump" {
+		t.Errorf("Get = %q, want %q", data, "dump")
+	}
+	if err := l.Delete(ctx, "app-1/dump.sql.gz"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := l.Delete(ctx, "app-1/dump.sql.gz"); err != nil {
+		t.Errorf("deleting a missing object: %v", err)
+	}
+	if _, err := l.Get(ctx, "app-1/dump.sql.gz"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Get after Delete: err = %v, want ErrObjectNotFound", err)
+	}
+	if err := l.Put(ctx, "../escape", src); err == nil {
+		t.Error("Put accepted a key outside the directory")
+	}
+}
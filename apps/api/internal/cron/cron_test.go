@@ -0,0 +1,81 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"@fortnightly",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// Monday 10 June 2024, 10:30:15 UTC
+	from := time.Date(2024, 6, 10, 10, 30, 15, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 6, 10, 10, 31, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2024, 6, 11, 10, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 6, 10, 10, 45, 0, 0, time.UTC)},
+		{"0-30/20 * * * *", time.Date(2024, 6, 10, 11, 0, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, 6, 11, 3, 0, 0, 0, time.UTC)},
+		{"0 9,17 * * *", time.Date(2024, 6, 10, 17, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2024, 6, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 6, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1-5", time.Date(2024, 6, 11, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either one matches
+		{"0 0 20 * 3", time.Date(2024, 6, 12, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 6, 10, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 6, 11, 0, 0, 0, 0, time.UTC)},
+		{"@WEEKLY", time.Date(2024, 6, 16, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// Never matches
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Parse(%q).Next(%s) = %s, want %s", tt.expr, from, got, tt.want)
+		}
+	}
+}
+
+func TestNextIsStrictlyAfter(t *testing.T) {
+	s, err := Parse("30 10 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 6, 10, 10, 30, 0, 0, time.UTC)
+	if got, want := s.Next(at), at.AddDate(0, 0, 1); !got.Equal(want) {
+		t.Errorf("Next(%s) = %s, want %s", at, got, want)
+	}
+}
@@ -0,0 +1,176 @@
+// Package databases describes the database engines the panel can provision
+// as managed services: their official images, credentials env and
+// connection URLs.
+package databases
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// Engine is a database the panel can provision
+type Engine struct {
+	Name          string
+	Image         string // repository of the official image
+	Tag           string // default tag
+	Port          int
+	DataDir       string
+	DefaultEnvVar string // variable a linked application receives the URL in
+	// SecretEnv lists the container env vars holding credentials
+	SecretEnv []string
+
+	newEnv  func(user, password, database string) map[string]string
+	creds   func(env map[string]string) (user, password, database string)
+	scheme  string
+	query   string
+	command func(env map[string]string) []string
+}
+
+// Connection is how applications reach a managed database
+type Connection struct {
+	Engine   string `json:"engine"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Database string `json:"database,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password"`
+	URL      string `json:"url"`
+}
+
+var engines = map[string]Engine{
+	"postgres": {
+		Name: "postgres", Image: "postgres", Tag: "16", Port: 5432,
+		DataDir: "/var/lib/postgresql/data", DefaultEnvVar: "DATABASE_URL",
+		SecretEnv: []string{"POSTGRES_PASSWORD"},
+		newEnv: func(user, password, database string) map[string]string {
+			return map[string]string{"POSTGRES_USER": user, "POSTGRES_PASSWORD": password, "POSTGRES_DB": database}
+		},
+		creds: func(env map[string]string) (string, string, string) {
+			return env["POSTGRES_USER"], env["POSTGRES_PASSWORD"], env["POSTGRES_DB"]
+		},
+		scheme: "postgres",
+	},
+	"mysql": {
+		Name: "mysql", Image: "mysql", Tag: "8.4", Port: 3306,
+		DataDir: "/var/lib/mysql", DefaultEnvVar: "DATABASE_URL",
+		SecretEnv: []string{"MYSQL_PASSWORD", "MYSQL_ROOT_PASSWORD"},
+		newEnv: func(user, password, database string) map[string]string {
+			return map[string]string{
+				"MYSQL_USER": user, "MYSQL_PASSWORD": password, "MYSQL_DATABASE": database,
+				"MYSQL_ROOT_PASSWORD": GeneratePassword(),
+			}
+		},
+		creds: func(env map[string]string) (string, string, string) {
+			return env["MYSQL_USER"], env["MYSQL_PASSWORD"], env["MYSQL_DATABASE"]
+		},
+		scheme: "mysql",
+	},
+	"mongodb": {
+		Name: "mongodb", Image: "mongo", Tag: "7", Port: 27017,
+		DataDir: "/data/db", DefaultEnvVar: "MONGODB_URL",
+		SecretEnv: []string{"MONGO_INITDB_ROOT_PASSWORD"},
+		newEnv: func(user, password, database string) map[string]string {
+			return map[string]string{"MONGO_INITDB_ROOT_USERNAME": user, "MONGO_INITDB_ROOT_PASSWORD": password, "MONGO_INITDB_DATABASE": database}
+		},
+		creds: func(env map[string]string) (string, string, string) {
+			return env["MONGO_INITDB_ROOT_USERNAME"], env["MONGO_INITDB_ROOT_PASSWORD"], env["MONGO_INITDB_DATABASE"]
+		},
+		scheme: "mongodb",
+		query:  "authSource=admin",
+	},
+	"redis": {
+		Name: "redis", Image: "redis", Tag: "7", Port: 6379,
+		DataDir: "/data", DefaultEnvVar: "REDIS_URL",
+		SecretEnv: []string{"REDIS_PASSWORD"},
+		newEnv: func(_, password, _ string) map[string]string {
+			return map[string]string{"REDIS_PASSWORD": password}
+		},
+		creds: func(env map[string]string) (string, string, string) {
+			return "", env["REDIS_PASSWORD"], ""
+		},
+		scheme: "redis",
+		// The official image has no password variable. Write it to a config
+		// file readable only by the redis user at start-up rather than passing
+		// it as a flag, where it would show in the container's command line
+		// and process list. The image's entrypoint still drops privileges.
+		command: func(map[string]string) []string {
+			return []string{"sh", "-c", `umask 077 && printf 'requirepass %s\n' "$REDIS_PASSWORD" > /tmp/redis-auth.conf && chown redis /tmp/redis-auth.conf && exec docker-entrypoint.sh redis-server /tmp/redis-auth.conf --appendonly yes`}
+		},
+	},
+}
+
+// Lookup returns the engine with the given name
+func Lookup(name string) (Engine, bool) {
+	e, ok := engines[name]
+	return e, ok
+}
+
+// Names returns the supported engine names, sorted
+func Names() []string {
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+const passwordAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789"
+
+// GeneratePassword returns a random 32-character alphanumeric password,
+// safe to embed in connection URLs without escaping
+func GeneratePassword() string {
+	b := make([]byte, 32)
+	max := big.NewInt(int64(len(passwordAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(fmt.Sprintf("databases: reading random bytes: %v", err))
+		}
+		b[i] = passwordAlphabet[n.Int64()]
+	}
+	return string(b)
+}
+
+// ImageRef returns the image for version, or the default tag
+func (e Engine) ImageRef(version string) string {
+	if version == "" {
+		version = e.Tag
+	}
+	return e.Image + ":" + version
+}
+
+// NewEnv returns the container env that initialises the database
+func (e Engine) NewEnv(user, password, database string) map[string]string {
+	return e.newEnv(user, password, database)
+}
+
+// Command returns the container command, or nil for the image default
+func (e Engine) Command(env map[string]string) []string {
+	if e.command == nil {
+		return nil
+	}
+	return e.command(env)
+}
+
+// Connection returns the connection details of a database container
+// reachable as host, reading the credentials back from its env
+func (e Engine) Connection(host string, env map[string]string) Connection {
+	user, password, database := e.creds(env)
+	u := url.URL{Scheme: e.scheme, Host: host + ":" + strconv.Itoa(e.Port), RawQuery: e.query}
+	switch {
+	case user != "":
+		u.User = url.UserPassword(user, password)
+	case password != "":
+		// Redis authenticates with a password only
+		u.User = url.UserPassword("", password)
+	}
+	if database != "" {
+		u.Path = "/" + database
+	}
+	return Connection{Engine: e.Name, Host: host, Port: e.Port, Database: database, Username: user, Password: password, URL: u.String()}
+}
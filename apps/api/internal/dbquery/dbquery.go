@@ -0,0 +1,340 @@
+// Package dbquery runs ad hoc SQL against PostgreSQL and MySQL databases for
+// the query console, with row limits, statement timeouts and read-only
+// transactions, and converts the results to JSON-friendly values.
+package dbquery
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gakwaya-panel/api/internal/databases"
+	"github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+)
+
+// ErrConnect wraps failures to reach or log in to the database
+var ErrConnect = errors.New("cannot connect to database")
+
+// Options bounds one query
+type Options struct {
+	MaxRows  int
+	Timeout  time.Duration
+	ReadOnly bool
+}
+
+// Column describes one result column; Type is the database type name
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Result is the outcome of one query
+type Result struct {
+	Columns      []Column `json:"columns"`
+	Rows         [][]any  `json:"rows"`
+	RowCount     int      `json:"row_count"`
+	Truncated    bool     `json:"truncated"`
+	RowsAffected *int64   `json:"rows_affected,omitempty"`
+	ReadOnly     bool     `json:"read_only"`
+	DurationMs   int64    `json:"duration_ms"`
+}
+
+// Supported reports whether the console can query an engine
+func Supported(engine string) bool {
+	return engine == "postgres" || engine == "mysql"
+}
+
+// dsn returns the driver name and data source for a connection
+func dsn(conn databases.Connection, timeout time.Duration) (string, string) {
+	addr := net.JoinHostPort(conn.Host, strconv.Itoa(conn.Port))
+	if conn.Engine == "mysql" {
+		cfg := mysql.NewConfig()
+		cfg.User, cfg.Passwd, cfg.DBName = conn.Username, conn.Password, conn.Database
+		cfg.Net, cfg.Addr = "tcp", addr
+		cfg.Timeout = 5 * time.Second
+		cfg.ReadTimeout = timeout + 5*time.Second
+		// Never let one call carry several statements
+		cfg.MultiStatements = false
+		return "mysql", cfg.FormatDSN()
+	}
+	u := url.URL{Scheme: "postgres", Host: addr, User: url.UserPassword(conn.Username, conn.Password), Path: "/" + conn.Database}
+	u.RawQuery = url.Values{"sslmode": {"disable"}, "connect_timeout": {"5"}}.Encode()
+	return "postgres", u.String()
+}
+
+// Run executes one statement. In read-only mode it runs in a read-only
+// transaction that is always rolled back; otherwise the transaction is
+// committed when the statement succeeds. At most MaxRows rows are returned.
+func Run(ctx context.Context, conn databases.Connection, query string, opts Options) (*Result, error) {
+	if !Supported(conn.Engine) {
+		return nil, fmt.Errorf("queries are not supported for engine %q", conn.Engine)
+	}
+	if countStatements(conn.Engine, query) > 1 {
+		return nil, ErrMultipleStatements
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	driver, source := dsn(conn, opts.Timeout)
+	db, err := sql.Open(driver, source)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrConnect, err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if err := db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrConnect, err)
+	}
+
+	// max_execution_time only bounds SELECT on MySQL; the context covers the rest
+	if conn.Engine == "mysql" {
+		if _, err := db.ExecContext(ctx, "SET SESSION max_execution_time = "+strconv.FormatInt(opts.Timeout.Milliseconds(), 10)); err != nil {
+			return nil, err
+		}
+	}
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if conn.Engine == "postgres" {
+		if opts.ReadOnly {
+			if _, err := tx.ExecContext(ctx, "SET TRANSACTION READ ONLY"); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "SET LOCAL statement_timeout = "+strconv.FormatInt(opts.Timeout.Milliseconds(), 10)); err != nil {
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	res := &Result{Columns: []Column{}, Rows: [][]any{}, ReadOnly: opts.ReadOnly}
+	st, err := prepare(ctx, tx, conn.Engine, query)
+	if err == nil {
+		defer st.Close()
+		if returnsRows(query) {
+			err = readRows(ctx, st, opts.MaxRows, res)
+		} else {
+			var r sql.Result
+			if r, err = st.exec(ctx); err == nil {
+				if n, err := r.RowsAffected(); err == nil {
+					res.RowsAffected = &n
+				}
+			}
+		}
+	}
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("query exceeded the %s timeout", opts.Timeout)
+		}
+		return nil, err
+	}
+	if !opts.ReadOnly {
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+	res.DurationMs = time.Since(start).Milliseconds()
+	return res, nil
+}
+
+// statement is a query bound to its transaction, prepared on Postgres
+type statement struct {
+	tx    *sql.Tx
+	stmt  *sql.Stmt
+	query string
+}
+
+// prepare readies query for tx. lib/pq sends queries without arguments over
+// the simple protocol, which runs every command in the string, so a second
+// statement could COMMIT its way out of a read-only transaction. A prepared
+// statement goes over the extended protocol, where the server rejects more
+// than one command.
+func prepare(ctx context.Context, tx *sql.Tx, engine, query string) (*statement, error) {
+	st := &statement{tx: tx, query: query}
+	if engine == "postgres" {
+		stmt, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		st.stmt = stmt
+	}
+	return st, nil
+}
+
+func (s *statement) rows(ctx context.Context) (*sql.Rows, error) {
+	if s.stmt != nil {
+		return s.stmt.QueryContext(ctx)
+	}
+	return s.tx.QueryContext(ctx, s.query)
+}
+
+func (s *statement) exec(ctx context.Context) (sql.Result, error) {
+	if s.stmt != nil {
+		return s.stmt.ExecContext(ctx)
+	}
+	return s.tx.ExecContext(ctx, s.query)
+}
+
+// Close releases the prepared statement, if any
+func (s *statement) Close() error {
+	if s.stmt != nil {
+		return s.stmt.Close()
+	}
+	return nil
+}
+
+// readRows reads up to max rows of a statement into res
+func readRows(ctx context.Context, st *statement, max int, res *Result) error {
+	rows, err := st.rows(ctx)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	for _, t := range types {
+		res.Columns = append(res.Columns, Column{Name: t.Name(), Type: strings.ToLower(t.DatabaseTypeName())})
+	}
+	for rows.Next() {
+		if len(res.Rows) == max {
+			res.Truncated = true
+			break
+		}
+		values := make([]any, len(types))
+		ptrs := make([]any, len(types))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		for i, v := range values {
+			values[i] = convert(res.Columns[i].Type, v)
+		}
+		res.Rows = append(res.Rows, values)
+	}
+	res.RowCount = len(res.Rows)
+	if res.Truncated {
+		return nil
+	}
+	return rows.Err()
+}
+
+// rowKeywords start statements that return rows
+var rowKeywords = map[string]bool{
+	"select": true, "with": true, "show": true, "explain": true, "describe": true,
+	"desc": true, "values": true, "table": true, "pragma": true,
+}
+
+// returnsRows guesses from the first keyword (or a RETURNING clause) whether
+// a statement produces a result set
+func returnsRows(query string) bool {
+	q := strings.ToLower(stripComments(query))
+	q = strings.TrimLeft(q, " \t\r\n(")
+	end := strings.IndexFunc(q, func(r rune) bool { return !unicode.IsLetter(r) })
+	if end < 0 {
+		end = len(q)
+	}
+	if rowKeywords[q[:end]] {
+		return true
+	}
+	for _, word := range strings.FieldsFunc(q, func(r rune) bool { return !unicode.IsLetter(r) && r != '_' }) {
+		if word == "returning" {
+			return true
+		}
+	}
+	return false
+}
+
+// stripComments drops leading -- and /* */ comments
+func stripComments(q string) string {
+	for {
+		q = strings.TrimSpace(q)
+		switch {
+		case strings.HasPrefix(q, "--") || strings.HasPrefix(q, "#"):
+			i := strings.IndexByte(q, '\n')
+			if i < 0 {
+				return ""
+			}
+			q = q[i+1:]
+		case strings.HasPrefix(q, "/*"):
+			i := strings.Index(q, "*/")
+			if i < 0 {
+				return ""
+			}
+			q = q[i+2:]
+		default:
+			return q
+		}
+	}
+}
+
+var (
+	intTypes = map[string]bool{
+		"int": true, "int2": true, "int4": true, "int8": true, "integer": true, "smallint": true,
+		"bigint": true, "tinyint": true, "mediumint": true, "year": true, "oid": true,
+		"unsigned int": true, "unsigned bigint": true, "unsigned tinyint": true,
+		"unsigned smallint": true, "unsigned mediumint": true,
+	}
+	floatTypes  = map[string]bool{"float": true, "float4": true, "float8": true, "double": true, "real": true}
+	binaryTypes = map[string]bool{
+		"bytea": true, "blob": true, "tinyblob": true, "mediumblob": true, "longblob": true,
+		"binary": true, "varbinary": true, "bit": true, "geometry": true,
+	}
+)
+
+// convert turns a scanned value into its JSON form: integers and floats as
+// numbers, JSON columns inline, binary data as base64 and the rest as
+// strings. Decimals stay strings so no precision is lost.
+func convert(typ string, v any) any {
+	switch x := v.(type) {
+	case []byte:
+		s := string(x)
+		switch {
+		case intTypes[typ]:
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return n
+			}
+			if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+				return n
+			}
+		case floatTypes[typ]:
+			if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+				return f
+			}
+		case typ == "json" || typ == "jsonb":
+			if json.Valid(x) {
+				return json.RawMessage(s)
+			}
+		case binaryTypes[typ]:
+			return base64.StdEncoding.EncodeToString(x)
+		}
+		if utf8.Valid(x) {
+			return s
+		}
+		return base64.StdEncoding.EncodeToString(x)
+	case float64:
+		if math.IsInf(x, 0) || math.IsNaN(x) {
+			return strconv.FormatFloat(x, 'g', -1, 64)
+		}
+	case float32:
+		return convert(typ, float64(x))
+	}
+	return v
+}
@@ -0,0 +1,75 @@
+package dbquery
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestReturnsRows(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT 1", true},
+		{"  select * from t", true},
+		{"(SELECT 1) UNION (SELECT 2)", true},
+		{"WITH x AS (SELECT 1) SELECT * FROM x", true},
+		{"SHOW TABLES", true},
+		{"EXPLAIN ANALYZE SELECT 1", true},
+		{"DESC users", true},
+		{"VALUES (1), (2)", true},
+		{"TABLE users", true},
+		{"-- list\nSELECT 1", true},
+		{"/* a */ /* b */ SELECT 1", true},
+		{"# mysql comment\nSHOW DATABASES", true},
+		{"INSERT INTO t VALUES (1) RETURNING id", true},
+		{"UPDATE t SET a = 1 WHERE id = 2\nRETURNING *", true},
+		{"INSERT INTO t VALUES (1)", false},
+		{"UPDATE t SET returning_count = 1", false},
+		{"DELETE FROM t", false},
+		{"CREATE TABLE selected (id int)", false},
+		{"SELECTED", false},
+		{"-- only a comment", false},
+		{"/* unterminated SELECT", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := returnsRows(tt.query); got != tt.want {
+			t.Errorf("returnsRows(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		typ  string
+		in   any
+		want any
+	}{
+		{"int4", []byte("42"), int64(42)},
+		{"bigint", []byte("-7"), int64(-7)},
+		{"unsigned bigint", []byte("18446744073709551615"), uint64(math.MaxUint64)},
+		{"int", []byte("not a number"), "not a number"},
+		{"float8", []byte("1.5"), 1.5},
+		{"double", []byte("NaN"), "NaN"},
+		{"numeric", []byte("12345678901234567890.123"), "12345678901234567890.123"},
+		{"jsonb", []byte(`{"a":1}`), json.RawMessage(`{"a":1}`)},
+		{"json", []byte(`{broken`), "{broken"},
+		{"bytea", []byte("hi"), "aGk="},
+		{"text", []byte("héllo"), "héllo"},
+		{"text", []byte{0xff, 0xfe}, "//4="},
+		{"float8", math.Inf(1), "+Inf"},
+		{"float8", math.NaN(), "NaN"},
+		{"float4", float32(0.5), 0.5},
+		{"int8", int64(3), int64(3)},
+		{"bool", true, true},
+		{"text", nil, nil},
+	}
+	for _, tt := range tests {
+		if got := convert(tt.typ, tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("convert(%q, %#v) = %#v, want %#v", tt.typ, tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package dbquery
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrMultipleStatements rejects input holding more than one statement; a
+// second statement could COMMIT its way out of the read-only transaction
+var ErrMultipleStatements = errors.New("run one statement at a time")
+
+// countStatements counts the statements of query, ignoring semicolons
+// inside comments, string literals, quoted identifiers and Postgres dollar
+// quotes. An unterminated literal or comment runs to the end of the input.
+// It only gives an early, clear error: the engines themselves refuse a
+// second statement, MySQL because multi-statements are off and Postgres
+// because the query is prepared.
+func countStatements(engine, query string) int {
+	mysql := engine == "mysql"
+	count := 0
+	content := false // the current statement has more than whitespace and comments
+	for i := 0; i < len(query); {
+		ch := query[i]
+		switch {
+		case ch == ';':
+			if content {
+				count++
+			}
+			content = false
+			i++
+		case ch == '-' && strings.HasPrefix(query[i:], "--"), mysql && ch == '#':
+			i = skipPast(query, i, "\n")
+		case ch == '/' && strings.HasPrefix(query[i:], "/*"):
+			i = skipPast(query, i+2, "*/")
+		case ch == '\'' || ch == '"' || (mysql && ch == '`'):
+			i = skipQuoted(query, i, ch, mysql && ch != '`' || !mysql && escapeString(query, i))
+			content = true
+		case !mysql && ch == '$':
+			if tag, ok := dollarTag(query[i:]); ok {
+				i = skipPast(query, i+len(tag), tag)
+			} else {
+				i++
+			}
+			content = true
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n':
+			i++
+		default:
+			content = true
+			i++
+		}
+	}
+	if content {
+		count++
+	}
+	return count
+}
+
+// skipPast returns the index after the next end at or after i, or the end
+// of the input
+func skipPast(q string, i int, end string) int {
+	j := strings.Index(q[i:], end)
+	if j < 0 {
+		return len(q)
+	}
+	return i + j + len(end)
+}
+
+// skipQuoted returns the index after the literal opened by quote at i. A
+// doubled quote stays inside; so does an escaped one when backslashes escape.
+func skipQuoted(q string, i int, quote byte, backslash bool) int {
+	for i++; i < len(q); i++ {
+		switch q[i] {
+		case '\\':
+			if backslash {
+				i++
+			}
+		case quote:
+			if i+1 < len(q) && q[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(q)
+}
+
+// escapeString reports whether the quote at i opens a Postgres E'...'
+// string, where backslashes escape
+func escapeString(q string, i int) bool {
+	if q[i] != '\'' || i == 0 || (q[i-1] != 'E' && q[i-1] != 'e') {
+		return false
+	}
+	if i == 1 {
+		return true
+	}
+	c := q[i-2]
+	return !(c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80)
+}
+
+// dollarTag reads a Postgres dollar-quote opener such as $$ or $body$
+func dollarTag(q string) (string, bool) {
+	for j := 1; j < len(q); j++ {
+		c := q[j]
+		switch {
+		case c == '$':
+			return q[:j+1], true
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80 || (j > 1 && c >= '0' && c <= '9'):
+		default:
+			return "", false
+		}
+	}
+	return "", false
+}
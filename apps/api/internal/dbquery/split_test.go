@@ -0,0 +1,42 @@
+package dbquery
+
+import "testing"
+
+func TestCountStatements(t *testing.T) {
+	tests := []struct {
+		engine, query string
+		want          int
+	}{
+		{"postgres", "SELECT 1", 1},
+		{"postgres", "SELECT 1;", 1},
+		{"postgres", "  ;; SELECT 1 ;  ", 1},
+		{"postgres", "", 0},
+		{"postgres", "-- only a comment", 0},
+		{"postgres", "COMMIT; DROP TABLE users", 2},
+		{"postgres", "SELECT 1; -- trailing comment", 1},
+		{"postgres", "SELECT ';' AS s", 1},
+		{"postgres", "SELECT 'it''s; fine'", 1},
+		{"postgres", `SELECT 1 AS "a;b"`, 1},
+		{"postgres", "SELECT 1 /* ; */", 1},
+		{"postgres", "SELECT 1 -- ;\n", 1},
+		{"postgres", "SELECT $$a; b$$", 1},
+		{"postgres", "SELECT $fn$ ; $fn$; DROP TABLE x", 2},
+		{"postgres", "SELECT $1", 1},
+		{"postgres", "SELECT 'unterminated; DROP TABLE x", 1},
+		{"postgres", "SELECT 1 /* unterminated; DROP", 1},
+		{"postgres", `SELECT E'\''; COMMIT; DROP TABLE users`, 3},
+		{"postgres", `SELECT e'a\\'; DROP TABLE x`, 2},
+		{"postgres", `SELECT 'a\'; DROP TABLE x`, 2},
+		{"postgres", `SELECT name'\'; DROP TABLE x`, 2},
+		{"mysql", "SELECT 1; DELETE FROM t", 2},
+		{"mysql", `SELECT 'a\'; b'`, 1},
+		{"mysql", "SELECT `we;ird` FROM t", 1},
+		{"mysql", "SELECT 1 # ;\n", 1},
+		{"mysql", "SELECT 1 # c\n; DROP TABLE t", 2},
+	}
+	for _, tt := range tests {
+		if got := countStatements(tt.engine, tt.query); got != tt.want {
+			t.Errorf("countStatements(%s, %q) = %d, want %d", tt.engine, tt.query, got, tt.want)
+		}
+	}
+}
@@ -2,14 +2,78 @@ package dockerutil
 
 import (
 	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
+	"github.com/gakwaya-panel/api/internal/prom"
 )
 
+var (
+	httpClientOnce sync.Once
+	httpClient     *http.Client
+)
+
+// sharedHTTPClient returns an HTTP client for the Docker host from the
+// environment that counts requests and errors. All clients share its
+// connection pool. TLS hosts keep the stock transport, because hijacked
+// connections (attach, exec) only find the TLS config on an *http.Transport.
+func sharedHTTPClient() *http.Client {
+	httpClientOnce.Do(func() {
+		base, err := client.NewClientWithOpts(client.FromEnv)
+		if err != nil {
+			return
+		}
+		hc := base.HTTPClient()
+		if tr, ok := hc.Transport.(*http.Transport); ok && tr.TLSClientConfig != nil {
+			return
+		}
+		hc.Transport = countingTransport{hc.Transport}
+		httpClient = hc
+	})
+	return httpClient
+}
+
+// countingTransport records Docker API requests and failures
+type countingTransport struct {
+	next http.RoundTripper
+}
+
+func (t countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resource := apiResource(req.URL.Path)
+	prom.DockerRequests.Inc(resource)
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		prom.DockerErrors.Inc(resource, "error")
+	} else if resp.StatusCode >= 400 {
+		prom.DockerErrors.Inc(resource, strconv.Itoa(resp.StatusCode))
+	}
+	return resp, err
+}
+
+// apiResource returns the first path segment after the API version, e.g.
+// "containers" for /v1.43/containers/abc/json
+func apiResource(path string) string {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) > 1 && strings.HasPrefix(parts[0], "v1.") {
+		parts = parts[1:]
+	}
+	if parts[0] == "" {
+		return "other"
+	}
+	return parts[0]
+}
+
 // NewClient returns a Docker client
 func NewClient() (*client.Client, error) {
-	return client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+	if hc := sharedHTTPClient(); hc != nil {
+		opts = append(opts, client.WithHTTPClient(hc))
+	}
+	return client.NewClientWithOpts(opts...)
 }
 
 // PingDocker pings the Docker daemon to check connectivity
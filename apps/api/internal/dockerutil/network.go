@@ -0,0 +1,79 @@
+package dockerutil
+
+import (
+	"context"
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// PanelNetwork returns the bridge network shared by the panel and the
+// applications it routes to (PANEL_NETWORK, default "gakwayapanel")
+func PanelNetwork() string {
+	if name := os.Getenv("PANEL_NETWORK"); name != "" {
+		return name
+	}
+	return "gakwayapanel"
+}
+
+// EnsureNetwork creates a bridge network unless one with that name exists
+func EnsureNetwork(ctx context.Context, cli *client.Client, name string, labels map[string]string) error {
+	_, err := cli.NetworkInspect(ctx, name, types.NetworkInspectOptions{})
+	if err == nil {
+		return nil
+	}
+	if !client.IsErrNotFound(err) {
+		return err
+	}
+	_, err = cli.NetworkCreate(ctx, name, types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         "bridge",
+		Labels:         labels,
+	})
+	return err
+}
+
+// ProjectNetwork returns the private network shared by a project's applications
+func ProjectNetwork(project string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(project) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('-')
+		}
+	}
+	return PanelNetwork() + "-project-" + b.String()
+}
+
+// ValidNetworkName reports whether name is usable as a Docker network name
+func ValidNetworkName(name string) bool {
+	return networkNamePattern.MatchString(name)
+}
+
+var networkNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// ContainerIP returns the IP of a running container, preferring the panel network
+func ContainerIP(ctx context.Context, cli *client.Client, containerID string) (string, error) {
+	info, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return "", err
+	}
+	if info.State == nil || !info.State.Running {
+		return "", errors.New("container is not running")
+	}
+	if ep, ok := info.NetworkSettings.Networks[PanelNetwork()]; ok && ep.IPAddress != "" {
+		return ep.IPAddress, nil
+	}
+	for _, ep := range info.NetworkSettings.Networks {
+		if ep.IPAddress != "" {
+			return ep.IPAddress, nil
+		}
+	}
+	return "", errors.New("container has no IP address")
+}
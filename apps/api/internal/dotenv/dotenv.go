@@ -0,0 +1,369 @@
+// Package dotenv parses and writes .env files.
+//
+// Supported syntax:
+//
+//	# comment
+//	export KEY=value          # "export " is optional, trailing comments allowed
+//	KEY="line 1\nline 2"      # escapes and ${VAR} interpolation
+//	KEY="spans
+//	several lines"
+//	KEY='literal $NOT_EXPANDED'  # single quotes: no escapes, no interpolation
+//	URL=postgres://${DB_USER}:${DB_PASS:-secret}@db/app
+package dotenv
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Lookup resolves a variable not defined earlier in the file
+type Lookup func(name string) (string, bool)
+
+// Result is a parsed dotenv file
+type Result struct {
+	Env map[string]string
+	// Keys lists the variables in the order they first appear
+	Keys []string
+	// Unresolved lists referenced variables that had no value and no
+	// default where they were used, so they expanded to an empty string
+	// (including ones only defined further down the file)
+	Unresolved []string
+	// Refs maps each variable to the names resolved through lookup that its
+	// value was built from, directly or through variables defined earlier
+	Refs map[string][]string
+}
+
+// SyntaxError reports the line of a malformed file
+type SyntaxError struct {
+	Line int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// ValidKey reports whether name is a valid variable name
+func ValidKey(name string) bool {
+	return keyPattern.MatchString(name)
+}
+
+// Parse reads a dotenv file. ${VAR} and $VAR references resolve to
+// variables defined earlier in the file and then to lookup, which may be nil.
+func Parse(data string, lookup Lookup) (*Result, error) {
+	p := &parser{src: strings.ReplaceAll(data, "\r\n", "\n"), line: 1, lookup: lookup}
+	res := &Result{Env: map[string]string{}, Refs: map[string][]string{}}
+	p.res = res
+	unresolved := map[string]bool{}
+	p.unresolved = unresolved
+	for {
+		p.skipBlank()
+		if p.eof() {
+			break
+		}
+		p.refs = nil
+		key, value, err := p.entry()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := res.Env[key]; !ok {
+			res.Keys = append(res.Keys, key)
+		}
+		res.Env[key] = value
+		if p.refs != nil {
+			res.Refs[key] = p.refs
+		} else {
+			delete(res.Refs, key)
+		}
+	}
+	for name := range unresolved {
+		res.Unresolved = append(res.Unresolved, name)
+	}
+	sort.Strings(res.Unresolved)
+	return res, nil
+}
+
+type parser struct {
+	src        string
+	pos        int
+	line       int
+	lookup     Lookup
+	res        *Result
+	unresolved map[string]bool
+	refs       []string // lookup names used by the current entry
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *parser) peek() byte { return p.src[p.pos] }
+
+func (p *parser) next() byte {
+	c := p.src[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Line: p.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// skipBlank skips whitespace, empty lines and comment lines
+func (p *parser) skipBlank() {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\n':
+			p.next()
+		case c == '#':
+			p.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) skipLine() {
+	for !p.eof() && p.peek() != '\n' {
+		p.next()
+	}
+}
+
+// skipSpaces skips spaces and tabs on the current line
+func (p *parser) skipSpaces() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.next()
+	}
+}
+
+// entry parses one KEY=VALUE assignment
+func (p *parser) entry() (string, string, error) {
+	start := p.pos
+	for !p.eof() && p.peek() != '=' && p.peek() != '\n' {
+		p.next()
+	}
+	key := strings.TrimSpace(p.src[start:p.pos])
+	if strings.HasPrefix(key, "export ") || strings.HasPrefix(key, "export\t") {
+		key = strings.TrimSpace(key[len("export"):])
+	}
+	if p.eof() || p.peek() != '=' {
+		return "", "", p.errorf("expected KEY=VALUE")
+	}
+	if !ValidKey(key) {
+		return "", "", p.errorf("invalid variable name %q", key)
+	}
+	p.next() // '='
+	p.skipSpaces()
+
+	var value string
+	var err error
+	switch {
+	case p.eof() || p.peek() == '\n':
+		value = ""
+	case p.peek() == '\'':
+		value, err = p.singleQuoted()
+	case p.peek() == '"':
+		value, err = p.doubleQuoted()
+	default:
+		value = p.unquoted()
+	}
+	if err != nil {
+		return "", "", err
+	}
+	// Only spaces or a comment may follow a value
+	p.skipSpaces()
+	if !p.eof() && p.peek() != '\n' {
+		if p.peek() != '#' {
+			return "", "", p.errorf("unexpected characters after value of %s", key)
+		}
+		p.skipLine()
+	}
+	return key, value, nil
+}
+
+func (p *parser) singleQuoted() (string, error) {
+	startLine := p.line
+	p.next() // opening quote
+	start := p.pos
+	for !p.eof() && p.peek() != '\'' {
+		p.next()
+	}
+	if p.eof() {
+		return "", &SyntaxError{Line: startLine, Msg: "unterminated single-quoted value"}
+	}
+	value := p.src[start:p.pos]
+	p.next() // closing quote
+	return value, nil
+}
+
+func (p *parser) doubleQuoted() (string, error) {
+	startLine := p.line
+	p.next() // opening quote
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", &SyntaxError{Line: startLine, Msg: "unterminated double-quoted value"}
+		}
+		c := p.next()
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if p.eof() {
+				continue
+			}
+			switch e := p.next(); e {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\', '$':
+				b.WriteByte(e)
+			case '\n':
+				// Line continuation
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			}
+		case '$':
+			b.WriteString(p.reference())
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// unquoted reads a bare value up to the end of the line or an inline comment
+func (p *parser) unquoted() string {
+	var b strings.Builder
+	prev := byte(0)
+	for !p.eof() && p.peek() != '\n' {
+		c := p.peek()
+		if c == '#' && (prev == ' ' || prev == '\t') {
+			break
+		}
+		prev = c
+		p.next()
+		if c == '$' {
+			b.WriteString(p.reference())
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return strings.TrimRight(b.String(), " \t")
+}
+
+// reference expands the variable reference after a '$': ${NAME},
+// ${NAME:-default}, ${NAME-default} or $NAME. A lone '$', or a '${' not
+// closed on the same line, is kept as is.
+func (p *parser) reference() string {
+	if p.eof() {
+		return "$"
+	}
+	if p.peek() != '{' {
+		start := p.pos
+		for !p.eof() && isNameChar(p.peek(), p.pos == start) {
+			p.next()
+		}
+		if p.pos == start {
+			return "$"
+		}
+		name := p.src[start:p.pos]
+		v, ok := p.resolve(name)
+		if !ok {
+			p.unresolved[name] = true
+		}
+		return v
+	}
+	rest := p.src[p.pos:]
+	if eol := strings.IndexByte(rest, '\n'); eol >= 0 {
+		rest = rest[:eol]
+	}
+	end := strings.IndexByte(rest, '}')
+	if end < 0 {
+		return "$"
+	}
+	expr := p.src[p.pos+1 : p.pos+end]
+	for closing := p.pos + end; p.pos < closing; {
+		p.next()
+	}
+	p.next() // '}'
+
+	name, def, hasDefault, emptyIsUnset := expr, "", false, false
+	if i := strings.Index(expr, ":-"); i >= 0 {
+		name, def, hasDefault, emptyIsUnset = expr[:i], expr[i+2:], true, true
+	} else if i := strings.IndexByte(expr, '-'); i >= 0 {
+		name, def, hasDefault = expr[:i], expr[i+1:], true
+	}
+	v, ok := p.resolve(name)
+	if hasDefault && (!ok || (emptyIsUnset && v == "")) {
+		return def
+	}
+	if !ok {
+		p.unresolved[name] = true
+	}
+	return v
+}
+
+func isNameChar(c byte, first bool) bool {
+	if c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') {
+		return true
+	}
+	return !first && c >= '0' && c <= '9'
+}
+
+// resolve looks a variable up in the file so far, then in lookup
+func (p *parser) resolve(name string) (string, bool) {
+	if v, ok := p.res.Env[name]; ok {
+		p.refs = append(p.refs, p.res.Refs[name]...)
+		return v, true
+	}
+	if p.lookup != nil {
+		if v, ok := p.lookup(name); ok {
+			p.refs = append(p.refs, name)
+			return v, true
+		}
+	}
+	return "", false
+}
+
+var bareValue = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]*$`)
+
+// Format writes env as a dotenv file with sorted keys. Values that need it
+// are double-quoted with escapes, and "$" is escaped so that reading the
+// file back does not interpolate. Keys in redact are written as mask.
+func Format(env map[string]string, redact map[string]bool, mask string) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		v := env[k]
+		if redact[k] {
+			v = mask
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(Quote(v))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Quote returns v as a dotenv value, quoting only when needed
+func Quote(v string) string {
+	if bareValue.MatchString(v) {
+		return v
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "$", `\$`)
+	return `"` + r.Replace(v) + `"`
+}
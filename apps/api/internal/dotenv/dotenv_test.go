@@ -0,0 +1,121 @@
+package dotenv
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		v, ok := map[string]string{"HOST": "db", "EMPTY": ""}[name]
+		return v, ok
+	}
+	tests := []struct {
+		name       string
+		data       string
+		env        map[string]string
+		unresolved []string
+	}{
+		{"bare", "A=1\nB = two words ", map[string]string{"A": "1", "B": "two words"}, nil},
+		{"export and comments", "# comment\nexport A=1 # trailing\n\nB=a#b", map[string]string{"A": "1", "B": "a#b"}, nil},
+		{"empty value", "A=\nB=", map[string]string{"A": "", "B": ""}, nil},
+		{"crlf", "A=1\r\nB=2\r\n", map[string]string{"A": "1", "B": "2"}, nil},
+		{"single quotes are literal", `A='$HOST \n "x"'`, map[string]string{"A": `$HOST \n "x"`}, nil},
+		{"double quote escapes", `A="a\nb\tc\"d\\e\$f\q"`, map[string]string{"A": "a\nb\tc\"d\\e$f\\q"}, nil},
+		{"multi-line double quotes", "A=\"line 1\nline 2\"\nB=2", map[string]string{"A": "line 1\nline 2", "B": "2"}, nil},
+		{"line continuation", "A=\"a\\\nb\"", map[string]string{"A": "ab"}, nil},
+		{"earlier variable", "A=x\nB=${A}-$A", map[string]string{"A": "x", "B": "x-x"}, nil},
+		{"lookup", "URL=postgres://${HOST}/app", map[string]string{"URL": "postgres://db/app"}, nil},
+		{"file wins over lookup", "HOST=local\nURL=$HOST", map[string]string{"HOST": "local", "URL": "local"}, nil},
+		{"defaults", "A=${MISSING:-d}\nB=${EMPTY:-d}\nC=${EMPTY-d}\nD=${MISSING-d}", map[string]string{"A": "d", "B": "d", "C": "", "D": "d"}, nil},
+		{"unresolved", "A=$MISSING\nB=${OTHER}", map[string]string{"A": "", "B": ""}, []string{"MISSING", "OTHER"}},
+		{"defined later", "A=$B\nB=1", map[string]string{"A": "", "B": "1"}, []string{"B"}},
+		{"default keeps earlier unresolved", "A=$X\nB=${X:-d}", map[string]string{"A": "", "B": "d"}, []string{"X"}},
+		{"unclosed brace stops at end of line", "A=${X\nB=}", map[string]string{"A": "${X", "B": "}"}, nil},
+		{"lone dollar", "A=5$\nB=\"$ 1\"", map[string]string{"A": "5$", "B": "$ 1"}, nil},
+		{"redefined", "A=1\nA=2", map[string]string{"A": "2"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Parse(tt.data, lookup)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(res.Env, tt.env) {
+				t.Errorf("Env = %q, want %q", res.Env, tt.env)
+			}
+			if !reflect.DeepEqual(res.Unresolved, tt.unresolved) {
+				t.Errorf("Unresolved = %q, want %q", res.Unresolved, tt.unresolved)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		line int
+	}{
+		{"no equals", "A=1\nJUSTAKEY", 2},
+		{"invalid name", "1A=x", 1},
+		{"name with space", "MY KEY=x", 1},
+		{"unterminated double quote", "A=1\nB=\"open\nC=3", 2},
+		{"unterminated single quote", "A='open", 1},
+		{"text after quotes", `A="x" y`, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.data, nil)
+			var syntax *SyntaxError
+			if !errors.As(err, &syntax) {
+				t.Fatalf("Parse error = %v, want a SyntaxError", err)
+			}
+			if syntax.Line != tt.line {
+				t.Errorf("error on line %d, want %d", syntax.Line, tt.line)
+			}
+		})
+	}
+}
+
+func TestParseKeysAndRefs(t *testing.T) {
+	lookup := func(name string) (string, bool) { return "s3cret", name == "DB_PASSWORD" }
+	res, err := Parse("B=1\nPASS=$DB_PASSWORD\nA=${PASS}@host\nB=2\nC=plain", lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"B", "PASS", "A", "C"}; !reflect.DeepEqual(res.Keys, want) {
+		t.Errorf("Keys = %q, want %q", res.Keys, want)
+	}
+	want := map[string][]string{"PASS": {"DB_PASSWORD"}, "A": {"DB_PASSWORD"}}
+	if !reflect.DeepEqual(res.Refs, want) {
+		t.Errorf("Refs = %q, want %q", res.Refs, want)
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	env := map[string]string{
+		"PLAIN":   "postgres://u@db:5432/app",
+		"SPACES":  "two words",
+		"QUOTES":  `say "hi" \o/`,
+		"LINES":   "a\nb\r\n\tc",
+		"DOLLAR":  "$HOME and ${PATH}",
+		"HASH":    "a #b",
+		"EMPTY":   "",
+		"SECRETS": "hidden",
+	}
+	out := Format(env, map[string]bool{"SECRETS": true}, "********")
+	res, err := Parse(out, nil)
+	if err != nil {
+		t.Fatalf("Parse(Format()): %v\n%s", err, out)
+	}
+	want := map[string]string{}
+	for k, v := range env {
+		want[k] = v
+	}
+	want["SECRETS"] = "********"
+	if !reflect.DeepEqual(res.Env, want) {
+		t.Errorf("round trip = %q, want %q", res.Env, want)
+	}
+}
@@ -0,0 +1,466 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/alerts"
+	"github.com/gakwaya-panel/api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// AlertRuleRequest is the request body for creating or updating an alert rule
+type AlertRuleRequest struct {
+	Name          string  `json:"name" binding:"required,max=100"`
+	Type          string  `json:"type" binding:"required"`
+	ApplicationID int64   `json:"application_id"`
+	Threshold     float64 `json:"threshold"`
+	ForMinutes    int     `json:"for_minutes"`
+	Path          string  `json:"path"`
+	Channels      []int64 `json:"channels"`
+	RepeatMinutes int     `json:"repeat_minutes"`
+	Enabled       *bool   `json:"enabled"`
+}
+
+// AlertChannelRequest is the request body for creating or updating a
+// notification channel; an empty URL keeps the stored one on update
+type AlertChannelRequest struct {
+	Name    string   `json:"name" binding:"required,max=100"`
+	Type    string   `json:"type" binding:"required"`
+	URL     string   `json:"url"`
+	To      []string `json:"to"`
+	Enabled *bool    `json:"enabled"`
+}
+
+// AlertSilenceRequest mutes notifications for DurationMinutes or until EndsAt
+type AlertSilenceRequest struct {
+	RuleID          int64      `json:"rule_id"`
+	ApplicationID   int64      `json:"application_id"`
+	DurationMinutes int        `json:"duration_minutes"`
+	EndsAt          *time.Time `json:"ends_at"`
+	Reason          string     `json:"reason"`
+}
+
+// pathID parses the :id path parameter, answering the request on failure
+func pathID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// validateAlertRule checks a rule against its type and fills the defaults
+func validateAlertRule(db *sql.DB, r *models.AlertRule) error {
+	if !alerts.ValidType(r.Type) {
+		return fmt.Errorf("unknown rule type %q", r.Type)
+	}
+	if alerts.PanelWide(r.Type) && r.ApplicationID != 0 {
+		return fmt.Errorf("%s rules watch the panel host and take no application_id", r.Type)
+	}
+	if r.ApplicationID != 0 {
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM applications WHERE id = ?", r.ApplicationID).Scan(&n); err != nil {
+			return err
+		} else if n == 0 {
+			return errors.New("application not found")
+		}
+	}
+	if r.Threshold < 0 || r.ForMinutes < 0 || r.ForMinutes > 24*60 || r.RepeatMinutes < 0 {
+		return errors.New("threshold, for_minutes (at most 1440) and repeat_minutes must not be negative")
+	}
+	alerts.Defaults(r)
+	switch r.Type {
+	case alerts.RuleMemoryHigh, alerts.RuleDiskUsage:
+		if r.Threshold > 100 {
+			return errors.New("threshold is a percentage between 0 and 100")
+		}
+	case alerts.RuleCrashLoop:
+		if r.Threshold < 1 {
+			return errors.New("threshold is the number of deaths and must be at least 1")
+		}
+	}
+	if r.Type == alerts.RuleDiskUsage && !filepath.IsAbs(r.Path) {
+		return errors.New("path must be absolute")
+	}
+	if r.Type != alerts.RuleDiskUsage {
+		r.Path = ""
+	}
+	for _, id := range r.Channels {
+		if _, err := alerts.GetChannel(db, id); err == sql.ErrNoRows {
+			return fmt.Errorf("channel %d not found", id)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListAlertRules returns every alert rule
+func ListAlertRules(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules, err := alerts.Rules(db)
+		if err != nil {
+			log.Println("Error listing alert rules:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		c.JSON(http.StatusOK, rules)
+	}
+}
+
+// CreateAlertRule creates an alert rule
+func CreateAlertRule(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		saveAlertRule(c, db, 0)
+	}
+}
+
+// UpdateAlertRule replaces an alert rule
+func UpdateAlertRule(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := pathID(c)
+		if !ok {
+			return
+		}
+		if _, err := alerts.GetRule(db, id); err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+			return
+		} else if err != nil {
+			log.Println("Error getting alert rule:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		saveAlertRule(c, db, id)
+	}
+}
+
+func saveAlertRule(c *gin.Context, db *sql.DB, id int64) {
+	var req AlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule := models.AlertRule{
+		ID: id, Name: req.Name, Type: req.Type, ApplicationID: req.ApplicationID,
+		Threshold: req.Threshold, ForMinutes: req.ForMinutes, Path: req.Path,
+		Channels: req.Channels, RepeatMinutes: req.RepeatMinutes, Enabled: req.Enabled == nil || *req.Enabled,
+	}
+	if err := validateAlertRule(db, &rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, err := alerts.SaveRule(db, rule)
+	if err != nil {
+		log.Println("Error saving alert rule:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+		return
+	}
+	rule, err = alerts.GetRule(db, id)
+	if err != nil {
+		log.Println("Error getting alert rule:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+		return
+	}
+	status := http.StatusOK
+	if c.Request.Method == http.MethodPost {
+		status = http.StatusCreated
+	}
+	c.JSON(status, rule)
+}
+
+// DeleteAlertRule deletes an alert rule and resolves its open alerts
+func DeleteAlertRule(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := pathID(c)
+		if !ok {
+			return
+		}
+		found, err := alerts.DeleteRule(db, id)
+		if err != nil {
+			log.Println("Error deleting alert rule:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Alert rule deleted"})
+	}
+}
+
+// maskChannel hides the path and query of webhook URLs, which carry the token
+func maskChannel(ch models.AlertChannel) models.AlertChannel {
+	if u, err := url.Parse(ch.URL); err == nil && u.Host != "" {
+		ch.URL = u.Scheme + "://" + u.Host + "/" + secretMask
+	}
+	return ch
+}
+
+// ListAlertChannels returns every notification channel with URLs masked
+func ListAlertChannels(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		channels, err := alerts.Channels(db)
+		if err != nil {
+			log.Println("Error listing alert channels:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		for i := range channels {
+			channels[i] = maskChannel(channels[i])
+		}
+		c.JSON(http.StatusOK, channels)
+	}
+}
+
+// CreateAlertChannel creates a notification channel
+func CreateAlertChannel(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		saveAlertChannel(c, db, models.AlertChannel{})
+	}
+}
+
+// UpdateAlertChannel replaces a notification channel
+func UpdateAlertChannel(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ch, ok := loadAlertChannel(c, db)
+		if !ok {
+			return
+		}
+		saveAlertChannel(c, db, ch)
+	}
+}
+
+// loadAlertChannel reads the channel named by the :id path parameter, answering the request on failure
+func loadAlertChannel(c *gin.Context, db *sql.DB) (models.AlertChannel, bool) {
+	id, ok := pathID(c)
+	if !ok {
+		return models.AlertChannel{}, false
+	}
+	ch, err := alerts.GetChannel(db, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert channel not found"})
+		return ch, false
+	} else if err != nil {
+		log.Println("Error getting alert channel:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+		return ch, false
+	}
+	return ch, true
+}
+
+func saveAlertChannel(c *gin.Context, db *sql.DB, existing models.AlertChannel) {
+	var req AlertChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !alerts.ValidChannelType(req.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be webhook, slack, discord or email"})
+		return
+	}
+	ch := models.AlertChannel{ID: existing.ID, Name: req.Name, Type: req.Type, Enabled: req.Enabled == nil || *req.Enabled}
+	if req.Type == alerts.ChannelEmail {
+		if len(req.To) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "email channels need at least one address in to"})
+			return
+		}
+		for _, addr := range req.To {
+			parsed, err := mail.ParseAddress(addr)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid address %q", addr)})
+				return
+			}
+			ch.To = append(ch.To, parsed.Address)
+		}
+	} else {
+		ch.URL = req.URL
+		if ch.URL == "" && existing.Type == req.Type {
+			ch.URL = existing.URL
+		}
+		u, err := url.Parse(ch.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "url must be an http or https URL"})
+			return
+		}
+	}
+	id, err := alerts.SaveChannel(db, ch)
+	if err != nil {
+		log.Println("Error saving alert channel:", err)
+		c.JSON(http.StatusConflict, gin.H{"error": "Name already exists or DB error"})
+		return
+	}
+	ch, err = alerts.GetChannel(db, id)
+	if err != nil {
+		log.Println("Error getting alert channel:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+		return
+	}
+	status := http.StatusOK
+	if existing.ID == 0 {
+		status = http.StatusCreated
+	}
+	c.JSON(status, maskChannel(ch))
+}
+
+// DeleteAlertChannel deletes a notification channel
+func DeleteAlertChannel(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := pathID(c)
+		if !ok {
+			return
+		}
+		found, err := alerts.DeleteChannel(db, id)
+		if err != nil {
+			log.Println("Error deleting alert channel:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Alert channel not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Alert channel deleted"})
+	}
+}
+
+// TestAlertChannel sends a test notification and reports delivery errors
+func TestAlertChannel(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ch, ok := loadAlertChannel(c, db)
+		if !ok {
+			return
+		}
+		if err := alerts.Send(ch, alerts.TestNotification()); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Delivery failed: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Test notification sent"})
+	}
+}
+
+// ListAlerts returns alerts, newest first, filtered by ?status= and
+// ?application_id=
+func ListAlerts(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := c.Query("status")
+		if status != "" && status != alerts.StatusFiring && status != alerts.StatusResolved {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be firing or resolved"})
+			return
+		}
+		var appID int64
+		if v := c.Query("application_id"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid application_id"})
+				return
+			}
+			appID = id
+		}
+		limit := 100
+		if v, err := strconv.Atoi(c.Query("limit")); err == nil && v > 0 && v <= 1000 {
+			limit = v
+		}
+		list, err := alerts.List(db, status, appID, limit)
+		if err != nil {
+			log.Println("Error listing alerts:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// ListAlertSilences returns the silences that have not ended
+func ListAlertSilences(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := alerts.Silences(db)
+		if err != nil {
+			log.Println("Error listing alert silences:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// CreateAlertSilence mutes notifications of a rule, an application, or
+// everything when both are omitted
+func CreateAlertSilence(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req AlertSilenceRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// Silences are compared as stored text, so keep every time in UTC
+		now := time.Now().UTC()
+		var ends time.Time
+		switch {
+		case req.EndsAt != nil:
+			ends = req.EndsAt.UTC()
+		case req.DurationMinutes > 0:
+			ends = now.Add(time.Duration(req.DurationMinutes) * time.Minute)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Set duration_minutes or ends_at"})
+			return
+		}
+		if !ends.After(now) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be in the future"})
+			return
+		}
+		if req.RuleID != 0 {
+			if _, err := alerts.GetRule(db, req.RuleID); err == sql.ErrNoRows {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Alert rule not found"})
+				return
+			} else if err != nil {
+				log.Println("Error getting alert rule:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+				return
+			}
+		}
+		username, _ := c.Get("username")
+		name, _ := username.(string)
+		s := models.AlertSilence{RuleID: req.RuleID, ApplicationID: req.ApplicationID, Reason: req.Reason, StartsAt: now, EndsAt: ends, CreatedBy: name}
+		id, err := alerts.AddSilence(db, s)
+		if err != nil {
+			log.Println("Error saving alert silence:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		s.ID, s.CreatedAt = id, now
+		recordAudit(c, db, "alert.silence", req.ApplicationID, fmt.Sprintf("rule %d", req.RuleID), "until "+ends.UTC().Format(time.RFC3339))
+		c.JSON(http.StatusCreated, s)
+	}
+}
+
+// DeleteAlertSilence ends a silence early
+func DeleteAlertSilence(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := pathID(c)
+		if !ok {
+			return
+		}
+		found, err := alerts.DeleteSilence(db, id)
+		if err != nil {
+			log.Println("Error deleting alert silence:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Silence not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Silence removed"})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"context"
@@ -20,31 +21,47 @@ import (
 	"io/ioutil"
 
 	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/mount"
-	"github.com/docker/docker/api/types/strslice"
 	"github.com/docker/docker/client"
-	"github.com/docker/go-connections/nat"
+	"github.com/gakwaya-panel/api/internal/alerts"
+	"github.com/gakwaya-panel/api/internal/databases"
 	"github.com/gakwaya-panel/api/internal/dockerutil"
+	"github.com/gakwaya-panel/api/internal/jobs"
 	"github.com/gakwaya-panel/api/internal/models"
+	"github.com/gakwaya-panel/api/internal/ports"
+	"github.com/gakwaya-panel/api/internal/proxy"
+	"github.com/gakwaya-panel/api/internal/retention"
+	"github.com/gakwaya-panel/api/internal/scanner"
+	"github.com/gakwaya-panel/api/internal/secrets"
+	"github.com/gakwaya-panel/api/internal/volumes"
 	"github.com/gin-gonic/gin"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 )
 
 type ApplicationRequest struct {
-	Name           string            `json:"name" binding:"required,min=2,max=64"`
-	Image          string            `json:"image" binding:"required"`
-	Env            map[string]string `json:"env"`
-	Status         string            `json:"status"`
-	Domain         string            `json:"domain"`
-	Port           int               `json:"host_port"`
-	ContainerPort  int               `json:"container_port"`
-	GitURL         string            `json:"git_url"`
-	Branch         string            `json:"branch"`
-	DockerfilePath string            `json:"dockerfile_path"`
-	Volumes        []string          `json:"volumes"`
-	BuildArgs      map[string]string `json:"build_args"`
+	Name            string                     `json:"name" binding:"required,min=2,max=64"`
+	Image           string                     `json:"image" binding:"required"`
+	Env             map[string]string          `json:"env"`
+	Status          string                     `json:"status"`
+	Domain          string                     `json:"domain"`
+	Port            int                        `json:"host_port"`
+	ContainerPort   int                        `json:"container_port"`
+	GitURL          string                     `json:"git_url"`
+	Branch          string                     `json:"branch"`
+	DockerfilePath  string                     `json:"dockerfile_path"`
+	Volumes         []string                   `json:"volumes"`
+	BuildArgs       map[string]string          `json:"build_args"`
+	ImageRetention  int                        `json:"image_retention" binding:"min=0"`
+	BuildTimeout    int                        `json:"build_timeout" binding:"min=0"`
+	ReleaseCommand  string                     `json:"release_command"`
+	PostDeployHooks []string                   `json:"post_deploy_hooks"`
+	Domains         []string                   `json:"domains"`
+	Ports           []models.PortMapping       `json:"ports"`
+	Project         string                     `json:"project"`
+	Networks        []models.NetworkAttachment `json:"networks"`
+	Secrets         []string                   `json:"secrets"`
+	EnvGroups       []string                   `json:"env_groups"`
+	DatabaseLinks   []models.DatabaseLink      `json:"database_links"`
 }
 
 // DeployFromGitRequest is the request body for git-based deployment
@@ -65,16 +82,52 @@ func CreateApplication(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		envJSON, _ := json.Marshal(req.Env)
+		publishedPorts, err := ports.Normalize(req.Ports)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateNetworks(req.Project, req.Networks); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if _, err := volumes.Mounts(req.Volumes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateEnvGroups(db, req.EnvGroups); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateDatabaseLinks(db, req.DatabaseLinks); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		envSealed, err := sealJSON(req.Env)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt env: " + err.Error()})
+			return
+		}
+		buildArgsSealed, err := sealJSON(req.BuildArgs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt build args: " + err.Error()})
+			return
+		}
 		status := req.Status
 		if status == "" {
 			status = "created"
 		}
 		volumesJSON, _ := json.Marshal(req.Volumes)
-		buildArgsJSON, _ := json.Marshal(req.BuildArgs)
+		hooksJSON, _ := json.Marshal(req.PostDeployHooks)
+		domainsJSON, _ := json.Marshal(req.Domains)
+		portsJSON, _ := json.Marshal(publishedPorts)
+		networksJSON, _ := json.Marshal(req.Networks)
+		secretsJSON, _ := json.Marshal(req.Secrets)
+		envGroupsJSON, _ := json.Marshal(req.EnvGroups)
+		linksJSON, _ := json.Marshal(req.DatabaseLinks)
 		result, err := db.Exec(
-			"INSERT INTO applications (name, image, env, status, created_at, domain, host_port, container_port, git_url, branch, dockerfile_path, volumes, build_args) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
-			req.Name, req.Image, string(envJSON), status, time.Now(), req.Domain, req.Port, req.ContainerPort, req.GitURL, req.Branch, req.DockerfilePath, string(volumesJSON), string(buildArgsJSON),
+			"INSERT INTO applications (name, image, env, status, created_at, domain, host_port, container_port, git_url, branch, dockerfile_path, volumes, build_args, image_retention, build_timeout, release_command, post_deploy_hooks, domains, ports, project, networks, secrets, env_groups, database_links) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			req.Name, req.Image, envSealed, status, time.Now(), req.Domain, req.Port, req.ContainerPort, req.GitURL, req.Branch, req.DockerfilePath, string(volumesJSON), buildArgsSealed, req.ImageRetention, req.BuildTimeout, req.ReleaseCommand, string(hooksJSON), string(domainsJSON), string(portsJSON), req.Project, string(networksJSON), string(secretsJSON), string(envGroupsJSON), string(linksJSON),
 		)
 		if err != nil {
 			log.Println("Error creating application:", err)
@@ -89,37 +142,23 @@ func CreateApplication(db *sql.DB) gin.HandlerFunc {
 // ListApplications returns all applications
 func ListApplications(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		rows, err := db.Query("SELECT id, name, image, env, status, created_at, domain, host_port, container_port, git_url, branch, dockerfile_path, volumes, build_args, container_id FROM applications ORDER BY id DESC")
+		rows, err := db.Query("SELECT " + applicationColumns + " FROM applications ORDER BY id DESC")
 		if err != nil {
 			log.Println("Error listing applications:", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
 			return
 		}
 		defer rows.Close()
-		var containerID sql.NullString
 
 		apps := []models.Application{}
 		for rows.Next() {
-			var app models.Application
-			var volumesStr, buildArgsStr string
-			if err := rows.Scan(&app.ID, &app.Name, &app.Image, &app.Env, &app.Status, &app.CreatedAt, &app.Domain, &app.Port, &app.ContainerPort, &app.GitURL, &app.Branch, &app.DockerfilePath, &volumesStr, &buildArgsStr, &containerID); err != nil {
+			app, err := scanApplication(rows)
+			if err != nil {
 				log.Println("Error scanning application:", err)
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
 				return
 			}
-
-			if containerID.Valid {
-				app.ContainerID = containerID.String
-			} else {
-				app.ContainerID = ""
-			}
-
-			if volumesStr != "" {
-				_ = json.Unmarshal([]byte(volumesStr), &app.Volumes)
-			}
-			if buildArgsStr != "" {
-				_ = json.Unmarshal([]byte(buildArgsStr), &app.BuildArgs)
-			}
+			maskSecrets(&app)
 			apps = append(apps, app)
 		}
 
@@ -135,12 +174,7 @@ func GetApplication(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
 			return
 		}
-		var app models.Application
-		var volumesStr, buildArgsStr string
-		var containerID sql.NullString
-		err = db.QueryRow("SELECT id, name, image, env, status, created_at, domain, host_port, container_port, git_url, branch, dockerfile_path, volumes, build_args, container_id FROM applications WHERE id = ?", id).Scan(
-			&app.ID, &app.Name, &app.Image, &app.Env, &app.Status, &app.CreatedAt, &app.Domain, &app.Port, &app.ContainerPort, &app.GitURL, &app.Branch, &app.DockerfilePath, &volumesStr, &buildArgsStr, &containerID,
-		)
+		app, err := scanApplication(db.QueryRow("SELECT "+applicationColumns+" FROM applications WHERE id = ?", id))
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
 			return
@@ -149,17 +183,7 @@ func GetApplication(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
 			return
 		}
-		if containerID.Valid {
-			app.ContainerID = containerID.String
-		} else {
-			app.ContainerID = ""
-		}
-		if volumesStr != "" {
-			_ = json.Unmarshal([]byte(volumesStr), &app.Volumes)
-		}
-		if buildArgsStr != "" {
-			_ = json.Unmarshal([]byte(buildArgsStr), &app.BuildArgs)
-		}
+		maskSecrets(&app)
 		c.JSON(http.StatusOK, app)
 	}
 }
@@ -177,18 +201,60 @@ func UpdateApplication(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		envJSON, _ := json.Marshal(req.Env)
+		publishedPorts, err := ports.Normalize(req.Ports)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateNetworks(req.Project, req.Networks); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if _, err := volumes.Mounts(req.Volumes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateEnvGroups(db, req.EnvGroups); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateDatabaseLinks(db, req.DatabaseLinks); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := keepMaskedSecrets(db, id, &req); err != nil {
+			log.Println("Error getting application:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		envSealed, err := sealJSON(req.Env)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt env: " + err.Error()})
+			return
+		}
+		buildArgsSealed, err := sealJSON(req.BuildArgs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt build args: " + err.Error()})
+			return
+		}
 		volumesJSON, _ := json.Marshal(req.Volumes)
-		buildArgsJSON, _ := json.Marshal(req.BuildArgs)
+		hooksJSON, _ := json.Marshal(req.PostDeployHooks)
+		domainsJSON, _ := json.Marshal(req.Domains)
+		portsJSON, _ := json.Marshal(publishedPorts)
+		networksJSON, _ := json.Marshal(req.Networks)
+		secretsJSON, _ := json.Marshal(req.Secrets)
+		envGroupsJSON, _ := json.Marshal(req.EnvGroups)
+		linksJSON, _ := json.Marshal(req.DatabaseLinks)
 		_, err = db.Exec(
-			"UPDATE applications SET name = ?, image = ?, env = ?, status = ?, domain = ?, host_port = ?, container_port = ?, git_url = ?, branch = ?, dockerfile_path = ?, volumes = ?, build_args = ? WHERE id = ?",
-			req.Name, req.Image, string(envJSON), req.Status, req.Domain, req.Port, req.ContainerPort, req.GitURL, req.Branch, req.DockerfilePath, string(volumesJSON), string(buildArgsJSON), id,
+			"UPDATE applications SET name = ?, image = ?, env = ?, status = ?, domain = ?, host_port = ?, container_port = ?, git_url = ?, branch = ?, dockerfile_path = ?, volumes = ?, build_args = ?, image_retention = ?, build_timeout = ?, release_command = ?, post_deploy_hooks = ?, domains = ?, ports = ?, project = ?, networks = ?, secrets = ?, env_groups = ?, database_links = ? WHERE id = ?",
+			req.Name, req.Image, envSealed, req.Status, req.Domain, req.Port, req.ContainerPort, req.GitURL, req.Branch, req.DockerfilePath, string(volumesJSON), buildArgsSealed, req.ImageRetention, req.BuildTimeout, req.ReleaseCommand, string(hooksJSON), string(domainsJSON), string(portsJSON), req.Project, string(networksJSON), string(secretsJSON), string(envGroupsJSON), string(linksJSON), id,
 		)
 		if err != nil {
 			log.Println("Error updating application:", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
 			return
 		}
+		proxy.Refresh(db)
 		c.JSON(http.StatusOK, gin.H{"updated": true})
 	}
 }
@@ -201,12 +267,27 @@ func DeleteApplication(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
 			return
 		}
+		// Managed databases cannot be removed while applications link to them
+		var name string
+		if err := db.QueryRow("SELECT name FROM applications WHERE id = ?", id).Scan(&name); err == nil {
+			links, err := collectDatabaseLinks(db)
+			if err != nil {
+				log.Println("Error resolving database links:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+				return
+			}
+			if len(links[name]) > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "Database is linked to applications", "applications": links[name]})
+				return
+			}
+		}
 		_, err = db.Exec("DELETE FROM applications WHERE id = ?", id)
 		if err != nil {
 			log.Println("Error deleting application:", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
 			return
 		}
+		proxy.Refresh(db)
 		c.JSON(http.StatusOK, gin.H{"deleted": true})
 	}
 }
@@ -219,12 +300,7 @@ func DeployApplication(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
 			return
 		}
-		var app models.Application
-		var volumesStr, buildArgsStr string
-		var containerID sql.NullString
-		err = db.QueryRow("SELECT id, name, image, env, host_port, container_port, volumes, build_args, container_id FROM applications WHERE id = ?", id).Scan(
-			&app.ID, &app.Name, &app.Image, &app.Env, &app.Port, &app.ContainerPort, &volumesStr, &buildArgsStr, &containerID,
-		)
+		app, err := scanApplication(db.QueryRow("SELECT "+applicationColumns+" FROM applications WHERE id = ?", id))
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
 			return
@@ -233,109 +309,115 @@ func DeployApplication(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
 			return
 		}
-		if containerID.Valid {
-			app.ContainerID = containerID.String
-		} else {
-			app.ContainerID = ""
-		}
-		// Parse env JSON
-		var envMap map[string]string
-		if app.Env != "" {
-			if err := json.Unmarshal([]byte(app.Env), &envMap); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid env format"})
-				return
-			}
-		}
-		envs := []string{}
-		for k, v := range envMap {
-			envs = append(envs, k+"="+v)
-		}
-		// Parse volumes JSON
-		var volumes []string
-		if volumesStr != "" {
-			_ = json.Unmarshal([]byte(volumesStr), &volumes)
-		}
-		// Parse build_args JSON (not used in container run, but available)
-		var buildArgs map[string]string
-		if buildArgsStr != "" {
-			_ = json.Unmarshal([]byte(buildArgsStr), &buildArgs)
-		}
-		// Prepare Docker mounts
-		var mounts []mount.Mount
-		for _, v := range volumes {
-			mounts = append(mounts, mount.Mount{
-				Type:   mount.TypeBind,
-				Source: v,
-				Target: v,
-			})
-		}
-		// Prepare port bindings if ports are specified
-		portBindings := nat.PortMap{}
-		exposedPorts := nat.PortSet{}
-		if app.Port > 0 && app.ContainerPort > 0 {
-			containerPort := nat.Port(strconv.Itoa(app.ContainerPort) + "/tcp")
-			exposedPorts[containerPort] = struct{}{}
-			portBindings[containerPort] = []nat.PortBinding{{
-				HostIP:   "0.0.0.0",
-				HostPort: strconv.Itoa(app.Port),
-			}}
-		} else if app.Port > 0 {
-			// fallback: if only host_port is set, default container_port to 80
-			containerPort := nat.Port("80/tcp")
-			exposedPorts[containerPort] = struct{}{}
-			portBindings[containerPort] = []nat.PortBinding{{
-				HostIP:   "0.0.0.0",
-				HostPort: strconv.Itoa(app.Port),
-			}}
-		}
-		cli, err := dockerutil.NewClient()
-		if err != nil {
-			log.Println("Error creating Docker client:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
-			return
-		}
-		defer cli.Close()
+		deployImage(c, db, app, nil)
+	}
+}
 
-		// Explicitly pull the image before creating the container
-		pullReader, err := cli.ImagePull(context.Background(), app.Image, types.ImagePullOptions{})
-		if err != nil {
-			log.Println("Error pulling image:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pull image: " + err.Error()})
-			return
-		}
-		io.Copy(io.Discard, pullReader)
-		pullReader.Close()
+// deployImage pulls the application's image and rolls out a new container,
+// answering the request. extra is merged into the success response.
+func deployImage(c *gin.Context, db *sql.DB, app models.Application, extra gin.H) {
+	// Parse env JSON and merge the env groups under it
+	own, err := envMap(app)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid env format"})
+		return
+	}
+	env, _, _, err := effectiveEnv(db, app, own)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	envs := envList(env)
+	// Prepare Docker mounts
+	mounts, err := volumes.Mounts(app.Volumes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cli, err := dockerutil.NewClient()
+	if err != nil {
+		log.Println("Error creating Docker client:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+		return
+	}
+	defer cli.Close()
 
-		resp, err := cli.ContainerCreate(
-			context.Background(),
-			&container.Config{
-				Image:        app.Image,
-				Env:          envs,
-				ExposedPorts: exposedPorts,
-			},
-			&container.HostConfig{
-				Mounts:       mounts,
-				PortBindings: portBindings,
-			},
-			nil, nil, app.Name,
-		)
-		if err != nil {
-			log.Println("Error creating container:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create container: " + err.Error()})
-			return
-		}
-		if err := cli.ContainerStart(context.Background(), resp.ID, types.ContainerStartOptions{}); err != nil {
-			log.Println("Error starting container:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start container: " + err.Error()})
+	job, ctx := jobs.Start(c.Request.Context(), "deploy", app.ID)
+	defer func() { job.Done(c.Writer.Status() < http.StatusBadRequest) }()
+	job.Running()
+	ctx, cancel := context.WithTimeout(ctx, jobs.Timeout(app.BuildTimeout))
+	defer cancel()
+
+	// Explicitly pull the image before creating the container
+	pullReader, err := cli.ImagePull(ctx, app.Image, types.ImagePullOptions{})
+	if err != nil {
+		if abortJob(c, ctx, job) {
 			return
 		}
-		_, err = db.Exec("UPDATE applications SET container_id = ? WHERE id = ?", resp.ID, id)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update application with container ID"})
+		log.Println("Error pulling image:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pull image: " + err.Error()})
+		return
+	}
+	io.Copy(io.Discard, pullReader)
+	pullReader.Close()
+	if abortJob(c, ctx, job) {
+		return
+	}
+
+	scan, blocked, err := checkImageScan(ctx, cli, db, app.Image)
+	if err != nil {
+		recordDeployment(db, app.ID, app.Image, "", "failed", "image scan failed: "+err.Error())
+		if abortJob(c, ctx, job) {
 			return
 		}
-		c.JSON(http.StatusCreated, gin.H{"container_id": resp.ID, "status": "started"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Image scan failed: " + err.Error()})
+		return
+	}
+	if blocked {
+		recordDeployment(db, app.ID, app.Image, "", "failed", "blocked by vulnerability policy")
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Image blocked by vulnerability policy", "threshold": scanner.BlockThreshold(), "scan": scan})
+		return
+	}
+
+	published, exposedPorts, portBindings, err := publishPorts(ctx, cli, db, app, app.Image)
+	if err != nil {
+		recordDeployment(db, app.ID, app.Image, "", "failed", "port allocation failed: "+err.Error())
+		respondPortError(c, err)
+		return
+	}
+
+	spec := containerSpec{
+		Name:         app.Name,
+		Image:        app.Image,
+		Env:          envs,
+		Mounts:       mounts,
+		ExposedPorts: exposedPorts,
+		PortBindings: portBindings,
+		Networks:     appNetworks(app),
 	}
+	if engine, ok := databases.Lookup(app.ServiceType); ok {
+		spec.Cmd = engine.Command(own)
+	}
+	var deployLog strings.Builder
+	result, err := rollout(ctx, cli, app, spec, &deployLog)
+	if err != nil {
+		log.Println("Error deploying application:", err)
+		recordDeployment(db, app.ID, app.Image, "", "failed", deployLog.String())
+		respondRolloutError(c, ctx, job, err, deployLog.String())
+		return
+	}
+	_, err = db.Exec("UPDATE applications SET container_id = ? WHERE id = ?", result.ContainerID, app.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update application with container ID"})
+		return
+	}
+	recordDeployment(db, app.ID, app.Image, result.ContainerID, "succeeded", deployLog.String())
+	proxy.Refresh(db)
+	response := gin.H{"container_id": result.ContainerID, "status": "started", "ports": published, "job_id": job.ID, "hooks_error": result.HooksError}
+	for k, v := range extra {
+		response[k] = v
+	}
+	c.JSON(http.StatusCreated, response)
 }
 
 // DeployFromGit builds and runs a container from a Git repo
@@ -351,6 +433,39 @@ func DeployFromGit(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if _, err := volumes.Mounts(req.Volumes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		app, err := scanApplication(db.QueryRow("SELECT "+applicationColumns+" FROM applications WHERE id = ?", id))
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+			return
+		} else if err != nil {
+			log.Println("Error getting application:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+
+		// Wait for a free build slot; the timeout only starts once the build runs
+		job, ctx := jobs.Start(c.Request.Context(), "build", app.ID)
+		defer func() { job.Done(c.Writer.Status() < http.StatusBadRequest) }()
+		if err := jobs.AcquireBuild(ctx); err != nil {
+			abortJob(c, ctx, job)
+			return
+		}
+		slotHeld := true
+		releaseSlot := func() {
+			if slotHeld {
+				jobs.ReleaseBuild()
+				slotHeld = false
+			}
+		}
+		defer releaseSlot()
+		job.Running()
+		ctx, cancel := context.WithTimeout(ctx, jobs.Timeout(app.BuildTimeout))
+		defer cancel()
+
 		// 1. Clone repo
 		tmpDir, err := os.MkdirTemp("", fmt.Sprintf("gakwayapanel-app-%d-*", id))
 		if err != nil {
@@ -365,8 +480,11 @@ func DeployFromGit(db *sql.DB) gin.HandlerFunc {
 			cloneOpts.ReferenceName = plumbing.ReferenceName("refs/heads/" + req.Branch)
 			cloneOpts.SingleBranch = true
 		}
-		_, err = git.PlainClone(tmpDir, false, cloneOpts)
+		_, err = git.PlainCloneContext(ctx, tmpDir, false, cloneOpts)
 		if err != nil {
+			if abortJob(c, ctx, job) {
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clone repo: " + err.Error()})
 			return
 		}
@@ -377,7 +495,7 @@ func DeployFromGit(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 		defer cli.Close()
-		imageTag := fmt.Sprintf("gakwayapanel-app-%d:%d", id, time.Now().Unix())
+		imageTag := fmt.Sprintf("%s:%d", retention.ImageRepository(app.ID), time.Now().Unix())
 		dockerfilePath := filepath.Join(tmpDir, "Dockerfile")
 		dockerfile := "Dockerfile"
 		if _, err := os.Stat(dockerfilePath); os.IsNotExist(err) {
@@ -405,7 +523,7 @@ func DeployFromGit(db *sql.DB) gin.HandlerFunc {
 			buildArgs["TARGETPLATFORM"] = &val
 		}
 		buildResp, err := cli.ImageBuild(
-			c,
+			ctx,
 			buildCtx,
 			types.ImageBuildOptions{
 				Tags:       []string{imageTag},
@@ -415,70 +533,212 @@ func DeployFromGit(db *sql.DB) gin.HandlerFunc {
 			},
 		)
 		if err != nil {
+			if abortJob(c, ctx, job) {
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build image: " + err.Error()})
 			return
 		}
 		buildLog, _ := io.ReadAll(buildResp.Body)
 		buildResp.Body.Close()
+		releaseSlot()
+		if abortJob(c, ctx, job) {
+			return
+		}
 		if !imageExists(cli, imageTag) {
+			recordDeployment(db, app.ID, imageTag, "", "failed", string(buildLog))
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker build failed", "build_log": string(buildLog)})
 			return
 		}
-		// 3. Prepare env/volumes
-		envs := []string{}
-		if req.Env != nil {
-			for k, v := range req.Env {
-				envs = append(envs, k+"="+v)
-			}
-		} else {
-			// fallback to stored env
-			var app models.Application
-			err = db.QueryRow("SELECT env FROM applications WHERE id = ?", id).Scan(&app.Env)
-			if err == nil && app.Env != "" {
-				var envMap map[string]string
-				if err := json.Unmarshal([]byte(app.Env), &envMap); err == nil {
-					for k, v := range envMap {
-						envs = append(envs, k+"="+v)
-					}
-				}
+		scan, blocked, err := checkImageScan(ctx, cli, db, imageTag)
+		if err != nil {
+			recordDeployment(db, app.ID, imageTag, "", "failed", "image scan failed: "+err.Error())
+			if abortJob(c, ctx, job) {
+				return
 			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Image scan failed: " + err.Error()})
+			return
 		}
-		var mounts []mount.Mount
-		for _, v := range req.Volumes {
-			mounts = append(mounts, mount.Mount{
-				Type:   mount.TypeBind,
-				Source: v,
-				Target: v,
-			})
-		}
-		// 4. Run container
-		resp, err := cli.ContainerCreate(
-			c,
-			&container.Config{
-				Image: imageTag,
-				Env:   envs,
-				Cmd:   strslice.StrSlice{},
-			},
-			&container.HostConfig{
-				Mounts: mounts,
-			},
-			nil, nil, fmt.Sprintf("gakwayapanel-app-%d", id),
-		)
+		if blocked {
+			recordDeployment(db, app.ID, imageTag, "", "failed", string(buildLog))
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Image blocked by vulnerability policy", "threshold": scanner.BlockThreshold(), "scan": scan})
+			return
+		}
+		// 3. Prepare env/volumes, falling back to the stored ones
+		own := req.Env
+		if own == nil {
+			own, _ = envMap(app)
+		}
+		env, _, _, err := effectiveEnv(db, app, own)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create container: " + err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if err := cli.ContainerStart(c, resp.ID, types.ContainerStartOptions{}); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start container: " + err.Error()})
+		envs := envList(env)
+		volumeSpecs := req.Volumes
+		if volumeSpecs == nil {
+			volumeSpecs = app.Volumes
+		}
+		mounts, err := volumes.Mounts(volumeSpecs)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		published, exposedPorts, portBindings, err := publishPorts(ctx, cli, db, app, imageTag)
+		if err != nil {
+			recordDeployment(db, app.ID, imageTag, "", "failed", string(buildLog)+"\nport allocation failed: "+err.Error())
+			respondPortError(c, err)
 			return
 		}
-		_, err = db.Exec("UPDATE applications SET image = ?, container_id = ? WHERE id = ?", imageTag, resp.ID, id)
+		// 4. Release, switch containers and run hooks
+		spec := containerSpec{
+			Name:         fmt.Sprintf("gakwayapanel-app-%d", id),
+			Image:        imageTag,
+			Env:          envs,
+			Mounts:       mounts,
+			ExposedPorts: exposedPorts,
+			PortBindings: portBindings,
+			Networks:     appNetworks(app),
+		}
+		var deployLog strings.Builder
+		deployLog.Write(buildLog)
+		result, err := rollout(ctx, cli, app, spec, &deployLog)
+		if err != nil {
+			recordDeployment(db, app.ID, imageTag, "", "failed", deployLog.String())
+			respondRolloutError(c, ctx, job, err, deployLog.String())
+			return
+		}
+		_, err = db.Exec("UPDATE applications SET image = ?, container_id = ? WHERE id = ?", imageTag, result.ContainerID, id)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update application with image/container ID"})
 			return
 		}
-		c.JSON(http.StatusCreated, gin.H{"container_id": resp.ID, "image_tag": imageTag, "status": "started"})
+		recordDeployment(db, app.ID, imageTag, result.ContainerID, "succeeded", deployLog.String())
+		proxy.Refresh(db)
+		// 5. Drop old build images now that the new one is live
+		report, err := retention.Enforce(context.Background(), cli, db, app.ID)
+		if err != nil {
+			log.Printf("[WARN] Image retention failed for application %d: %v", id, err)
+		}
+		c.JSON(http.StatusCreated, gin.H{"container_id": result.ContainerID, "image_tag": imageTag, "status": "started", "ports": published, "retention": report, "job_id": job.ID, "hooks_error": result.HooksError})
+	}
+}
+
+// PruneApplicationImages applies the image retention policy of an application on demand
+func PruneApplicationImages(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		report, err := retention.Enforce(c, cli, db, int64(id))
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply image retention: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// applicationColumns lists the columns read by scanApplication, in order
+const applicationColumns = "id, name, image, env, status, created_at, domain, host_port, container_port, git_url, branch, dockerfile_path, volumes, build_args, container_id, image_retention, build_timeout, release_command, post_deploy_hooks, domains, ports, project, networks, secrets, env_groups, service_type, database_links"
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanApplication reads an application selected with applicationColumns
+func scanApplication(row rowScanner) (models.Application, error) {
+	var app models.Application
+	var volumesStr, buildArgsStr, hooksStr, domainsStr, portsStr, networksStr, secretsStr, envGroupsStr, linksStr string
+	var containerID sql.NullString
+	err := row.Scan(
+		&app.ID, &app.Name, &app.Image, &app.Env, &app.Status, &app.CreatedAt, &app.Domain, &app.Port, &app.ContainerPort, &app.GitURL, &app.Branch, &app.DockerfilePath, &volumesStr, &buildArgsStr, &containerID, &app.ImageRetention, &app.BuildTimeout, &app.ReleaseCommand, &hooksStr, &domainsStr, &portsStr, &app.Project, &networksStr, &secretsStr, &envGroupsStr, &app.ServiceType, &linksStr,
+	)
+	if err != nil {
+		return app, err
+	}
+	// env and build_args are encrypted at rest
+	if app.Env, err = secrets.Decrypt(app.Env); err != nil {
+		return app, err
+	}
+	if buildArgsStr, err = secrets.Decrypt(buildArgsStr); err != nil {
+		return app, err
+	}
+	if containerID.Valid {
+		app.ContainerID = containerID.String
+	}
+	if volumesStr != "" {
+		_ = json.Unmarshal([]byte(volumesStr), &app.Volumes)
+	}
+	if buildArgsStr != "" {
+		_ = json.Unmarshal([]byte(buildArgsStr), &app.BuildArgs)
+	}
+	if hooksStr != "" {
+		_ = json.Unmarshal([]byte(hooksStr), &app.PostDeployHooks)
+	}
+	if domainsStr != "" {
+		_ = json.Unmarshal([]byte(domainsStr), &app.Domains)
+	}
+	if portsStr != "" {
+		_ = json.Unmarshal([]byte(portsStr), &app.Ports)
+	}
+	if networksStr != "" {
+		_ = json.Unmarshal([]byte(networksStr), &app.Networks)
+	}
+	if secretsStr != "" {
+		_ = json.Unmarshal([]byte(secretsStr), &app.Secrets)
+	}
+	if envGroupsStr != "" {
+		_ = json.Unmarshal([]byte(envGroupsStr), &app.EnvGroups)
+	}
+	if linksStr != "" {
+		_ = json.Unmarshal([]byte(linksStr), &app.DatabaseLinks)
+	}
+	return app, nil
+}
+
+// recordDeployment stores a deployment row; failures are only logged
+func recordDeployment(db *sql.DB, appID int64, image, containerID, status, deployLog string) {
+	_, err := db.Exec(
+		"INSERT INTO deployments (application_id, image, container_id, status, log, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		appID, image, containerID, status, deployLog, time.Now(),
+	)
+	if err != nil {
+		log.Printf("[WARN] Could not record deployment for application %d: %v", appID, err)
+	}
+	switch status {
+	case "failed":
+		alerts.Raise(db, alerts.RuleDeployFailed, appID, "", deployFailureMessage(db, appID, image, deployLog))
+	case "succeeded":
+		alerts.Resolve(db, alerts.RuleDeployFailed, appID, "", "The deployment of "+image+" succeeded.")
+	}
+}
+
+// deployFailureMessage summarizes a failed deployment with the end of its log
+func deployFailureMessage(db *sql.DB, appID int64, image, deployLog string) string {
+	var name string
+	_ = db.QueryRow("SELECT name FROM applications WHERE id = ?", appID).Scan(&name)
+	msg := fmt.Sprintf("The deployment of %s to %s failed.", image, name)
+	deployLog = strings.TrimSpace(deployLog)
+	if len(deployLog) > 500 {
+		deployLog = "..." + deployLog[len(deployLog)-500:]
+	}
+	if deployLog != "" {
+		msg += "\n\n" + deployLog
 	}
+	return msg
 }
 
 // tarDirectory tars the given directory and returns a ReadCloser for the tar stream
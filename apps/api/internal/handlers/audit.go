@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// recordAudit stores an audit entry for the authenticated user; failures are only logged
+func recordAudit(c *gin.Context, db *sql.DB, action string, appID int64, target, details string) {
+	var userID int64
+	if v, ok := c.Get("user_id"); ok {
+		// JWT numbers decode as float64
+		if f, ok := v.(float64); ok {
+			userID = int64(f)
+		}
+	}
+	username, _ := c.Get("username")
+	name, _ := username.(string)
+	_, err := db.Exec(
+		"INSERT INTO audit_log (user_id, username, action, application_id, target, details, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		userID, name, action, appID, target, details, time.Now(),
+	)
+	if err != nil {
+		log.Println("Error recording audit entry:", err)
+	}
+}
+
+// ListAuditLog returns recent audit entries, newest first, optionally
+// filtered by ?application_id= and ?action=
+func ListAuditLog(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := "SELECT id, user_id, username, action, application_id, target, details, created_at FROM audit_log WHERE 1 = 1"
+		var args []any
+		if v := c.Query("application_id"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid application_id"})
+				return
+			}
+			query += " AND application_id = ?"
+			args = append(args, id)
+		}
+		if v := c.Query("action"); v != "" {
+			query += " AND action = ?"
+			args = append(args, v)
+		}
+		limit := 100
+		if v, err := strconv.Atoi(c.Query("limit")); err == nil && v > 0 && v <= 1000 {
+			limit = v
+		}
+		query += " ORDER BY id DESC LIMIT ?"
+		args = append(args, limit)
+
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			log.Println("Error listing audit log:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		defer rows.Close()
+		entries := []models.AuditEntry{}
+		for rows.Next() {
+			var e models.AuditEntry
+			if err := rows.Scan(&e.ID, &e.UserID, &e.Username, &e.Action, &e.ApplicationID, &e.Target, &e.Details, &e.CreatedAt); err != nil {
+				log.Println("Error scanning audit entry:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+				return
+			}
+			entries = append(entries, e)
+		}
+		c.JSON(http.StatusOK, entries)
+	}
+}
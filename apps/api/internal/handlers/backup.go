@@ -0,0 +1,499 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/gakwaya-panel/api/internal/backup"
+	"github.com/gakwaya-panel/api/internal/cron"
+	"github.com/gakwaya-panel/api/internal/dockerutil"
+	"github.com/gakwaya-panel/api/internal/jobs"
+	"github.com/gakwaya-panel/api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateBackupRequest is the request body for an on-demand backup.
+// Mode defaults to "dump" for managed databases and "volumes" otherwise.
+type CreateBackupRequest struct {
+	Mode    string   `json:"mode"`
+	Engine  string   `json:"engine"`
+	Sources []string `json:"sources"`
+	StopApp bool     `json:"stop_app"`
+}
+
+// BackupScheduleRequest is the request body for creating or updating a backup schedule
+type BackupScheduleRequest struct {
+	Cron    string `json:"cron" binding:"required"`
+	Keep    int    `json:"keep" binding:"min=0"`
+	StopApp bool   `json:"stop_app"`
+	Mode    string `json:"mode"`
+	Engine  string `json:"engine"`
+	Enabled *bool  `json:"enabled"`
+}
+
+// RestoreBackupRequest is the request body for restoring a backup.
+// Volume backups use TargetVolume, database dumps TargetApplicationID.
+type RestoreBackupRequest struct {
+	TargetVolume        string `json:"target_volume"`
+	TargetApplicationID int64  `json:"target_application_id"`
+}
+
+// backupMode resolves the mode of a backup request for an application
+func backupMode(app models.Application, mode, engine string) (string, string, error) {
+	if mode == "" {
+		mode = backup.ModeVolumes
+		if app.ServiceType != "" {
+			mode = backup.ModeDump
+		}
+	}
+	switch mode {
+	case backup.ModeVolumes:
+		return mode, "", nil
+	case backup.ModeDump:
+		engine, err := backup.DumpEngine(app, engine)
+		return mode, engine, err
+	}
+	return "", "", errors.New("mode must be volumes or dump")
+}
+
+// loadBackup reads the backup named by the :id path parameter, answering the request on failure
+func loadBackup(c *gin.Context, db *sql.DB) (models.Backup, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return models.Backup{}, false
+	}
+	b, err := backup.Get(db, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Backup not found"})
+		return b, false
+	} else if err != nil {
+		log.Println("Error getting backup:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+		return b, false
+	}
+	return b, true
+}
+
+// CreateBackup snapshots an application's volumes and bind paths, or takes a
+// logical dump of its database, now
+func CreateBackup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+		var req CreateBackupRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		app, err := scanApplication(db.QueryRow("SELECT "+applicationColumns+" FROM applications WHERE id = ?", id))
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+			return
+		} else if err != nil {
+			log.Println("Error getting application:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		mode, engine, err := backupMode(app, req.Mode, req.Engine)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+
+		kind := "backup"
+		if mode == backup.ModeDump {
+			kind = "dump"
+		}
+		job, ctx := jobs.Start(c.Request.Context(), kind, app.ID)
+		defer func() { job.Done(c.Writer.Status() < http.StatusBadRequest) }()
+		job.Running()
+
+		var results []models.Backup
+		if mode == backup.ModeDump {
+			var b models.Backup
+			b, err = backup.Dump(ctx, cli, db, app, engine)
+			results = append(results, b)
+		} else {
+			results, err = backup.Run(ctx, cli, db, app, req.Sources, req.StopApp)
+		}
+		if errors.Is(err, backup.ErrNothingToBackUp) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		} else if errors.Is(err, backup.ErrNotRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "job_id": job.ID})
+			return
+		} else if err != nil {
+			if abortJob(c, ctx, job) {
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Backup failed: " + err.Error(), "job_id": job.ID})
+			return
+		}
+		removed := 0
+		keep, err := backup.ScheduleKeep(db, app.ID)
+		if err == nil {
+			removed, err = backup.Enforce(ctx, db, app.ID, keep)
+		}
+		if err != nil {
+			log.Printf("[WARN] Backup retention failed for application %d: %v", app.ID, err)
+		}
+
+		status := http.StatusCreated
+		failed := 0
+		for _, b := range results {
+			if b.Status == backup.StatusFailed {
+				failed++
+			}
+		}
+		if failed == len(results) {
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, gin.H{"backups": results, "removed": removed, "job_id": job.ID})
+	}
+}
+
+// ListBackups returns the backups of an application, newest first
+func ListBackups(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+		list, err := backup.List(db, id)
+		if err != nil {
+			log.Println("Error listing backups:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// schedule builds the schedule described by the request for an application
+func (req BackupScheduleRequest) schedule(app models.Application) (models.BackupSchedule, error) {
+	if _, err := cron.Parse(req.Cron); err != nil {
+		return models.BackupSchedule{}, err
+	}
+	mode, engine, err := backupMode(app, req.Mode, req.Engine)
+	if err != nil {
+		return models.BackupSchedule{}, err
+	}
+	// Managed databases follow their engine; only store an explicit one
+	if engine == app.ServiceType {
+		engine = ""
+	}
+	return models.BackupSchedule{
+		ApplicationID: app.ID, Cron: req.Cron, Keep: req.Keep, StopApp: req.StopApp, Mode: mode, Engine: engine,
+		Enabled: req.Enabled == nil || *req.Enabled,
+	}, nil
+}
+
+// loadBackupSchedule reads the schedule named by the :id path parameter, answering the request on failure
+func loadBackupSchedule(c *gin.Context, db *sql.DB) (models.BackupSchedule, bool) {
+	id, ok := pathID(c)
+	if !ok {
+		return models.BackupSchedule{}, false
+	}
+	s, err := backup.GetSchedule(db, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Backup schedule not found"})
+		return s, false
+	} else if err != nil {
+		log.Println("Error getting backup schedule:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+		return s, false
+	}
+	return s, true
+}
+
+// ListBackupSchedules returns the backup schedules of an application with their next runs
+func ListBackupSchedules(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app, ok := loadApplication(c, db)
+		if !ok {
+			return
+		}
+		list, err := backup.ListSchedules(db, app.ID)
+		if err != nil {
+			log.Println("Error listing backup schedules:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// CreateBackupSchedule adds a backup schedule to an application
+func CreateBackupSchedule(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app, ok := loadApplication(c, db)
+		if !ok {
+			return
+		}
+		var req BackupScheduleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		s, err := req.schedule(app)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		id, err := backup.SaveSchedule(db, s)
+		if err != nil {
+			log.Println("Error creating backup schedule:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		if s, err = backup.GetSchedule(db, id); err != nil {
+			log.Println("Error getting backup schedule:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		c.JSON(http.StatusCreated, s)
+	}
+}
+
+// GetBackupSchedule returns a backup schedule and its next run
+func GetBackupSchedule(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s, ok := loadBackupSchedule(c, db)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, s)
+	}
+}
+
+// UpdateBackupSchedule replaces the settings of a backup schedule
+func UpdateBackupSchedule(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		existing, ok := loadBackupSchedule(c, db)
+		if !ok {
+			return
+		}
+		var req BackupScheduleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		app, err := scanApplication(db.QueryRow("SELECT "+applicationColumns+" FROM applications WHERE id = ?", existing.ApplicationID))
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+			return
+		} else if err != nil {
+			log.Println("Error getting application:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		s, err := req.schedule(app)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		s.ID = existing.ID
+		if _, err := backup.SaveSchedule(db, s); err != nil {
+			log.Println("Error updating backup schedule:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		if s, err = backup.GetSchedule(db, s.ID); err != nil {
+			log.Println("Error getting backup schedule:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		c.JSON(http.StatusOK, s)
+	}
+}
+
+// DeleteBackupSchedule removes a backup schedule; the backups it took are kept
+func DeleteBackupSchedule(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := pathID(c)
+		if !ok {
+			return
+		}
+		found, err := backup.DeleteSchedule(db, id)
+		if err != nil {
+			log.Println("Error deleting backup schedule:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Backup schedule not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": true})
+	}
+}
+
+// DownloadBackup streams a backup tarball or dump
+func DownloadBackup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b, ok := loadBackup(c, db)
+		if !ok {
+			return
+		}
+		if b.Status != backup.StatusSucceeded {
+			c.JSON(http.StatusConflict, gin.H{"error": "Backup did not succeed"})
+			return
+		}
+		store, err := backup.Open(b.Storage)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		rc, err := store.Get(c, b.Key)
+		if errors.Is(err, backup.ErrObjectNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Backup file is missing from storage"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read backup: " + err.Error()})
+			return
+		}
+		defer rc.Close()
+		c.Header("Content-Type", "application/gzip")
+		c.Header("Content-Disposition", `attachment; filename="`+path.Base(b.Key)+`"`)
+		if b.Size > 0 {
+			c.Header("Content-Length", strconv.FormatInt(b.Size, 10))
+		}
+		if b.Checksum != "" {
+			c.Header("X-Checksum-Sha256", b.Checksum)
+		}
+		c.Status(http.StatusOK)
+		if _, err := io.Copy(c.Writer, rc); err != nil {
+			log.Printf("[WARN] Backup %d download interrupted: %v", b.ID, err)
+		}
+	}
+}
+
+// RestoreBackup restores a backup into its source (stopping the application
+// meanwhile) or into a new named volume. Database dumps are loaded into
+// their database or into another running database of the same engine.
+func RestoreBackup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b, ok := loadBackup(c, db)
+		if !ok {
+			return
+		}
+		var req RestoreBackupRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if b.Kind == backup.KindDump {
+			restoreDump(c, db, b, req.TargetApplicationID)
+			return
+		}
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+
+		job, ctx := jobs.Start(c.Request.Context(), "restore", b.ApplicationID)
+		defer func() { job.Done(c.Writer.Status() < http.StatusBadRequest) }()
+		job.Running()
+
+		restored, err := backup.Restore(ctx, cli, db, b, req.TargetVolume)
+		if errors.Is(err, backup.ErrChecksumMismatch) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "job_id": job.ID})
+			return
+		} else if errors.Is(err, backup.ErrVolumeExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			if abortJob(c, ctx, job) {
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Restore failed: " + err.Error(), "job_id": job.ID})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"restored": true, "target": restored, "job_id": job.ID})
+	}
+}
+
+// restoreDump loads a database dump into targetID, or into the database it
+// was taken from
+func restoreDump(c *gin.Context, db *sql.DB, b models.Backup, targetID int64) {
+	if targetID == 0 {
+		targetID = b.ApplicationID
+	}
+	target, err := scanApplication(db.QueryRow("SELECT "+applicationColumns+" FROM applications WHERE id = ?", targetID))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Target application not found"})
+		return
+	} else if err != nil {
+		log.Println("Error getting application:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+		return
+	}
+	if target.ServiceType != "" && target.ServiceType != b.Source {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot restore a " + b.Source + " dump into a " + target.ServiceType + " database"})
+		return
+	}
+	cli, err := dockerutil.NewClient()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+		return
+	}
+	defer cli.Close()
+
+	job, ctx := jobs.Start(c.Request.Context(), "restore", target.ID)
+	defer func() { job.Done(c.Writer.Status() < http.StatusBadRequest) }()
+	job.Running()
+
+	err = backup.RestoreDump(ctx, cli, b, target)
+	if errors.Is(err, backup.ErrChecksumMismatch) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "job_id": job.ID})
+		return
+	} else if errors.Is(err, backup.ErrNotRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "job_id": job.ID})
+		return
+	} else if err != nil {
+		if abortJob(c, ctx, job) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Restore failed: " + err.Error(), "job_id": job.ID})
+		return
+	}
+	recordAudit(c, db, "database.restore", target.ID, target.Name, "backup "+strconv.FormatInt(b.ID, 10))
+	c.JSON(http.StatusOK, gin.H{"restored": true, "target": target.Name, "target_application_id": target.ID, "job_id": job.ID})
+}
+
+// DeleteBackup removes a backup from storage and history
+func DeleteBackup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b, ok := loadBackup(c, db)
+		if !ok {
+			return
+		}
+		if err := backup.Delete(c, db, b); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete backup: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": true})
+	}
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/databases"
+	"github.com/gakwaya-panel/api/internal/dockerutil"
+	"github.com/gakwaya-panel/api/internal/dotenv"
+	"github.com/gakwaya-panel/api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateDatabaseRequest is the request body for provisioning a managed database
+type CreateDatabaseRequest struct {
+	Name     string `json:"name" binding:"required,min=2,max=64"`
+	Engine   string `json:"engine" binding:"required"`
+	Version  string `json:"version"`
+	Database string `json:"database"`
+	Username string `json:"username"`
+	Project  string `json:"project"`
+	// Publish the database port on the host (allocated from PORT_RANGE)
+	Expose bool `json:"expose"`
+}
+
+// DatabaseInfo is a managed database with its connection details
+type DatabaseInfo struct {
+	ID          int64                `json:"id"`
+	Name        string               `json:"name"`
+	Engine      string               `json:"engine"`
+	Image       string               `json:"image"`
+	Status      string               `json:"status"`
+	ContainerID string               `json:"container_id"`
+	Volume      string               `json:"volume"`
+	Ports       []models.PortMapping `json:"ports,omitempty"`
+	Connection  databases.Connection `json:"connection"`
+	LinkedApps  []ImageApplication   `json:"linked_applications"`
+	CreatedAt   time.Time            `json:"created_at"`
+}
+
+var identifierChars = regexp.MustCompile(`[^a-z0-9_]`)
+
+// identifier turns a name into a database or user identifier
+func identifier(name string) string {
+	id := identifierChars.ReplaceAllString(strings.ToLower(name), "_")
+	if id == "" || (id[0] >= '0' && id[0] <= '9') {
+		id = "db_" + id
+	}
+	return id
+}
+
+// databaseVolume is the named volume holding a managed database's data
+func databaseVolume(name string) string {
+	return name + "-data"
+}
+
+// linkedDatabase reads a managed database by name and returns its connection details
+func linkedDatabase(db *sql.DB, name string) (databases.Connection, databases.Engine, error) {
+	app, err := scanApplication(db.QueryRow("SELECT "+applicationColumns+" FROM applications WHERE name = ?", name))
+	if err == sql.ErrNoRows {
+		return databases.Connection{}, databases.Engine{}, fmt.Errorf("database %q not found", name)
+	} else if err != nil {
+		return databases.Connection{}, databases.Engine{}, err
+	}
+	engine, ok := databases.Lookup(app.ServiceType)
+	if !ok {
+		return databases.Connection{}, databases.Engine{}, fmt.Errorf("application %q is not a managed database", name)
+	}
+	env, err := envMap(app)
+	if err != nil {
+		return databases.Connection{}, databases.Engine{}, err
+	}
+	return engine.Connection(app.Name, env), engine, nil
+}
+
+// validateDatabaseLinks checks the database links of an application request
+func validateDatabaseLinks(db *sql.DB, links []models.DatabaseLink) error {
+	seen := map[string]bool{}
+	for i, link := range links {
+		_, engine, err := linkedDatabase(db, link.Database)
+		if err != nil {
+			return fmt.Errorf("database_links[%d]: %w", i, err)
+		}
+		name := link.Env
+		if name == "" {
+			name = engine.DefaultEnvVar
+		}
+		if !dotenv.ValidKey(name) {
+			return fmt.Errorf("database_links[%d]: invalid env variable %q", i, name)
+		}
+		if seen[name] {
+			return fmt.Errorf("database_links[%d]: %s is set by another link", i, name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// collectDatabaseLinks maps database names to the applications linked to them
+func collectDatabaseLinks(db *sql.DB) (map[string][]ImageApplication, error) {
+	rows, err := db.Query("SELECT id, name, database_links FROM applications")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	usage := map[string][]ImageApplication{}
+	for rows.Next() {
+		var app models.Application
+		var linksStr string
+		if err := rows.Scan(&app.ID, &app.Name, &linksStr); err != nil {
+			return nil, err
+		}
+		if linksStr != "" {
+			_ = json.Unmarshal([]byte(linksStr), &app.DatabaseLinks)
+		}
+		for _, link := range app.DatabaseLinks {
+			usage[link.Database] = append(usage[link.Database], ImageApplication{ID: app.ID, Name: app.Name})
+		}
+	}
+	return usage, rows.Err()
+}
+
+// databaseInfo describes a managed database; the password is masked unless reveal is set
+func databaseInfo(app models.Application, linked []ImageApplication, reveal bool) DatabaseInfo {
+	engine, _ := databases.Lookup(app.ServiceType)
+	env, _ := envMap(app)
+	conn := engine.Connection(app.Name, env)
+	if !reveal && conn.Password != "" {
+		conn.URL = strings.Replace(conn.URL, ":"+conn.Password+"@", ":"+secretMask+"@", 1)
+		conn.Password = secretMask
+	}
+	if linked == nil {
+		linked = []ImageApplication{}
+	}
+	return DatabaseInfo{
+		ID:          app.ID,
+		Name:        app.Name,
+		Engine:      app.ServiceType,
+		Image:       app.Image,
+		Status:      app.Status,
+		ContainerID: app.ContainerID,
+		Volume:      databaseVolume(app.Name),
+		Ports:       app.Ports,
+		Connection:  conn,
+		LinkedApps:  linked,
+		CreatedAt:   app.CreatedAt,
+	}
+}
+
+// CreateDatabase provisions a managed database: it stores an application
+// running the engine's official image with a generated password and a
+// named volume for its data, then deploys it
+func CreateDatabase(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateDatabaseRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		engine, ok := databases.Lookup(req.Engine)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown engine; use one of " + strings.Join(databases.Names(), ", ")})
+			return
+		}
+		// The name is the database's hostname on the panel network
+		if !dockerutil.ValidNetworkName(req.Name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid database name"})
+			return
+		}
+		if err := validateNetworks(req.Project, nil); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		database := req.Database
+		if database == "" {
+			database = identifier(req.Name)
+		}
+		username := req.Username
+		if username == "" {
+			username = "app"
+		}
+		env := engine.NewEnv(username, databases.GeneratePassword(), database)
+
+		envSealed, err := sealJSON(env)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt env: " + err.Error()})
+			return
+		}
+		volumesJSON, _ := json.Marshal([]string{databaseVolume(req.Name) + ":" + engine.DataDir})
+		secretsJSON, _ := json.Marshal(engine.SecretEnv)
+		var published []models.PortMapping
+		if req.Expose {
+			published = []models.PortMapping{{HostPort: 0, ContainerPort: engine.Port, Protocol: "tcp"}}
+		}
+		portsJSON, _ := json.Marshal(published)
+		result, err := db.Exec(
+			"INSERT INTO applications (name, image, env, status, created_at, domain, host_port, container_port, git_url, branch, dockerfile_path, volumes, build_args, ports, project, secrets, service_type) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			req.Name, engine.ImageRef(req.Version), envSealed, "created", time.Now(), "", 0, engine.Port, "", "", "", string(volumesJSON), "", string(portsJSON), req.Project, string(secretsJSON), engine.Name,
+		)
+		if err != nil {
+			log.Println("Error creating database:", err)
+			c.JSON(http.StatusConflict, gin.H{"error": "Name already exists or DB error"})
+			return
+		}
+		id, _ := result.LastInsertId()
+		app, err := scanApplication(db.QueryRow("SELECT "+applicationColumns+" FROM applications WHERE id = ?", id))
+		if err != nil {
+			log.Println("Error getting application:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		// The row stays if the first deploy fails; point the client at it
+		c.Header("Location", fmt.Sprintf("/api/databases/%d", id))
+		info := databaseInfo(app, nil, false)
+		deployImage(c, db, app, gin.H{"id": id, "database": info})
+	}
+}
+
+// ListDatabases returns the managed databases with masked connection details
+func ListDatabases(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rows, err := db.Query("SELECT " + applicationColumns + " FROM applications WHERE service_type != '' ORDER BY id DESC")
+		if err != nil {
+			log.Println("Error listing databases:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		defer rows.Close()
+		var apps []models.Application
+		for rows.Next() {
+			app, err := scanApplication(rows)
+			if err != nil {
+				log.Println("Error scanning application:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+				return
+			}
+			apps = append(apps, app)
+		}
+		links, err := collectDatabaseLinks(db)
+		if err != nil {
+			log.Println("Error resolving database links:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		result := []DatabaseInfo{}
+		for _, app := range apps {
+			result = append(result, databaseInfo(app, links[app.Name], false))
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// GetDatabase returns a managed database; ?reveal=true includes the password
+func GetDatabase(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app, ok := loadApplication(c, db)
+		if !ok {
+			return
+		}
+		if app.ServiceType == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Application is not a managed database"})
+			return
+		}
+		links, err := collectDatabaseLinks(db)
+		if err != nil {
+			log.Println("Error resolving database links:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		reveal := c.Query("reveal") == "true"
+		if reveal {
+			recordAudit(c, db, "database.reveal", app.ID, app.Name, "")
+		}
+		c.JSON(http.StatusOK, databaseInfo(app, links[app.Name], reveal))
+	}
+}
+
+// ListDatabaseEngines returns the engines that can be provisioned
+func ListDatabaseEngines() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result := []gin.H{}
+		for _, name := range databases.Names() {
+			e, _ := databases.Lookup(name)
+			result = append(result, gin.H{
+				"name":            e.Name,
+				"image":           e.ImageRef(""),
+				"port":            e.Port,
+				"default_env_var": e.DefaultEnvVar,
+			})
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
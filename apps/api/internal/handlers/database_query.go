@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/gakwaya-panel/api/internal/databases"
+	"github.com/gakwaya-panel/api/internal/dbquery"
+	"github.com/gakwaya-panel/api/internal/dockerutil"
+	"github.com/gin-gonic/gin"
+)
+
+// DatabaseQueryRequest is the request body for the SQL console.
+// ReadOnly defaults to true; MaxRows and TimeoutSeconds are capped by
+// SQL_CONSOLE_MAX_ROWS and SQL_CONSOLE_TIMEOUT.
+type DatabaseQueryRequest struct {
+	Query          string `json:"query" binding:"required"`
+	ReadOnly       *bool  `json:"read_only"`
+	MaxRows        int    `json:"max_rows" binding:"min=0"`
+	TimeoutSeconds int    `json:"timeout_seconds" binding:"min=0"`
+}
+
+// queryMaxRows returns SQL_CONSOLE_MAX_ROWS, defaulting to 1000
+func queryMaxRows() int {
+	if v, err := strconv.Atoi(os.Getenv("SQL_CONSOLE_MAX_ROWS")); err == nil && v > 0 {
+		return v
+	}
+	return 1000
+}
+
+// queryTimeout returns SQL_CONSOLE_TIMEOUT (a Go duration), defaulting to 30 seconds
+func queryTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SQL_CONSOLE_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return 30 * time.Second
+}
+
+// containerAddress returns the IP of a running database container, preferring the panel network
+func containerAddress(ctx context.Context, cli *client.Client, containerID string) (string, error) {
+	if containerID == "" {
+		return "", errors.New("database is not deployed")
+	}
+	return dockerutil.ContainerIP(ctx, cli, containerID)
+}
+
+// QueryDatabase runs one SQL statement against a managed PostgreSQL or MySQL
+// database with the credentials in its env. Queries run read-only unless
+// read_only is false, and every query is recorded in the audit log.
+func QueryDatabase(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app, ok := loadApplication(c, db)
+		if !ok {
+			return
+		}
+		var req DatabaseQueryRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if strings.TrimSpace(req.Query) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Query is empty"})
+			return
+		}
+		engine, ok := databases.Lookup(app.ServiceType)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Application is not a managed database"})
+			return
+		}
+		if !dbquery.Supported(engine.Name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The query console supports postgres and mysql databases"})
+			return
+		}
+		opts := dbquery.Options{MaxRows: queryMaxRows(), Timeout: queryTimeout(), ReadOnly: true}
+		if req.ReadOnly != nil {
+			opts.ReadOnly = *req.ReadOnly
+		}
+		if req.MaxRows > 0 && req.MaxRows < opts.MaxRows {
+			opts.MaxRows = req.MaxRows
+		}
+		if t := time.Duration(req.TimeoutSeconds) * time.Second; t > 0 && t < opts.Timeout {
+			opts.Timeout = t
+		}
+
+		env, err := envMap(app)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid env format"})
+			return
+		}
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		host, err := containerAddress(c, cli, app.ContainerID)
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		conn := engine.Connection(host, env)
+
+		mode := "read-only"
+		if !opts.ReadOnly {
+			mode = "read-write"
+		}
+		result, err := dbquery.Run(c.Request.Context(), conn, req.Query, opts)
+		if err != nil {
+			recordAudit(c, db, "database.query", app.ID, app.Name, fmt.Sprintf("%s, failed: %s", mode, req.Query))
+			status := http.StatusBadRequest
+			if errors.Is(err, dbquery.ErrConnect) {
+				status = http.StatusBadGateway
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		summary := strconv.Itoa(result.RowCount) + " rows"
+		if result.RowsAffected != nil {
+			summary = strconv.FormatInt(*result.RowsAffected, 10) + " rows affected"
+		}
+		recordAudit(c, db, "database.query", app.ID, app.Name, fmt.Sprintf("%s, %s: %s", mode, summary, req.Query))
+		c.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+	"github.com/gakwaya-panel/api/internal/dockerutil"
+	"github.com/gakwaya-panel/api/internal/jobs"
+	"github.com/gakwaya-panel/api/internal/models"
+	"github.com/gakwaya-panel/api/internal/ports"
+	"github.com/gin-gonic/gin"
+)
+
+// containerSpec describes the container an application runs in
+type containerSpec struct {
+	Name         string
+	Image        string
+	Env          []string
+	Cmd          []string
+	Mounts       []mount.Mount
+	ExposedPorts nat.PortSet
+	PortBindings nat.PortMap
+	Networks     []models.NetworkAttachment
+}
+
+func (s containerSpec) config() *container.Config {
+	return &container.Config{
+		Image:        s.Image,
+		Env:          s.Env,
+		Cmd:          s.Cmd,
+		ExposedPorts: s.ExposedPorts,
+	}
+}
+
+func (s containerSpec) hostConfig() *container.HostConfig {
+	return &container.HostConfig{
+		Mounts:       s.Mounts,
+		PortBindings: s.PortBindings,
+	}
+}
+
+// createContainer creates a container attached to networks, creating missing
+// networks first. The Docker API only takes one network at creation, so the
+// others are connected right after.
+func createContainer(ctx context.Context, cli *client.Client, name string, cfg *container.Config, hostCfg *container.HostConfig, networks []models.NetworkAttachment) (string, error) {
+	var netCfg *network.NetworkingConfig
+	if len(networks) > 0 {
+		for _, n := range networks {
+			if err := dockerutil.EnsureNetwork(ctx, cli, n.Name, map[string]string{"gakwayapanel.managed": "true"}); err != nil {
+				return "", fmt.Errorf("network %s: %w", n.Name, err)
+			}
+		}
+		netCfg = &network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{
+			networks[0].Name: {Aliases: networks[0].Aliases},
+		}}
+	}
+	created, err := cli.ContainerCreate(ctx, cfg, hostCfg, netCfg, nil, name)
+	if err != nil {
+		return "", err
+	}
+	for i, n := range networks {
+		if i == 0 {
+			continue
+		}
+		if err := cli.NetworkConnect(ctx, n.Name, created.ID, &network.EndpointSettings{Aliases: n.Aliases}); err != nil {
+			_ = cli.ContainerRemove(context.Background(), created.ID, types.ContainerRemoveOptions{Force: true})
+			return "", fmt.Errorf("connect network %s: %w", n.Name, err)
+		}
+	}
+	return created.ID, nil
+}
+
+// appNetworks returns the networks an application's container joins: the
+// panel network (for the proxy), its project's private network and any named
+// networks it lists. The application name is an alias on each of them.
+func appNetworks(app models.Application) []models.NetworkAttachment {
+	networks := []models.NetworkAttachment{{Name: dockerutil.PanelNetwork(), Aliases: []string{app.Name}}}
+	if app.Project != "" {
+		networks = append(networks, models.NetworkAttachment{Name: dockerutil.ProjectNetwork(app.Project), Aliases: []string{app.Name}})
+	}
+	for _, n := range app.Networks {
+		if n.Name == dockerutil.PanelNetwork() || (app.Project != "" && n.Name == dockerutil.ProjectNetwork(app.Project)) {
+			continue
+		}
+		networks = append(networks, models.NetworkAttachment{Name: n.Name, Aliases: append([]string{app.Name}, n.Aliases...)})
+	}
+	return networks
+}
+
+// appPortMappings returns the application's published ports: its ports list
+// or, for applications created before it existed, the host_port/container_port pair
+func appPortMappings(app models.Application) (mappings []models.PortMapping, stored bool) {
+	if len(app.Ports) > 0 {
+		return app.Ports, true
+	}
+	if app.Port > 0 {
+		return []models.PortMapping{{HostPort: app.Port, ContainerPort: app.ContainerPort}}, false
+	}
+	return nil, false
+}
+
+// publishPorts reserves the application's host ports and returns the port
+// settings for its container. Mappings without a container port use the
+// lowest TCP port the image exposes, or 80.
+func publishPorts(ctx context.Context, cli *client.Client, db *sql.DB, app models.Application, image string) ([]models.PortMapping, nat.PortSet, nat.PortMap, error) {
+	exposed := nat.PortSet{}
+	bindings := nat.PortMap{}
+	mappings, stored := appPortMappings(app)
+	if len(mappings) == 0 {
+		return nil, exposed, bindings, nil
+	}
+	mappings, err := ports.Allocate(ctx, cli, db, app.ID, mappings, stored)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defaultPort := 80
+	if info, _, err := cli.ImageInspectWithRaw(ctx, image); err == nil && info.Config != nil {
+		lowest := 0
+		for p := range info.Config.ExposedPorts {
+			if p.Proto() == "tcp" && (lowest == 0 || p.Int() < lowest) {
+				lowest = p.Int()
+			}
+		}
+		if lowest > 0 {
+			defaultPort = lowest
+		}
+	}
+	for i, m := range mappings {
+		if m.ContainerPort == 0 {
+			mappings[i].ContainerPort = defaultPort
+		}
+		port, err := nat.NewPort(m.Protocol, strconv.Itoa(mappings[i].ContainerPort))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		exposed[port] = struct{}{}
+		bindings[port] = append(bindings[port], nat.PortBinding{HostIP: m.HostIP, HostPort: strconv.Itoa(m.HostPort)})
+	}
+	return mappings, exposed, bindings, nil
+}
+
+// respondPortError answers a deploy whose ports could not be reserved
+func respondPortError(c *gin.Context, err error) {
+	var conflict *ports.ConflictError
+	switch {
+	case errors.As(err, &conflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "port": conflict.Mapping, "owner": conflict.Owner})
+	case errors.Is(err, ports.ErrRangeExhausted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "range": ports.ConfiguredRange()})
+	default:
+		log.Println("Error allocating ports:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to allocate ports: " + err.Error()})
+	}
+}
+
+// rolloutResult is the outcome of a successful rollout
+type rolloutResult struct {
+	ContainerID string
+	HooksError  string
+}
+
+// rollout runs the application's release command, swaps its container for
+// one built from spec and runs the post-deploy hooks. All output is appended
+// to deployLog. A failing release command leaves the old container untouched.
+func rollout(ctx context.Context, cli *client.Client, app models.Application, spec containerSpec, deployLog *strings.Builder) (rolloutResult, error) {
+	var result rolloutResult
+	if app.ReleaseCommand != "" {
+		fmt.Fprintf(deployLog, "\n--- release command: %s ---\n", app.ReleaseCommand)
+		output, err := runReleaseCommand(ctx, cli, spec, app.ReleaseCommand)
+		deployLog.WriteString(output)
+		if err != nil {
+			fmt.Fprintf(deployLog, "release failed: %v\n", err)
+			return result, err
+		}
+	}
+
+	containerID, err := replaceContainer(ctx, cli, app.ContainerID, spec)
+	if err != nil {
+		fmt.Fprintf(deployLog, "\ncontainer switch failed: %v\n", err)
+		return result, err
+	}
+	result.ContainerID = containerID
+
+	if len(app.PostDeployHooks) > 0 {
+		deployLog.WriteString("\n--- post-deploy hooks ---\n")
+		output, err := runPostDeployHooks(ctx, cli, containerID, app.PostDeployHooks)
+		deployLog.WriteString(output)
+		if err != nil {
+			log.Printf("[WARN] Application %d: %v", app.ID, err)
+			result.HooksError = err.Error()
+		}
+	}
+	return result, nil
+}
+
+// respondRolloutError answers a request whose rollout failed
+func respondRolloutError(c *gin.Context, ctx context.Context, job *jobs.Job, err error, deployLog string) {
+	if abortJob(c, ctx, job) {
+		return
+	}
+	var relErr *releaseError
+	if errors.As(err, &relErr) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":      "Release command failed; previous version kept",
+			"exit_code":  relErr.ExitCode,
+			"deploy_log": deployLog,
+			"job_id":     job.ID,
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start container: " + err.Error(), "job_id": job.ID})
+}
+
+// releaseError is returned when the release command exits non-zero
+type releaseError struct {
+	ExitCode int64
+}
+
+func (e *releaseError) Error() string {
+	return fmt.Sprintf("release command exited with code %d", e.ExitCode)
+}
+
+// runReleaseCommand runs command in a one-off container built from spec (same
+// image, env and volumes, no published ports) and returns its output
+func runReleaseCommand(ctx context.Context, cli *client.Client, spec containerSpec, command string) (string, error) {
+	cfg := spec.config()
+	cfg.Cmd = []string{"/bin/sh", "-c", command}
+	cfg.ExposedPorts = nil
+	hostCfg := spec.hostConfig()
+	hostCfg.PortBindings = nil
+	// Same networks, but without the aliases the live container answers to
+	var networks []models.NetworkAttachment
+	for _, n := range spec.Networks {
+		networks = append(networks, models.NetworkAttachment{Name: n.Name})
+	}
+
+	name := fmt.Sprintf("%s-release-%d", spec.Name, time.Now().Unix())
+	id, err := createContainer(ctx, cli, name, cfg, hostCfg, networks)
+	if err != nil {
+		return "", err
+	}
+	// Use a fresh context so the helper is removed even after a cancel
+	defer cli.ContainerRemove(context.Background(), id, types.ContainerRemoveOptions{Force: true})
+
+	waitCh, errCh := cli.ContainerWait(ctx, id, container.WaitConditionNextExit)
+	if err := cli.ContainerStart(ctx, id, types.ContainerStartOptions{}); err != nil {
+		return "", err
+	}
+	var exitCode int64
+	select {
+	case res := <-waitCh:
+		exitCode = res.StatusCode
+	case err := <-errCh:
+		return "", err
+	}
+
+	output := containerOutput(ctx, cli, id)
+	if exitCode != 0 {
+		return output, &releaseError{ExitCode: exitCode}
+	}
+	return output, nil
+}
+
+// containerOutput returns the demultiplexed stdout/stderr of a container
+func containerOutput(ctx context.Context, cli *client.Client, id string) string {
+	reader, err := cli.ContainerLogs(ctx, id, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return ""
+	}
+	defer reader.Close()
+	var buf bytes.Buffer
+	_, _ = stdcopy.StdCopy(&buf, &buf, reader)
+	return buf.String()
+}
+
+// replaceContainer swaps oldID for a new container built from spec. The old
+// container is renamed to free its name and stopped right before the new one
+// starts so host ports are free; if the new one cannot be created or started,
+// the old one is restored.
+func replaceContainer(ctx context.Context, cli *client.Client, oldID string, spec containerSpec) (string, error) {
+	old := ""
+	if oldID != "" {
+		if info, err := cli.ContainerInspect(ctx, oldID); err == nil {
+			old = info.ID
+		}
+	}
+	if info, err := cli.ContainerInspect(ctx, spec.Name); err == nil && info.ID != old {
+		return "", fmt.Errorf("container name %s is already used by container %s", spec.Name, info.ID[:12])
+	}
+
+	var oldName string
+	wasRunning := false
+	if old != "" {
+		info, _ := cli.ContainerInspect(ctx, old)
+		oldName = strings.TrimPrefix(info.Name, "/")
+		wasRunning = info.State != nil && info.State.Running
+		if err := cli.ContainerRename(ctx, old, fmt.Sprintf("%s-previous-%d", spec.Name, time.Now().Unix())); err != nil {
+			return "", fmt.Errorf("rename previous container: %w", err)
+		}
+	}
+	restore := func() {
+		if old == "" {
+			return
+		}
+		bg := context.Background()
+		if err := cli.ContainerRename(bg, old, oldName); err != nil {
+			log.Printf("[WARN] Could not restore name of container %s: %v", old, err)
+		}
+		if wasRunning {
+			if err := cli.ContainerStart(bg, old, types.ContainerStartOptions{}); err != nil {
+				log.Printf("[WARN] Could not restart previous container %s: %v", old, err)
+			}
+		}
+	}
+
+	createdID, err := createContainer(ctx, cli, spec.Name, spec.config(), spec.hostConfig(), spec.Networks)
+	if err != nil {
+		restore()
+		return "", fmt.Errorf("create container: %w", err)
+	}
+	if old != "" && wasRunning {
+		if err := cli.ContainerStop(ctx, old, container.StopOptions{}); err != nil {
+			log.Printf("[WARN] Could not stop previous container %s: %v", old, err)
+		}
+	}
+	if err := cli.ContainerStart(ctx, createdID, types.ContainerStartOptions{}); err != nil {
+		_ = cli.ContainerRemove(context.Background(), createdID, types.ContainerRemoveOptions{Force: true})
+		restore()
+		return "", fmt.Errorf("start container: %w", err)
+	}
+	if old != "" {
+		if err := cli.ContainerRemove(context.Background(), old, types.ContainerRemoveOptions{Force: true}); err != nil {
+			log.Printf("[WARN] Could not remove previous container %s: %v", old, err)
+		}
+	}
+	return createdID, nil
+}
+
+// runPostDeployHooks executes each hook with /bin/sh -c inside the new
+// container and returns the combined output. Failures are reported in the
+// output and the error but do not undo the deploy.
+func runPostDeployHooks(ctx context.Context, cli *client.Client, containerID string, hooks []string) (string, error) {
+	var out strings.Builder
+	var failed []string
+	for _, hook := range hooks {
+		fmt.Fprintf(&out, "$ %s\n", hook)
+		output, exitCode, err := execInContainer(ctx, cli, containerID, []string{"/bin/sh", "-c", hook})
+		out.WriteString(output)
+		switch {
+		case err != nil:
+			fmt.Fprintf(&out, "hook error: %v\n", err)
+			failed = append(failed, hook)
+		case exitCode != 0:
+			fmt.Fprintf(&out, "hook exited with code %d\n", exitCode)
+			failed = append(failed, hook)
+		}
+	}
+	if len(failed) > 0 {
+		return out.String(), fmt.Errorf("%d post-deploy hook(s) failed", len(failed))
+	}
+	return out.String(), nil
+}
+
+// execInContainer runs cmd in a running container and returns its output and exit code
+func execInContainer(ctx context.Context, cli *client.Client, containerID string, cmd []string) (string, int, error) {
+	created, err := cli.ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	hijack, err := cli.ContainerExecAttach(ctx, created.ID, types.ExecStartCheck{})
+	if err != nil {
+		return "", 0, err
+	}
+	defer hijack.Close()
+	var buf bytes.Buffer
+	_, _ = stdcopy.StdCopy(&buf, &buf, hijack.Reader)
+	inspect, err := cli.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return buf.String(), 0, err
+	}
+	return buf.String(), inspect.ExitCode, nil
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gakwaya-panel/api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// ListDeployments returns the deployment history of an application, newest first.
+// Logs are omitted; fetch a single deployment to read its log.
+func ListDeployments(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+		rows, err := db.Query("SELECT id, application_id, image, container_id, status, created_at FROM deployments WHERE application_id = ? ORDER BY id DESC LIMIT 100", id)
+		if err != nil {
+			log.Println("Error listing deployments:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		defer rows.Close()
+		deployments := []models.Deployment{}
+		for rows.Next() {
+			var d models.Deployment
+			var containerID sql.NullString
+			if err := rows.Scan(&d.ID, &d.ApplicationID, &d.Image, &containerID, &d.Status, &d.CreatedAt); err != nil {
+				log.Println("Error scanning deployment:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+				return
+			}
+			d.ContainerID = containerID.String
+			deployments = append(deployments, d)
+		}
+		c.JSON(http.StatusOK, deployments)
+	}
+}
+
+// GetDeployment returns a single deployment including its build/release/hook log
+func GetDeployment(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+		deploymentID, err := strconv.Atoi(c.Param("deployment_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+			return
+		}
+		var d models.Deployment
+		var containerID, deployLog sql.NullString
+		err = db.QueryRow("SELECT id, application_id, image, container_id, status, log, created_at FROM deployments WHERE id = ? AND application_id = ?", deploymentID, id).Scan(
+			&d.ID, &d.ApplicationID, &d.Image, &containerID, &d.Status, &deployLog, &d.CreatedAt,
+		)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Deployment not found"})
+			return
+		} else if err != nil {
+			log.Println("Error getting deployment:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		d.ContainerID = containerID.String
+		d.Log = deployLog.String
+		c.JSON(http.StatusOK, d)
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/gakwaya-panel/api/internal/dockerutil"
+	"github.com/gakwaya-panel/api/internal/proxy"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
@@ -111,7 +113,7 @@ func RunDockerContainer(db *sql.DB) gin.HandlerFunc {
 }
 
 // StopDockerContainer stops a running container by ID
-func StopDockerContainer() gin.HandlerFunc {
+func StopDockerContainer(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 		if id == "" {
@@ -128,12 +130,13 @@ func StopDockerContainer() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stop container: " + err.Error()})
 			return
 		}
+		proxy.Refresh(db)
 		c.JSON(http.StatusOK, gin.H{"stopped": true, "id": id})
 	}
 }
 
 // RemoveDockerContainer removes a container by ID
-func RemoveDockerContainer() gin.HandlerFunc {
+func RemoveDockerContainer(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 		if id == "" {
@@ -150,11 +153,12 @@ func RemoveDockerContainer() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove container: " + err.Error()})
 			return
 		}
+		proxy.Refresh(db)
 		c.JSON(http.StatusOK, gin.H{"removed": true, "id": id})
 	}
 }
 
-// GetDockerContainerLogs fetches logs for a given container by ID
+// GetDockerContainerLogs fetches the last 100 log lines of a container by ID
 func GetDockerContainerLogs() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
@@ -168,24 +172,20 @@ func GetDockerContainerLogs() gin.HandlerFunc {
 			return
 		}
 		defer cli.Close()
+		info, err := cli.ContainerInspect(c, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch logs: " + err.Error()})
+			return
+		}
 		reader, err := cli.ContainerLogs(c, id, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true, Tail: "100"})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch logs: " + err.Error()})
 			return
 		}
 		defer reader.Close()
-		buf := make([]byte, 4096)
-		logs := ""
-		for {
-			n, err := reader.Read(buf)
-			if n > 0 {
-				logs += string(buf[:n])
-			}
-			if err != nil {
-				break
-			}
-		}
-		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(logs))
+		var logs bytes.Buffer
+		_ = demuxLogs(&logs, &logs, reader, info.Config != nil && info.Config.Tty)
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", logs.Bytes())
 	}
 }
 
@@ -259,7 +259,7 @@ func DockerSystemInfo() gin.HandlerFunc {
 }
 
 // RestartDockerContainer restarts a container by ID
-func RestartDockerContainer() gin.HandlerFunc {
+func RestartDockerContainer(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 		if id == "" {
@@ -276,6 +276,7 @@ func RestartDockerContainer() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restart container: " + err.Error()})
 			return
 		}
+		proxy.Refresh(db)
 		c.JSON(http.StatusOK, gin.H{"restarted": true, "id": id})
 	}
 }
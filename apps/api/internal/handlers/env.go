@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/gakwaya-panel/api/internal/models"
+	"github.com/gakwaya-panel/api/internal/secrets"
+)
+
+// secretMask replaces secret values in API responses. Sending it back in an
+// update keeps the stored value.
+const secretMask = "********"
+
+// sealJSON marshals v and encrypts it for an encrypted column
+func sealJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return secrets.Encrypt(string(data))
+}
+
+// envMap decodes the env JSON of an application
+func envMap(app models.Application) (map[string]string, error) {
+	env := map[string]string{}
+	if app.Env == "" {
+		return env, nil
+	}
+	if err := json.Unmarshal([]byte(app.Env), &env); err != nil {
+		return nil, err
+	}
+	if env == nil {
+		env = map[string]string{}
+	}
+	return env, nil
+}
+
+// envList formats env as KEY=value entries for a container
+func envList(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for k, v := range env {
+		list = append(list, k+"="+v)
+	}
+	return list
+}
+
+// maskSecrets hides the values of the application's secret env vars and build args
+func maskSecrets(app *models.Application) {
+	if len(app.Secrets) == 0 {
+		return
+	}
+	env, err := envMap(*app)
+	if err == nil {
+		for _, name := range app.Secrets {
+			if _, ok := env[name]; ok {
+				env[name] = secretMask
+			}
+		}
+		data, _ := json.Marshal(env)
+		app.Env = string(data)
+	}
+	if app.BuildArgs != nil {
+		args := make(map[string]string, len(app.BuildArgs))
+		for k, v := range app.BuildArgs {
+			args[k] = v
+		}
+		for _, name := range app.Secrets {
+			if _, ok := args[name]; ok {
+				args[name] = secretMask
+			}
+		}
+		app.BuildArgs = args
+	}
+}
+
+// keepMaskedSecrets swaps masked secret values in an update for the stored
+// ones, so a client can send back what it read without erasing secrets
+func keepMaskedSecrets(db *sql.DB, id int, req *ApplicationRequest) error {
+	app, err := scanApplication(db.QueryRow("SELECT "+applicationColumns+" FROM applications WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	stored, err := envMap(app)
+	if err != nil {
+		return err
+	}
+	secret := map[string]bool{}
+	for _, name := range app.Secrets {
+		secret[name] = true
+	}
+	for k, v := range req.Env {
+		if v == secretMask && secret[k] {
+			req.Env[k] = stored[k]
+		}
+	}
+	for k, v := range req.BuildArgs {
+		if v == secretMask && secret[k] {
+			req.BuildArgs[k] = app.BuildArgs[k]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gakwaya-panel/api/internal/dotenv"
+	"github.com/gakwaya-panel/api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// maxEnvFileSize caps an imported dotenv file
+const maxEnvFileSize = 1 << 20
+
+// EnvChange is one line of an import diff; secret values are masked
+type EnvChange struct {
+	Key    string  `json:"key"`
+	Change string  `json:"change"` // added, changed or removed
+	Old    *string `json:"old,omitempty"`
+	New    *string `json:"new,omitempty"`
+}
+
+// loadApplication reads the application in :id, answering the request on failure
+func loadApplication(c *gin.Context, db *sql.DB) (models.Application, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return models.Application{}, false
+	}
+	app, err := scanApplication(db.QueryRow("SELECT "+applicationColumns+" FROM applications WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return app, false
+	} else if err != nil {
+		log.Println("Error getting application:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+		return app, false
+	}
+	return app, true
+}
+
+// readEnvFile reads a dotenv file sent as the multipart field "file" or as the raw body
+func readEnvFile(c *gin.Context) (string, error) {
+	var r io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			return "", errors.New("multipart body needs a \"file\" field")
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		r = f
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxEnvFileSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxEnvFileSize {
+		return "", errors.New("env file is larger than 1 MiB")
+	}
+	return string(data), nil
+}
+
+// diffEnv lists the differences between two env maps, masking secret values
+func diffEnv(old, updated map[string]string, secret map[string]bool) ([]EnvChange, int) {
+	keys := map[string]bool{}
+	for k := range old {
+		keys[k] = true
+	}
+	for k := range updated {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	show := func(k, v string) *string {
+		if secret[k] {
+			v = secretMask
+		}
+		return &v
+	}
+	changes := []EnvChange{}
+	unchanged := 0
+	for _, k := range sorted {
+		ov, inOld := old[k]
+		nv, inNew := updated[k]
+		switch {
+		case inOld && !inNew:
+			changes = append(changes, EnvChange{Key: k, Change: "removed", Old: show(k, ov)})
+		case !inOld && inNew:
+			changes = append(changes, EnvChange{Key: k, Change: "added", New: show(k, nv)})
+		case ov != nv:
+			changes = append(changes, EnvChange{Key: k, Change: "changed", Old: show(k, ov), New: show(k, nv)})
+		default:
+			unchanged++
+		}
+	}
+	return changes, unchanged
+}
+
+// ImportApplicationEnv imports a dotenv file into an application's env.
+// ?mode=merge (default) overlays it on the current env, ?mode=replace drops
+// variables missing from the file, and ?dry_run=true only returns the diff.
+func ImportApplicationEnv(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app, ok := loadApplication(c, db)
+		if !ok {
+			return
+		}
+		mode := c.DefaultQuery("mode", "merge")
+		if mode != "merge" && mode != "replace" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be merge or replace"})
+			return
+		}
+		dryRun := c.Query("dry_run") == "true"
+		data, err := readEnvFile(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		own, err := envMap(app)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid env format"})
+			return
+		}
+		// ${VAR} may refer to the current env, including env groups and
+		// database links
+		current, _, currentSecret, err := effectiveEnv(db, app, own)
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		parsed, err := dotenv.Parse(data, func(name string) (string, bool) {
+			v, ok := current[name]
+			return v, ok
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid env file: " + err.Error()})
+			return
+		}
+
+		secret := map[string]bool{}
+		for _, name := range app.Secrets {
+			secret[name] = true
+		}
+		// A value built from a secret of any source is a secret too
+		masked := map[string]bool{}
+		for k := range secret {
+			masked[k] = true
+		}
+		var promoted []string
+		for _, k := range parsed.Keys {
+			for _, ref := range parsed.Refs[k] {
+				if currentSecret[ref] {
+					masked[k] = true
+					if !secret[k] {
+						promoted = append(promoted, k)
+					}
+					break
+				}
+			}
+		}
+		updated := map[string]string{}
+		if mode == "merge" {
+			for k, v := range own {
+				updated[k] = v
+			}
+		}
+		for k, v := range parsed.Env {
+			// A redacted export imported back keeps the stored secret
+			if v == secretMask && secret[k] {
+				if stored, ok := own[k]; ok {
+					v = stored
+				}
+			}
+			updated[k] = v
+		}
+		changes, unchanged := diffEnv(own, updated, masked)
+		unresolved := parsed.Unresolved
+		if unresolved == nil {
+			unresolved = []string{}
+		}
+		if !dryRun && len(changes) > 0 {
+			envSealed, err := sealJSON(updated)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt env: " + err.Error()})
+				return
+			}
+			query, args := "UPDATE applications SET env = ? WHERE id = ?", []any{envSealed, app.ID}
+			if len(promoted) > 0 {
+				secretsJSON, _ := json.Marshal(append(app.Secrets, promoted...))
+				query, args = "UPDATE applications SET env = ?, secrets = ? WHERE id = ?", []any{envSealed, string(secretsJSON), app.ID}
+			}
+			if _, err := db.Exec(query, args...); err != nil {
+				log.Println("Error updating application env:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+				return
+			}
+			recordAudit(c, db, "env.import", app.ID, app.Name, mode+", "+strconv.Itoa(len(changes))+" changes")
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"applied":    !dryRun,
+			"mode":       mode,
+			"changes":    changes,
+			"unchanged":  unchanged,
+			"unresolved": unresolved,
+		})
+	}
+}
+
+// ExportApplicationEnv returns an application's env as a dotenv file.
+// Secrets are redacted unless ?redact=false; ?effective=true includes env groups.
+func ExportApplicationEnv(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app, ok := loadApplication(c, db)
+		if !ok {
+			return
+		}
+		env, err := envMap(app)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid env format"})
+			return
+		}
+		secret := map[string]bool{}
+		for _, name := range app.Secrets {
+			secret[name] = true
+		}
+		if c.Query("effective") == "true" {
+			env, _, secret, err = effectiveEnv(db, app, env)
+			if err != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		redact := c.DefaultQuery("redact", "true") != "false"
+		if !redact {
+			secret = nil
+			recordAudit(c, db, "env.export", app.ID, app.Name, "secrets included")
+		}
+		c.Header("Content-Disposition", `attachment; filename="`+app.Name+`.env"`)
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(dotenv.Format(env, secret, secretMask)))
+	}
+}
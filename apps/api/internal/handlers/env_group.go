@@ -0,0 +1,475 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/models"
+	"github.com/gakwaya-panel/api/internal/secrets"
+	"github.com/gin-gonic/gin"
+)
+
+// EnvGroupRequest is the request body for creating or updating an env group
+type EnvGroupRequest struct {
+	Name        string            `json:"name" binding:"required,min=2,max=64"`
+	Description string            `json:"description"`
+	Env         map[string]string `json:"env"`
+	Secrets     []string          `json:"secrets"`
+}
+
+// EnvGroupApplication is an application attached to an env group and
+// whether it was deployed before the group's last change
+type EnvGroupApplication struct {
+	ID            int64      `json:"id"`
+	Name          string     `json:"name"`
+	DeployedAt    *time.Time `json:"deployed_at,omitempty"`
+	NeedsRedeploy bool       `json:"needs_redeploy"`
+}
+
+var envGroupNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// envGroupColumns lists the columns read by scanEnvGroup, in order
+const envGroupColumns = "id, name, description, env, secrets, created_at, updated_at"
+
+// scanEnvGroup reads an env group selected with envGroupColumns
+func scanEnvGroup(row rowScanner) (models.EnvGroup, error) {
+	var g models.EnvGroup
+	var envStr, secretsStr string
+	if err := row.Scan(&g.ID, &g.Name, &g.Description, &envStr, &secretsStr, &g.CreatedAt, &g.UpdatedAt); err != nil {
+		return g, err
+	}
+	envStr, err := secrets.Decrypt(envStr)
+	if err != nil {
+		return g, err
+	}
+	if envStr != "" {
+		_ = json.Unmarshal([]byte(envStr), &g.Env)
+	}
+	if g.Env == nil {
+		g.Env = map[string]string{}
+	}
+	if secretsStr != "" {
+		_ = json.Unmarshal([]byte(secretsStr), &g.Secrets)
+	}
+	return g, nil
+}
+
+// maskGroupSecrets hides the values of a group's secret variables
+func maskGroupSecrets(g *models.EnvGroup) {
+	for _, name := range g.Secrets {
+		if _, ok := g.Env[name]; ok {
+			g.Env[name] = secretMask
+		}
+	}
+}
+
+// loadEnvGroup reads the env group named by the :id path parameter, answering the request on failure
+func loadEnvGroup(c *gin.Context, db *sql.DB) (models.EnvGroup, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return models.EnvGroup{}, false
+	}
+	g, err := scanEnvGroup(db.QueryRow("SELECT "+envGroupColumns+" FROM env_groups WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Env group not found"})
+		return g, false
+	} else if err != nil {
+		log.Println("Error getting env group:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+		return g, false
+	}
+	return g, true
+}
+
+// envGroupsByName reads the named env groups
+func envGroupsByName(db *sql.DB, names []string) (map[string]models.EnvGroup, error) {
+	groups := map[string]models.EnvGroup{}
+	for _, name := range names {
+		if _, ok := groups[name]; ok {
+			continue
+		}
+		g, err := scanEnvGroup(db.QueryRow("SELECT "+envGroupColumns+" FROM env_groups WHERE name = ?", name))
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		groups[name] = g
+	}
+	return groups, nil
+}
+
+// validateEnvGroups checks that the env groups of an application request exist
+func validateEnvGroups(db *sql.DB, names []string) error {
+	groups, err := envGroupsByName(db, names)
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			return fmt.Errorf("env group %q is listed twice", name)
+		}
+		seen[name] = true
+		if _, ok := groups[name]; !ok {
+			return fmt.Errorf("env group %q not found", name)
+		}
+	}
+	return nil
+}
+
+// effectiveEnv merges the application's env groups in order, then the URLs
+// of its linked databases, and then own, the application's env, on top.
+// sources names where each variable came from ("app", "group:<name>" or
+// "database:<name>") and secret marks the ones to mask.
+func effectiveEnv(db *sql.DB, app models.Application, own map[string]string) (env, sources map[string]string, secret map[string]bool, err error) {
+	groups, err := envGroupsByName(db, app.EnvGroups)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	env, sources, secret = map[string]string{}, map[string]string{}, map[string]bool{}
+	for _, name := range app.EnvGroups {
+		g, ok := groups[name]
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("env group %q not found", name)
+		}
+		groupSecrets := map[string]bool{}
+		for _, s := range g.Secrets {
+			groupSecrets[s] = true
+		}
+		for k, v := range g.Env {
+			env[k], sources[k], secret[k] = v, "group:"+name, groupSecrets[k]
+		}
+	}
+	for _, link := range app.DatabaseLinks {
+		conn, engine, err := linkedDatabase(db, link.Database)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		name := link.Env
+		if name == "" {
+			name = engine.DefaultEnvVar
+		}
+		env[name], sources[name], secret[name] = conn.URL, "database:"+link.Database, true
+	}
+	appSecrets := map[string]bool{}
+	for _, s := range app.Secrets {
+		appSecrets[s] = true
+	}
+	for k, v := range own {
+		env[k], sources[k], secret[k] = v, "app", appSecrets[k]
+	}
+	return env, sources, secret, nil
+}
+
+// lastDeployedAt returns when the application last deployed successfully
+func lastDeployedAt(db *sql.DB, appID int64) (*time.Time, error) {
+	var t time.Time
+	err := db.QueryRow("SELECT created_at FROM deployments WHERE application_id = ? AND status = 'succeeded' ORDER BY id DESC LIMIT 1", appID).Scan(&t)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// envGroupApplications lists the applications attached to a group and
+// which of them were deployed before the group last changed
+func envGroupApplications(db *sql.DB, g models.EnvGroup) ([]EnvGroupApplication, error) {
+	rows, err := db.Query("SELECT id, name, env_groups FROM applications ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	var attached []EnvGroupApplication
+	for rows.Next() {
+		var a EnvGroupApplication
+		var groupsStr string
+		if err := rows.Scan(&a.ID, &a.Name, &groupsStr); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		var names []string
+		if groupsStr != "" {
+			_ = json.Unmarshal([]byte(groupsStr), &names)
+		}
+		for _, name := range names {
+			if name == g.Name {
+				attached = append(attached, a)
+				break
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	result := []EnvGroupApplication{}
+	for _, a := range attached {
+		deployed, err := lastDeployedAt(db, a.ID)
+		if err != nil {
+			return nil, err
+		}
+		a.DeployedAt = deployed
+		a.NeedsRedeploy = deployed != nil && deployed.Before(g.UpdatedAt)
+		result = append(result, a)
+	}
+	return result, nil
+}
+
+// ListEnvGroups returns all env groups with secret values masked
+func ListEnvGroups(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rows, err := db.Query("SELECT " + envGroupColumns + " FROM env_groups ORDER BY name")
+		if err != nil {
+			log.Println("Error listing env groups:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		defer rows.Close()
+		groups := []models.EnvGroup{}
+		for rows.Next() {
+			g, err := scanEnvGroup(rows)
+			if err != nil {
+				log.Println("Error scanning env group:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+				return
+			}
+			maskGroupSecrets(&g)
+			groups = append(groups, g)
+		}
+		c.JSON(http.StatusOK, groups)
+	}
+}
+
+// CreateEnvGroup creates a shared env group
+func CreateEnvGroup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req EnvGroupRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !envGroupNamePattern.MatchString(req.Name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid env group name"})
+			return
+		}
+		envSealed, err := sealJSON(req.Env)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt env: " + err.Error()})
+			return
+		}
+		secretsJSON, _ := json.Marshal(req.Secrets)
+		now := time.Now()
+		result, err := db.Exec(
+			"INSERT INTO env_groups (name, description, env, secrets, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+			req.Name, req.Description, envSealed, string(secretsJSON), now, now,
+		)
+		if err != nil {
+			log.Println("Error creating env group:", err)
+			c.JSON(http.StatusConflict, gin.H{"error": "Name already exists or DB error"})
+			return
+		}
+		id, _ := result.LastInsertId()
+		c.JSON(http.StatusCreated, gin.H{"id": id})
+	}
+}
+
+// GetEnvGroup returns an env group and the applications attached to it
+func GetEnvGroup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		g, ok := loadEnvGroup(c, db)
+		if !ok {
+			return
+		}
+		apps, err := envGroupApplications(db, g)
+		if err != nil {
+			log.Println("Error resolving env group usage:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		maskGroupSecrets(&g)
+		c.JSON(http.StatusOK, gin.H{"group": g, "applications": apps})
+	}
+}
+
+// UpdateEnvGroup replaces an env group and reports the attached applications
+// that must be redeployed to pick up the change
+func UpdateEnvGroup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		g, ok := loadEnvGroup(c, db)
+		if !ok {
+			return
+		}
+		var req EnvGroupRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !envGroupNamePattern.MatchString(req.Name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid env group name"})
+			return
+		}
+		if req.Name != g.Name {
+			apps, err := envGroupApplications(db, g)
+			if err != nil {
+				log.Println("Error resolving env group usage:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+				return
+			}
+			if len(apps) > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "Env group is in use and cannot be renamed", "applications": apps})
+				return
+			}
+		}
+		// Keep stored values of secrets sent back masked
+		secret := map[string]bool{}
+		for _, name := range g.Secrets {
+			secret[name] = true
+		}
+		for k, v := range req.Env {
+			if v == secretMask && secret[k] {
+				req.Env[k] = g.Env[k]
+			}
+		}
+		envSealed, err := sealJSON(req.Env)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt env: " + err.Error()})
+			return
+		}
+		secretsJSON, _ := json.Marshal(req.Secrets)
+		// updated_at tells which deployments are out of date, so only
+		// changed variables move it
+		updatedAt := g.UpdatedAt
+		if !maps.Equal(req.Env, g.Env) {
+			updatedAt = time.Now()
+		}
+		_, err = db.Exec(
+			"UPDATE env_groups SET name = ?, description = ?, env = ?, secrets = ?, updated_at = ? WHERE id = ?",
+			req.Name, req.Description, envSealed, string(secretsJSON), updatedAt, g.ID,
+		)
+		if err != nil {
+			log.Println("Error updating env group:", err)
+			c.JSON(http.StatusConflict, gin.H{"error": "Name already exists or DB error"})
+			return
+		}
+		updated, ok := loadEnvGroup(c, db)
+		if !ok {
+			return
+		}
+		apps, err := envGroupApplications(db, updated)
+		if err != nil {
+			log.Println("Error resolving env group usage:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		redeploy := []EnvGroupApplication{}
+		for _, a := range apps {
+			if a.NeedsRedeploy {
+				redeploy = append(redeploy, a)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"updated": true, "redeploy_required": redeploy})
+	}
+}
+
+// DeleteEnvGroup removes an env group that no application uses
+func DeleteEnvGroup(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		g, ok := loadEnvGroup(c, db)
+		if !ok {
+			return
+		}
+		apps, err := envGroupApplications(db, g)
+		if err != nil {
+			log.Println("Error resolving env group usage:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		if len(apps) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Env group is in use", "applications": apps})
+			return
+		}
+		if _, err := db.Exec("DELETE FROM env_groups WHERE id = ?", g.ID); err != nil {
+			log.Println("Error deleting env group:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": true})
+	}
+}
+
+// GetApplicationEnv returns the merged env an application's container
+// receives, where each variable comes from, and whether a redeploy is due
+func GetApplicationEnv(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+		app, err := scanApplication(db.QueryRow("SELECT "+applicationColumns+" FROM applications WHERE id = ?", id))
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+			return
+		} else if err != nil {
+			log.Println("Error getting application:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		own, err := envMap(app)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid env format"})
+			return
+		}
+		env, sources, secret, err := effectiveEnv(db, app, own)
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		for k := range env {
+			if secret[k] {
+				env[k] = secretMask
+			}
+		}
+		deployed, err := lastDeployedAt(db, app.ID)
+		if err != nil {
+			log.Println("Error getting deployments:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		groups, err := envGroupsByName(db, app.EnvGroups)
+		if err != nil {
+			log.Println("Error getting env groups:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		stale := []string{}
+		for _, name := range app.EnvGroups {
+			if deployed != nil && deployed.Before(groups[name].UpdatedAt) {
+				stale = append(stale, name)
+			}
+		}
+		envGroups := app.EnvGroups
+		if envGroups == nil {
+			envGroups = []string{}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"env":            env,
+			"sources":        sources,
+			"env_groups":     envGroups,
+			"deployed_at":    deployed,
+			"needs_redeploy": len(stale) > 0,
+			"changed_groups": stale,
+		})
+	}
+}
@@ -0,0 +1,713 @@
+package handlers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-units"
+	"github.com/gakwaya-panel/api/internal/dockerutil"
+	"github.com/gin-gonic/gin"
+)
+
+// maxListEntries caps the size of a directory listing
+const maxListEntries = 1000
+
+// listScanLimit caps how much of an archive is read to list a directory
+// when the container cannot run ls
+const listScanLimit = 256 << 20
+
+// FileEntry is one item of a directory listing
+type FileEntry struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	Mode       string    `json:"mode"`
+	IsDir      bool      `json:"is_dir"`
+	ModTime    time.Time `json:"mod_time"`
+	LinkTarget string    `json:"link_target,omitempty"`
+}
+
+// WriteFileRequest is the request body for editing a text file
+type WriteFileRequest struct {
+	Path    string `json:"path" binding:"required"`
+	Content string `json:"content"`
+	Create  bool   `json:"create"`
+}
+
+// sizeLimit reads a size such as "100m" from env, falling back to def
+func sizeLimit(env string, def int64) int64 {
+	if v, err := units.RAMInBytes(os.Getenv(env)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+// transferLimit caps downloads and uploads (FILE_MAX_TRANSFER_SIZE, default 100m)
+func transferLimit() int64 {
+	return sizeLimit("FILE_MAX_TRANSFER_SIZE", 100<<20)
+}
+
+// editLimit caps files read or written as text (FILE_MAX_EDIT_SIZE, default 1m)
+func editLimit() int64 {
+	return sizeLimit("FILE_MAX_EDIT_SIZE", 1<<20)
+}
+
+// containerPath validates and cleans an absolute path in a container
+func containerPath(p string) (string, bool) {
+	if !path.IsAbs(p) {
+		return "", false
+	}
+	return path.Clean(p), true
+}
+
+// appContainer resolves the container of the application in :id, answering the request on failure
+func appContainer(c *gin.Context, db *sql.DB) (int64, string, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return 0, "", false
+	}
+	var containerID sql.NullString
+	err = db.QueryRow("SELECT container_id FROM applications WHERE id = ?", id).Scan(&containerID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return 0, "", false
+	} else if err != nil {
+		log.Println("Error getting application:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+		return 0, "", false
+	}
+	if containerID.String == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Application has no container; deploy it first"})
+		return 0, "", false
+	}
+	return id, containerID.String, true
+}
+
+// statOrRespond stats p in the container, answering 404/500 on failure
+func statOrRespond(c *gin.Context, cli *client.Client, containerID, p string) (types.ContainerPathStat, bool) {
+	stat, err := cli.ContainerStatPath(c, containerID, p)
+	if client.IsErrNotFound(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Path not found"})
+		return stat, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stat path: " + err.Error()})
+		return stat, false
+	}
+	return stat, true
+}
+
+func entryFromStat(stat types.ContainerPathStat) FileEntry {
+	return FileEntry{
+		Name:       stat.Name,
+		Size:       stat.Size,
+		Mode:       stat.Mode.String(),
+		IsDir:      stat.Mode.IsDir(),
+		ModTime:    stat.Mtime,
+		LinkTarget: stat.LinkTarget,
+	}
+}
+
+// listViaExec lists dir with ls in a running container and stats each entry
+func listViaExec(ctx context.Context, cli *client.Client, containerID, dir string) ([]FileEntry, bool, error) {
+	output, exitCode, err := execInContainer(ctx, cli, containerID, []string{"ls", "-1A", dir})
+	if err != nil {
+		return nil, false, err
+	}
+	if exitCode != 0 {
+		return nil, false, fmt.Errorf("ls exited with code %d", exitCode)
+	}
+	entries := []FileEntry{}
+	truncated := false
+	for _, name := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		if name == "" {
+			continue
+		}
+		if len(entries) == maxListEntries {
+			truncated = true
+			break
+		}
+		stat, err := cli.ContainerStatPath(ctx, containerID, path.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entryFromStat(stat))
+	}
+	return entries, truncated, nil
+}
+
+// listViaArchive lists dir from the headers of its archive, which works on
+// stopped containers and images without ls
+func listViaArchive(ctx context.Context, cli *client.Client, containerID, dir string) ([]FileEntry, bool, error) {
+	rc, _, err := cli.CopyFromContainer(ctx, containerID, dir)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rc.Close()
+	tr := tar.NewReader(io.LimitReader(rc, listScanLimit))
+	entries := []FileEntry{}
+	prefix := ""
+	first := true
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, false, nil
+		}
+		if err != nil {
+			// Hitting the scan limit ends the archive early
+			return entries, true, nil
+		}
+		name := strings.TrimSuffix(hdr.Name, "/")
+		if first {
+			first = false
+			prefix = name
+			if prefix == "." || prefix == "/" {
+				prefix = ""
+			}
+			continue
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(name, prefix), "/")
+		if rel == "" || strings.Contains(rel, "/") {
+			continue
+		}
+		if len(entries) == maxListEntries {
+			return entries, true, nil
+		}
+		fi := hdr.FileInfo()
+		entries = append(entries, FileEntry{
+			Name:       rel,
+			Size:       hdr.Size,
+			Mode:       fi.Mode().String(),
+			IsDir:      fi.IsDir(),
+			ModTime:    hdr.ModTime,
+			LinkTarget: hdr.Linkname,
+		})
+	}
+}
+
+// ListContainerFiles lists a directory in an application's container
+func ListContainerFiles(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, containerID, ok := appContainer(c, db)
+		if !ok {
+			return
+		}
+		p, valid := containerPath(c.DefaultQuery("path", "/"))
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "path must be absolute"})
+			return
+		}
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		stat, ok := statOrRespond(c, cli, containerID, p)
+		if !ok {
+			return
+		}
+		if !stat.Mode.IsDir() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Not a directory", "entry": entryFromStat(stat)})
+			return
+		}
+
+		entries, truncated, err := listViaExec(c, cli, containerID, p)
+		if err != nil {
+			entries, truncated, err = listViaArchive(c, cli, containerID, p)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list directory: " + err.Error()})
+			return
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].IsDir != entries[j].IsDir {
+				return entries[i].IsDir
+			}
+			return entries[i].Name < entries[j].Name
+		})
+		c.JSON(http.StatusOK, gin.H{"path": p, "entries": entries, "truncated": truncated})
+	}
+}
+
+// StatContainerFile returns metadata of a path in an application's container
+func StatContainerFile(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, containerID, ok := appContainer(c, db)
+		if !ok {
+			return
+		}
+		p, valid := containerPath(c.Query("path"))
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "path must be absolute"})
+			return
+		}
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		stat, ok := statOrRespond(c, cli, containerID, p)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, entryFromStat(stat))
+	}
+}
+
+// limitedWriter fails once more than n bytes have been written
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+var errTransferLimit = errors.New("transfer size limit exceeded")
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		return 0, errTransferLimit
+	}
+	l.n -= int64(len(p))
+	return l.w.Write(p)
+}
+
+// tarToZip rewrites a tar stream as a zip archive; links and special files are skipped
+func tarToZip(dst io.Writer, src io.Reader) error {
+	zw := zip.NewWriter(dst)
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			fh := &zip.FileHeader{Name: strings.TrimSuffix(hdr.Name, "/") + "/", Modified: hdr.ModTime}
+			fh.SetMode(hdr.FileInfo().Mode())
+			if _, err := zw.CreateHeader(fh); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			fh, err := zip.FileInfoHeader(hdr.FileInfo())
+			if err != nil {
+				return err
+			}
+			fh.Name = hdr.Name
+			fh.Method = zip.Deflate
+			w, err := zw.CreateHeader(fh)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(w, tr); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+// DownloadContainerFiles downloads a file (raw by default) or a directory
+// (tar by default) from an application's container; ?format=tar|zip|raw
+func DownloadContainerFiles(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		appID, containerID, ok := appContainer(c, db)
+		if !ok {
+			return
+		}
+		p, valid := containerPath(c.Query("path"))
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "path must be absolute"})
+			return
+		}
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		stat, ok := statOrRespond(c, cli, containerID, p)
+		if !ok {
+			return
+		}
+		format := c.Query("format")
+		if format == "" {
+			format = "tar"
+			if stat.Mode.IsRegular() {
+				format = "raw"
+			}
+		}
+		if format != "tar" && format != "zip" && format != "raw" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be tar, zip or raw"})
+			return
+		}
+		if format == "raw" && !stat.Mode.IsRegular() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "raw format is only available for regular files"})
+			return
+		}
+		limit := transferLimit()
+		if stat.Mode.IsRegular() && stat.Size > limit {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File exceeds the transfer size limit", "limit": limit})
+			return
+		}
+
+		rc, _, err := cli.CopyFromContainer(c, containerID, p)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy from container: " + err.Error()})
+			return
+		}
+		defer rc.Close()
+
+		name := stat.Name
+		if name == "/" || name == "" {
+			name = "root"
+		}
+		var body io.Reader = rc
+		var size int64
+		if format != "raw" {
+			// The size of a directory is only known once it is archived, so
+			// spool the archive first and answer 413 before any headers go out
+			tmp, err := os.CreateTemp("", "gakwayapanel-download-*.tar")
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			defer os.Remove(tmp.Name())
+			defer tmp.Close()
+			size, err = io.Copy(&limitedWriter{w: tmp, n: limit}, rc)
+			if errors.Is(err, errTransferLimit) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Archive exceeds the transfer size limit", "limit": limit})
+				return
+			} else if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy from container: " + err.Error()})
+				return
+			}
+			if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			body = tmp
+		}
+		recordAudit(c, db, "file.download", appID, p, "format="+format)
+
+		switch format {
+		case "raw":
+			tr := tar.NewReader(body)
+			if _, err := tr.Next(); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file: " + err.Error()})
+				return
+			}
+			c.Header("Content-Type", "application/octet-stream")
+			c.Header("Content-Length", strconv.FormatInt(stat.Size, 10))
+			c.Header("Content-Disposition", attachment(name))
+			c.Status(http.StatusOK)
+			err = copyCapped(c.Writer, tr)
+		case "tar":
+			c.Header("Content-Type", "application/x-tar")
+			c.Header("Content-Length", strconv.FormatInt(size, 10))
+			c.Header("Content-Disposition", attachment(name+".tar"))
+			c.Status(http.StatusOK)
+			err = copyCapped(c.Writer, body)
+		case "zip":
+			c.Header("Content-Type", "application/zip")
+			c.Header("Content-Disposition", attachment(name+".zip"))
+			c.Status(http.StatusOK)
+			err = tarToZip(c.Writer, body)
+		}
+		if err != nil {
+			// Headers are gone; all we can do is cut the stream short
+			log.Printf("[WARN] Download of %s from container %s aborted: %v", p, containerID, err)
+		}
+	}
+}
+
+// attachment builds a Content-Disposition header that downloads as filename,
+// quoting or encoding the characters a file name may contain
+func attachment(filename string) string {
+	if v := mime.FormatMediaType("attachment", map[string]string{"filename": filename}); v != "" {
+		return v
+	}
+	return "attachment"
+}
+
+func copyCapped(dst io.Writer, src io.Reader) error {
+	_, err := io.Copy(dst, src)
+	return err
+}
+
+// UploadContainerFiles uploads multipart "files" into a directory of an application's container
+func UploadContainerFiles(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		appID, containerID, ok := appContainer(c, db)
+		if !ok {
+			return
+		}
+		dir, valid := containerPath(c.Query("path"))
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "path must be absolute"})
+			return
+		}
+		limit := transferLimit()
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+1<<20)
+		form, err := c.MultipartForm()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid multipart form: " + err.Error()})
+			return
+		}
+		files := append(form.File["files"], form.File["file"]...)
+		if len(files) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No files uploaded"})
+			return
+		}
+		var total int64
+		for _, f := range files {
+			total += f.Size
+			if strings.ContainsAny(f.Filename, "/\\") || f.Filename == "." || f.Filename == ".." {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file name " + f.Filename})
+				return
+			}
+		}
+		if total > limit {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Upload exceeds the transfer size limit", "limit": limit})
+			return
+		}
+
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		stat, ok := statOrRespond(c, cli, containerID, dir)
+		if !ok {
+			return
+		}
+		if !stat.Mode.IsDir() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Upload path must be a directory"})
+			return
+		}
+
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(writeUploadTar(pw, files))
+		}()
+		if err := cli.CopyToContainer(c, containerID, dir, pr, types.CopyToContainerOptions{}); err != nil {
+			pr.CloseWithError(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy to container: " + err.Error()})
+			return
+		}
+		names := make([]string, 0, len(files))
+		for _, f := range files {
+			names = append(names, f.Filename)
+		}
+		recordAudit(c, db, "file.upload", appID, dir, strings.Join(names, ", "))
+		c.JSON(http.StatusOK, gin.H{"uploaded": names, "path": dir, "bytes": total})
+	}
+}
+
+// writeUploadTar writes the uploaded files as a flat tar archive
+func writeUploadTar(w io.Writer, files []*multipart.FileHeader) error {
+	tw := tar.NewWriter(w)
+	for _, fh := range files {
+		f, err := fh.Open()
+		if err != nil {
+			return err
+		}
+		err = tw.WriteHeader(&tar.Header{Name: fh.Filename, Mode: 0o644, Size: fh.Size, ModTime: time.Now(), Typeflag: tar.TypeReg})
+		if err == nil {
+			_, err = io.Copy(tw, f)
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// readContainerFile returns the tar header and content of a regular file of at most limit bytes
+func readContainerFile(ctx context.Context, cli *client.Client, containerID, p string, limit int64) (*tar.Header, []byte, error) {
+	rc, _, err := cli.CopyFromContainer(ctx, containerID, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, nil, err
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return hdr, nil, errors.New("not a regular file")
+	}
+	if hdr.Size > limit {
+		return hdr, nil, errTransferLimit
+	}
+	data, err := io.ReadAll(tr)
+	return hdr, data, err
+}
+
+// containerFileHeader returns the tar header of a file without reading its
+// content
+func containerFileHeader(ctx context.Context, cli *client.Client, containerID, p string) (*tar.Header, error) {
+	rc, _, err := cli.CopyFromContainer(ctx, containerID, p)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return tar.NewReader(rc).Next()
+}
+
+// ReadContainerFile returns the content of a small text file in an application's container
+func ReadContainerFile(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		appID, containerID, ok := appContainer(c, db)
+		if !ok {
+			return
+		}
+		p, valid := containerPath(c.Query("path"))
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "path must be absolute"})
+			return
+		}
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		if _, ok := statOrRespond(c, cli, containerID, p); !ok {
+			return
+		}
+		hdr, data, err := readContainerFile(c, cli, containerID, p, editLimit())
+		switch {
+		case errors.Is(err, errTransferLimit):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large to edit", "limit": editLimit()})
+			return
+		case err != nil && hdr != nil:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file: " + err.Error()})
+			return
+		}
+		if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "File is not text; download it instead"})
+			return
+		}
+		recordAudit(c, db, "file.read", appID, p, "")
+		c.JSON(http.StatusOK, gin.H{
+			"path":     p,
+			"content":  string(data),
+			"size":     hdr.Size,
+			"mode":     hdr.FileInfo().Mode().String(),
+			"mod_time": hdr.ModTime,
+		})
+	}
+}
+
+// WriteContainerFile replaces (or with create, creates) a small text file in
+// an application's container, keeping the owner and mode of an existing file
+func WriteContainerFile(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		appID, containerID, ok := appContainer(c, db)
+		if !ok {
+			return
+		}
+		var req WriteFileRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		p, valid := containerPath(req.Path)
+		if !valid || p == "/" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "path must be an absolute file path"})
+			return
+		}
+		if int64(len(req.Content)) > editLimit() {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Content exceeds the edit size limit", "limit": editLimit()})
+			return
+		}
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+
+		hdr := &tar.Header{Mode: 0o644, Typeflag: tar.TypeReg}
+		stat, err := cli.ContainerStatPath(c, containerID, p)
+		switch {
+		case err == nil:
+			if !stat.Mode.IsRegular() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Not a regular file"})
+				return
+			}
+			// Keep the permissions, and the owner, which the stat does not
+			// carry but the archive header does
+			owner, err := containerFileHeader(c, cli, containerID, p)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file: " + err.Error()})
+				return
+			}
+			hdr.Mode = int64(stat.Mode.Perm())
+			for bit, mode := range map[os.FileMode]int64{os.ModeSetuid: 0o4000, os.ModeSetgid: 0o2000, os.ModeSticky: 0o1000} {
+				if stat.Mode&bit != 0 {
+					hdr.Mode |= mode
+				}
+			}
+			hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = owner.Uid, owner.Gid, owner.Uname, owner.Gname
+		case client.IsErrNotFound(err):
+			if !req.Create {
+				c.JSON(http.StatusNotFound, gin.H{"error": "File not found; set create to make it"})
+				return
+			}
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stat path: " + err.Error()})
+			return
+		}
+		hdr.Name = path.Base(p)
+		hdr.Size = int64(len(req.Content))
+		hdr.ModTime = time.Now()
+
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		if err := tw.WriteHeader(hdr); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		tw.Write([]byte(req.Content))
+		tw.Close()
+		if err := cli.CopyToContainer(c, containerID, path.Dir(p), &buf, types.CopyToContainerOptions{}); err != nil {
+			if client.IsErrNotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Parent directory not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write file: " + err.Error()})
+			return
+		}
+		recordAudit(c, db, "file.write", appID, p, fmt.Sprintf("%d bytes", len(req.Content)))
+		c.JSON(http.StatusOK, gin.H{"path": p, "size": len(req.Content)})
+	}
+}
@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/gakwaya-panel/api/internal/dockerutil"
+	"github.com/gin-gonic/gin"
+)
+
+// ImageApplication is a short reference to an application using an image
+type ImageApplication struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// imageUsage describes who uses a given image
+type imageUsage struct {
+	Containers   []string           `json:"containers"`
+	Applications []ImageApplication `json:"applications"`
+}
+
+// normalizeImageRef appends the implicit ":latest" tag to untagged references
+func normalizeImageRef(ref string) string {
+	if strings.Contains(ref, "@") {
+		return ref
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref
+	}
+	return ref + ":latest"
+}
+
+// imageRef returns the image a request addresses: the ref query parameter,
+// which can hold references with a slash such as ghcr.io/org/app:tag that
+// a path segment cannot, or else the :id path parameter
+func imageRef(c *gin.Context) string {
+	if ref := c.Query("ref"); ref != "" {
+		return ref
+	}
+	return c.Param("id")
+}
+
+// collectImageUsage maps the IDs of images to the containers and
+// applications using them
+func collectImageUsage(ctx context.Context, cli *client.Client, db *sql.DB, images []types.ImageSummary) (map[string]*imageUsage, error) {
+	usage := map[string]*imageUsage{}
+	tagToID := map[string]string{}
+	for _, img := range images {
+		usage[img.ID] = &imageUsage{Containers: []string{}, Applications: []ImageApplication{}}
+		for _, t := range img.RepoTags {
+			tagToID[t] = img.ID
+		}
+	}
+
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	containerImage := map[string]string{}
+	for _, ctr := range containers {
+		containerImage[ctr.ID] = ctr.ImageID
+		if u, ok := usage[ctr.ImageID]; ok {
+			u.Containers = append(u.Containers, ctr.ID)
+		}
+	}
+
+	rows, err := db.Query("SELECT id, name, image, container_id FROM applications")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var app ImageApplication
+		var image string
+		var containerID sql.NullString
+		if err := rows.Scan(&app.ID, &app.Name, &image, &containerID); err != nil {
+			return nil, err
+		}
+		ids := map[string]bool{}
+		if id, ok := tagToID[normalizeImageRef(image)]; ok {
+			ids[id] = true
+		}
+		if id, ok := containerImage[containerID.String]; ok && containerID.Valid {
+			ids[id] = true
+		}
+		for id := range ids {
+			if u, ok := usage[id]; ok {
+				u.Applications = append(u.Applications, app)
+			}
+		}
+	}
+	return usage, rows.Err()
+}
+
+// ListDockerImages returns all images with size, tags and the applications using them
+func ListDockerImages(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+
+		images, err := cli.ImageList(c, types.ImageListOptions{})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list images: " + err.Error()})
+			return
+		}
+		usage, err := collectImageUsage(c, cli, db, images)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve image usage: " + err.Error()})
+			return
+		}
+
+		result := []gin.H{}
+		for _, img := range images {
+			u := usage[img.ID]
+			if u == nil {
+				u = &imageUsage{Containers: []string{}, Applications: []ImageApplication{}}
+			}
+			result = append(result, gin.H{
+				"id":           img.ID,
+				"tags":         img.RepoTags,
+				"size":         img.Size,
+				"created":      time.Unix(img.Created, 0).UTC(),
+				"containers":   u.Containers,
+				"applications": u.Applications,
+			})
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// InspectDockerImage returns detailed info about an image
+func InspectDockerImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := imageRef(c)
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		info, _, err := cli.ImageInspectWithRaw(c, id)
+		if client.IsErrNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to inspect image: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, info)
+	}
+}
+
+// DockerImageHistory returns the layers of an image
+func DockerImageHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := imageRef(c)
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		history, err := cli.ImageHistory(c, id)
+		if client.IsErrNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get image history: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, history)
+	}
+}
+
+type PullImageRequest struct {
+	Image string `json:"image" binding:"required"`
+	Tag   string `json:"tag"`
+}
+
+// PullDockerImage pulls an image and streams Docker's progress messages as NDJSON
+func PullDockerImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req PullImageRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ref := req.Image
+		if req.Tag != "" {
+			ref = req.Image + ":" + req.Tag
+		}
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+
+		reader, err := cli.ImagePull(c.Request.Context(), ref, types.ImagePullOptions{})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pull image: " + err.Error()})
+			return
+		}
+		defer reader.Close()
+
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(http.StatusOK)
+		dec := json.NewDecoder(reader)
+		enc := json.NewEncoder(c.Writer)
+		for {
+			var msg jsonmessage.JSONMessage
+			if err := dec.Decode(&msg); err != nil {
+				if err != io.EOF {
+					_ = enc.Encode(gin.H{"error": err.Error()})
+				}
+				return
+			}
+			if err := enc.Encode(msg); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+type TagImageRequest struct {
+	Repo string `json:"repo" binding:"required"`
+	Tag  string `json:"tag"`
+}
+
+// TagDockerImage adds a repo:tag reference to an image
+func TagDockerImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := imageRef(c)
+		var req TagImageRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		target := req.Repo
+		if req.Tag != "" {
+			target = req.Repo + ":" + req.Tag
+		}
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		if err := cli.ImageTag(c, id, target); err != nil {
+			if client.IsErrNotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to tag image: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tagged": true, "id": id, "tag": target})
+	}
+}
+
+// RemoveDockerImage removes an image unless a container or application still uses it
+func RemoveDockerImage(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := imageRef(c)
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+
+		info, _, err := cli.ImageInspectWithRaw(c, id)
+		if client.IsErrNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to inspect image: " + err.Error()})
+			return
+		}
+		images, err := cli.ImageList(c, types.ImageListOptions{})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list images: " + err.Error()})
+			return
+		}
+		usage, err := collectImageUsage(c, cli, db, images)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve image usage: " + err.Error()})
+			return
+		}
+		if u := usage[info.ID]; u != nil && (len(u.Containers) > 0 || len(u.Applications) > 0) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":        "Image is in use",
+				"containers":   u.Containers,
+				"applications": u.Applications,
+			})
+			return
+		}
+
+		items, err := cli.ImageRemove(c, info.ID, types.ImageRemoveOptions{Force: true, PruneChildren: true})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove image: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"removed": true, "id": info.ID, "items": items})
+	}
+}
+
+// ExportDockerImage streams an image as a tar archive (like docker save)
+func ExportDockerImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := imageRef(c)
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		if _, _, err := cli.ImageInspectWithRaw(c, id); err != nil {
+			if client.IsErrNotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to inspect image: " + err.Error()})
+			return
+		}
+		reader, err := cli.ImageSave(c.Request.Context(), []string{id})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export image: " + err.Error()})
+			return
+		}
+		defer reader.Close()
+
+		filename := strings.NewReplacer("/", "_", ":", "_").Replace(strings.TrimPrefix(id, "sha256:")) + ".tar"
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.DataFromReader(http.StatusOK, -1, "application/x-tar", reader, nil)
+	}
+}
+
+// ImportDockerImage loads images from an uploaded tar archive (like docker load).
+// The archive may be sent as a multipart "file" field or as the raw request body.
+func ImportDockerImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input io.Reader = c.Request.Body
+		if strings.HasPrefix(c.ContentType(), "multipart/") {
+			fh, err := c.FormFile("file")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file field"})
+				return
+			}
+			f, err := fh.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload: " + err.Error()})
+				return
+			}
+			defer f.Close()
+			input = f
+		}
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+
+		resp, err := cli.ImageLoad(c.Request.Context(), input, true)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import image: " + err.Error()})
+			return
+		}
+		defer resp.Body.Close()
+
+		loaded := []string{}
+		dec := json.NewDecoder(resp.Body)
+		for {
+			var msg jsonmessage.JSONMessage
+			if err := dec.Decode(&msg); err != nil {
+				break
+			}
+			if msg.Error != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to import image: " + msg.Error.Message})
+				return
+			}
+			if s := strings.TrimSpace(msg.Stream); s != "" {
+				loaded = append(loaded, strings.TrimPrefix(strings.TrimPrefix(s, "Loaded image: "), "Loaded image ID: "))
+			}
+		}
+		c.JSON(http.StatusCreated, gin.H{"loaded": loaded})
+	}
+}
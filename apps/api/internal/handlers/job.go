@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gakwaya-panel/api/internal/jobs"
+	"github.com/gin-gonic/gin"
+)
+
+// ListJobs returns recent deploy/build jobs, optionally filtered by ?application_id=
+func ListJobs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var appID int64
+		if v := c.Query("application_id"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid application_id"})
+				return
+			}
+			appID = id
+		}
+		c.JSON(http.StatusOK, gin.H{"jobs": jobs.List(appID), "build_queue_depth": jobs.BuildQueueDepth()})
+	}
+}
+
+// GetJob returns a single job by ID
+func GetJob() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+		job, err := jobs.Get(id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// CancelJob aborts a queued or running job
+func CancelJob() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+		switch err := jobs.Cancel(id); err {
+		case nil:
+			c.JSON(http.StatusAccepted, gin.H{"cancelled": true, "id": id})
+		case jobs.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		default:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+// abortJob answers the request when the job context ended early (cancelled
+// or timed out) and reports whether it did
+func abortJob(c *gin.Context, ctx context.Context, job *jobs.Job) bool {
+	reason := jobs.Reason(ctx)
+	if reason == "" {
+		return false
+	}
+	job.SetError(reason)
+	status := http.StatusConflict
+	if ctx.Err() == context.DeadlineExceeded {
+		status = http.StatusGatewayTimeout
+	}
+	c.JSON(status, gin.H{"error": "Job " + reason, "job_id": job.ID})
+	return true
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/logship"
+	"github.com/gin-gonic/gin"
+)
+
+// logQuery reads the search parameters of a stored log request
+func logQuery(c *gin.Context) (logship.Query, error) {
+	q := logship.Query{Text: c.Query("q"), ContainerID: c.Query("container_id"), Cursor: c.Query("cursor"), Limit: 200}
+	for _, p := range []struct {
+		name string
+		dst  *int64
+	}{{"application_id", &q.ApplicationID}, {"deployment_id", &q.DeploymentID}} {
+		if v := c.Query(p.name); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return q, errors.New("Invalid " + p.name)
+			}
+			*p.dst = id
+		}
+	}
+	switch q.Stream = c.Query("stream"); q.Stream {
+	case "", "stdout", "stderr":
+	default:
+		return q, errors.New("stream must be stdout or stderr")
+	}
+	var err error
+	if q.From, err = parseTimeParam(c.Query("from"), time.Time{}); err != nil {
+		return q, err
+	}
+	if q.To, err = parseTimeParam(c.Query("to"), time.Time{}); err != nil {
+		return q, err
+	}
+	if q.Cursor != "" {
+		if _, _, err := logship.ParseCursor(q.Cursor); err != nil {
+			return q, err
+		}
+	}
+	if v, err := strconv.Atoi(c.Query("limit")); err == nil && v > 0 && v <= 1000 {
+		q.Limit = v
+	}
+	return q, nil
+}
+
+// respondLogSearch answers with one page of stored lines
+func respondLogSearch(c *gin.Context, db *sql.DB, q logship.Query) {
+	page, err := logship.Search(db, q)
+	if err != nil {
+		log.Println("Error searching logs:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// SearchLogs searches the stored output of all application containers,
+// newest first; ?cursor= continues from the previous page
+func SearchLogs(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q, err := logQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		respondLogSearch(c, db, q)
+	}
+}
+
+// SearchApplicationLogs searches the stored output of an application across
+// its deployments
+func SearchApplicationLogs(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app, ok := loadApplication(c, db)
+		if !ok {
+			return
+		}
+		q, err := logQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		q.ApplicationID = app.ID
+		respondLogSearch(c, db, q)
+	}
+}
+
+// GetLogStatus reports how many lines are stored and the retention limits
+func GetLogStatus(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, err := logship.Stats(db)
+		if err != nil {
+			log.Println("Error reading log stats:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	}
+}
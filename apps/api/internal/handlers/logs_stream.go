@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/gakwaya-panel/api/internal/dockerutil"
+	"github.com/gin-gonic/gin"
+)
+
+// maxLogLine bounds a buffered log line; longer lines are sent in pieces
+const maxLogLine = 64 << 10
+
+// logKeepAlive is how often an idle log stream sends an SSE comment so
+// proxies do not drop the connection
+const logKeepAlive = 30 * time.Second
+
+// LogLine is one line of container output
+type LogLine struct {
+	Stream string     `json:"stream"`
+	Time   *time.Time `json:"t,omitempty"`
+	Line   string     `json:"line"`
+}
+
+// logLineWriter splits what it is written into lines of one stream and
+// hands them to emit
+type logLineWriter struct {
+	stream string
+	buf    []byte
+	emit   func(stream, line string) error
+}
+
+func (w *logLineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSuffix(string(w.buf[:i]), "\r")
+		w.buf = w.buf[i+1:]
+		if err := w.emit(w.stream, line); err != nil {
+			return 0, err
+		}
+	}
+	if len(w.buf) > maxLogLine {
+		line := string(w.buf)
+		w.buf = nil
+		if err := w.emit(w.stream, line); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// flush emits a last line that did not end with a newline
+func (w *logLineWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	line := string(w.buf)
+	w.buf = nil
+	return w.emit(w.stream, line)
+}
+
+// demuxLogs copies container logs to stdout and stderr, stripping the frame
+// headers Docker adds when the container has no TTY
+func demuxLogs(stdout, stderr io.Writer, r io.Reader, tty bool) error {
+	if tty {
+		_, err := io.Copy(stdout, r)
+		return err
+	}
+	_, err := stdcopy.StdCopy(stdout, stderr, r)
+	return err
+}
+
+// parseLogTime reads a since/until parameter: RFC 3339, Unix seconds or a
+// duration before now such as 15m
+func parseLogTime(name, v string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	if d, err := time.ParseDuration(v); err == nil && d > 0 {
+		return strconv.FormatInt(time.Now().Add(-d).Unix(), 10), nil
+	}
+	t, err := parseTimeParam(v, time.Time{})
+	if err != nil {
+		return "", fmt.Errorf("invalid %s %q: use RFC 3339, Unix seconds or a duration like 15m", name, v)
+	}
+	return strconv.FormatInt(t.Unix(), 10), nil
+}
+
+// logFilter builds the grep filter of a log stream; nil keeps every line
+func logFilter(c *gin.Context) (func(string) bool, error) {
+	pattern := c.Query("grep")
+	if pattern == "" {
+		return nil, nil
+	}
+	if c.Query("regex") == "true" {
+		if c.Query("ignore_case") == "true" {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grep pattern: %v", err)
+		}
+		return re.MatchString, nil
+	}
+	if c.Query("ignore_case") == "true" {
+		pattern = strings.ToLower(pattern)
+		return func(line string) bool { return strings.Contains(strings.ToLower(line), pattern) }, nil
+	}
+	return func(line string) bool { return strings.Contains(line, pattern) }, nil
+}
+
+// StreamDockerContainerLogs follows the output of a container over
+// Server-Sent Events, one "log" event per line with stdout and stderr told
+// apart. It takes since, until, tail, timestamps, follow, stream and grep
+// query parameters and closes the Docker stream when the client goes away.
+func StreamDockerContainerLogs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		opts := types.ContainerLogsOptions{
+			ShowStdout: true,
+			ShowStderr: true,
+			Follow:     c.DefaultQuery("follow", "true") != "false",
+			Timestamps: true,
+			Tail:       c.DefaultQuery("tail", "100"),
+		}
+		if opts.Tail != "all" {
+			if n, err := strconv.Atoi(opts.Tail); err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "tail must be a number of lines or all"})
+				return
+			}
+		}
+		switch c.DefaultQuery("stream", "all") {
+		case "stdout":
+			opts.ShowStderr = false
+		case "stderr":
+			opts.ShowStdout = false
+		case "all":
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "stream must be stdout, stderr or all"})
+			return
+		}
+		var err error
+		if opts.Since, err = parseLogTime("since", c.Query("since")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if opts.Until, err = parseLogTime("until", c.Query("until")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		match, err := logFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		timestamps := c.Query("timestamps") == "true"
+
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		info, err := cli.ContainerInspect(c, id)
+		if err != nil {
+			if client.IsErrNotFound(err) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Container not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to inspect container: " + err.Error()})
+			}
+			return
+		}
+
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		reader, err := cli.ContainerLogs(ctx, info.ID, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch logs: " + err.Error()})
+			return
+		}
+		defer reader.Close()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+
+		lines := make(chan LogLine, 256)
+		copyErr := make(chan error, 1)
+		go func() {
+			defer close(lines)
+			emit := func(stream, line string) error {
+				l := LogLine{Stream: stream, Line: line}
+				// Docker puts an RFC 3339 timestamp and a space before each line
+				if ts, rest, ok := strings.Cut(line, " "); ok {
+					if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+						l.Line = rest
+						if timestamps {
+							t = t.UTC()
+							l.Time = &t
+						}
+					}
+				}
+				if match != nil && !match(l.Line) {
+					return nil
+				}
+				select {
+				case lines <- l:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			stdout := &logLineWriter{stream: "stdout", emit: emit}
+			stderr := &logLineWriter{stream: "stderr", emit: emit}
+			err := demuxLogs(stdout, stderr, reader, info.Config != nil && info.Config.Tty)
+			if err == nil {
+				if err = stdout.flush(); err == nil {
+					err = stderr.flush()
+				}
+			}
+			copyErr <- err
+		}()
+
+		keepAlive := time.NewTicker(logKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-keepAlive.C:
+				if _, err := c.Writer.WriteString(": keep-alive\n\n"); err != nil {
+					return
+				}
+				c.Writer.Flush()
+			case l, ok := <-lines:
+				if !ok {
+					if err := <-copyErr; err != nil && ctx.Err() == nil {
+						c.SSEvent("error", gin.H{"error": err.Error()})
+					}
+					c.SSEvent("end", gin.H{"reason": logEndReason(opts)})
+					c.Writer.Flush()
+					return
+				}
+				c.SSEvent("log", l)
+				// Flush once the backlog is written rather than per line
+				if len(lines) == 0 {
+					c.Writer.Flush()
+				}
+			}
+		}
+	}
+}
+
+// logEndReason explains why a log stream finished
+func logEndReason(opts types.ContainerLogsOptions) string {
+	switch {
+	case !opts.Follow:
+		return "no more logs"
+	case opts.Until != "":
+		return "reached until"
+	default:
+		return "container stopped"
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// parseTimeParam reads an RFC 3339 time or Unix seconds
+func parseTimeParam(v string, def time.Time) (time.Time, error) {
+	if v == "" {
+		return def, nil
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, fmt.Errorf("invalid time %q: use RFC 3339 or Unix seconds", v)
+	}
+	return t, nil
+}
+
+// parseStepParam reads a Go duration or a number of seconds
+func parseStepParam(v string) (time.Duration, error) {
+	if v == "" {
+		return 0, nil
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid step %q: use a duration like 5m or seconds", v)
+	}
+	return d, nil
+}
+
+// GetApplicationMetrics returns the CPU, memory, network and block I/O
+// series of an application between ?from= and ?to= (default: the last
+// hour) averaged per ?step=
+func GetApplicationMetrics(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+		var exists int
+		if err := db.QueryRow("SELECT COUNT(*) FROM applications WHERE id = ?", id).Scan(&exists); err != nil || exists == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+			return
+		}
+		now := time.Now()
+		to, err := parseTimeParam(c.Query("to"), now)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		from, err := parseTimeParam(c.Query("from"), to.Add(-time.Hour))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		step, err := parseStepParam(c.Query("step"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !to.After(from) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from"})
+			return
+		}
+		series, err := metrics.Query(db, id, from, to, step)
+		if err != nil {
+			log.Println("Error querying metrics:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		c.JSON(http.StatusOK, series)
+	}
+}
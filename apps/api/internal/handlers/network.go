@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/gakwaya-panel/api/internal/dockerutil"
+	"github.com/gakwaya-panel/api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateNetworkRequest is the request body for creating a Docker network
+type CreateNetworkRequest struct {
+	Name       string            `json:"name" binding:"required"`
+	Driver     string            `json:"driver"`
+	Internal   bool              `json:"internal"`
+	Attachable bool              `json:"attachable"`
+	Subnet     string            `json:"subnet"`
+	Gateway    string            `json:"gateway"`
+	Labels     map[string]string `json:"labels"`
+}
+
+// validateNetworks checks the project name and networks of an application request
+func validateNetworks(project string, networks []models.NetworkAttachment) error {
+	if project != "" && !dockerutil.ValidNetworkName(project) {
+		return fmt.Errorf("invalid project name %q", project)
+	}
+	for i, n := range networks {
+		if !dockerutil.ValidNetworkName(n.Name) {
+			return fmt.Errorf("networks[%d]: invalid network name %q", i, n.Name)
+		}
+		for _, alias := range n.Aliases {
+			if !dockerutil.ValidNetworkName(alias) {
+				return fmt.Errorf("networks[%d]: invalid alias %q", i, alias)
+			}
+		}
+	}
+	return nil
+}
+
+// collectNetworkUsage maps network names to the applications that join them on deploy
+func collectNetworkUsage(db *sql.DB) (map[string][]ImageApplication, error) {
+	rows, err := db.Query("SELECT id, name, project, networks FROM applications")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	usage := map[string][]ImageApplication{}
+	for rows.Next() {
+		var app models.Application
+		var networksStr string
+		if err := rows.Scan(&app.ID, &app.Name, &app.Project, &networksStr); err != nil {
+			return nil, err
+		}
+		if networksStr != "" {
+			_ = json.Unmarshal([]byte(networksStr), &app.Networks)
+		}
+		for _, n := range appNetworks(app) {
+			usage[n.Name] = append(usage[n.Name], ImageApplication{ID: app.ID, Name: app.Name})
+		}
+	}
+	return usage, rows.Err()
+}
+
+// ListDockerNetworks returns all networks with the containers attached and the applications using them
+func ListDockerNetworks(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+
+		networks, err := cli.NetworkList(c, types.NetworkListOptions{})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list networks: " + err.Error()})
+			return
+		}
+		usage, err := collectNetworkUsage(db)
+		if err != nil {
+			log.Println("Error resolving network usage:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+
+		result := []gin.H{}
+		for _, n := range networks {
+			// NetworkList does not fill in containers; inspect each network for them
+			containers := []string{}
+			if info, err := cli.NetworkInspect(c, n.ID, types.NetworkInspectOptions{}); err == nil {
+				for id := range info.Containers {
+					containers = append(containers, id)
+				}
+			}
+			apps := usage[n.Name]
+			if apps == nil {
+				apps = []ImageApplication{}
+			}
+			result = append(result, gin.H{
+				"id":           n.ID,
+				"name":         n.Name,
+				"driver":       n.Driver,
+				"scope":        n.Scope,
+				"internal":     n.Internal,
+				"attachable":   n.Attachable,
+				"labels":       n.Labels,
+				"created":      n.Created,
+				"containers":   containers,
+				"applications": apps,
+			})
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// CreateDockerNetwork creates a network (bridge by default)
+func CreateDockerNetwork() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateNetworkRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !dockerutil.ValidNetworkName(req.Name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid network name"})
+			return
+		}
+		if req.Driver == "" {
+			req.Driver = "bridge"
+		}
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+
+		opts := types.NetworkCreate{
+			CheckDuplicate: true,
+			Driver:         req.Driver,
+			Internal:       req.Internal,
+			Attachable:     req.Attachable,
+			Labels:         req.Labels,
+		}
+		if req.Subnet != "" {
+			opts.IPAM = &network.IPAM{Config: []network.IPAMConfig{{Subnet: req.Subnet, Gateway: req.Gateway}}}
+		}
+		created, err := cli.NetworkCreate(c, req.Name, opts)
+		if err != nil {
+			if _, inspectErr := cli.NetworkInspect(c, req.Name, types.NetworkInspectOptions{}); inspectErr == nil {
+				c.JSON(http.StatusConflict, gin.H{"error": "A network with this name already exists"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create network: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"id": created.ID, "name": req.Name, "warning": created.Warning})
+	}
+}
+
+// InspectDockerNetwork returns detailed info about a network and the applications using it
+func InspectDockerNetwork(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		info, err := cli.NetworkInspect(c, c.Param("id"), types.NetworkInspectOptions{})
+		if client.IsErrNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Network not found"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to inspect network: " + err.Error()})
+			return
+		}
+		usage, err := collectNetworkUsage(db)
+		if err != nil {
+			log.Println("Error resolving network usage:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		apps := usage[info.Name]
+		if apps == nil {
+			apps = []ImageApplication{}
+		}
+		c.JSON(http.StatusOK, gin.H{"network": info, "applications": apps})
+	}
+}
+
+// RemoveDockerNetwork removes a network unless applications or containers still use it
+func RemoveDockerNetwork(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		info, err := cli.NetworkInspect(c, c.Param("id"), types.NetworkInspectOptions{})
+		if client.IsErrNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Network not found"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to inspect network: " + err.Error()})
+			return
+		}
+		if info.Name == dockerutil.PanelNetwork() {
+			c.JSON(http.StatusConflict, gin.H{"error": "The panel network cannot be removed"})
+			return
+		}
+		usage, err := collectNetworkUsage(db)
+		if err != nil {
+			log.Println("Error resolving network usage:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		if len(usage[info.Name]) > 0 || len(info.Containers) > 0 {
+			containers := []string{}
+			for id := range info.Containers {
+				containers = append(containers, id)
+			}
+			apps := usage[info.Name]
+			if apps == nil {
+				apps = []ImageApplication{}
+			}
+			c.JSON(http.StatusConflict, gin.H{
+				"error":        "Network is in use",
+				"containers":   containers,
+				"applications": apps,
+			})
+			return
+		}
+		if err := cli.NetworkRemove(c, info.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove network: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"removed": true, "id": info.ID})
+	}
+}
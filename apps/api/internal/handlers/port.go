@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/gakwaya-panel/api/internal/dockerutil"
+	"github.com/gakwaya-panel/api/internal/ports"
+	"github.com/gin-gonic/gin"
+)
+
+// ListHostPorts returns the automatic port range and every host port held by
+// applications or running containers
+func ListHostPorts(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		used, err := ports.InUse(c, cli, db, 0)
+		if err != nil {
+			log.Println("Error listing host ports:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list host ports"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"range": ports.ConfiguredRange(), "used": used})
+	}
+}
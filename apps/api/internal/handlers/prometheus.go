@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/metrics"
+	"github.com/gakwaya-panel/api/internal/prom"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestMetrics records the latency of every request by route template
+func RequestMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		prom.HTTPRequestDuration.Observe(time.Since(start).Seconds(), c.Request.Method, route, strconv.Itoa(c.Writer.Status()))
+	}
+}
+
+// appGauges lists the per-application gauges: name, help and value
+var appGauges = []struct {
+	name, help string
+	value      func(metrics.AppSample) float64
+}{
+	{"gakwayapanel_app_cpu_percent", "CPU usage of the application container; 100 is one core.",
+		func(s metrics.AppSample) float64 { return s.Point.CPUPercent }},
+	{"gakwayapanel_app_memory_bytes", "Memory used by the application container, without page cache.",
+		func(s metrics.AppSample) float64 { return float64(s.Point.MemoryBytes) }},
+	{"gakwayapanel_app_memory_limit_bytes", "Memory limit of the application container.",
+		func(s metrics.AppSample) float64 { return float64(s.Point.MemoryLimit) }},
+	{"gakwayapanel_app_network_receive_bytes_per_second", "Network bytes received per second.",
+		func(s metrics.AppSample) float64 { return s.Point.NetworkRxRate }},
+	{"gakwayapanel_app_network_transmit_bytes_per_second", "Network bytes sent per second.",
+		func(s metrics.AppSample) float64 { return s.Point.NetworkTxRate }},
+	{"gakwayapanel_app_block_read_bytes_per_second", "Block device bytes read per second.",
+		func(s metrics.AppSample) float64 { return s.Point.BlockReadRate }},
+	{"gakwayapanel_app_block_write_bytes_per_second", "Block device bytes written per second.",
+		func(s metrics.AppSample) float64 { return s.Point.BlockWriteRate }},
+}
+
+// PrometheusMetrics serves panel and application metrics in the Prometheus
+// text format. Scrapers authenticate with METRICS_TOKEN as a bearer token;
+// the endpoint is disabled while it is unset.
+func PrometheusMetrics(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := os.Getenv("METRICS_TOKEN")
+		if token == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Metrics endpoint is disabled; set METRICS_TOKEN"})
+			return
+		}
+		given, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid scrape token"})
+			return
+		}
+
+		var buf bytes.Buffer
+		prom.WriteText(&buf)
+
+		latest, err := metrics.Latest(db)
+		if err != nil {
+			log.Println("Error reading container metrics:", err)
+		}
+		// An application is up when its container was sampled recently
+		sampled := map[int64]bool{}
+		for _, s := range latest {
+			sampled[s.ApplicationID] = true
+		}
+		var up []prom.Sample
+		rows, err := db.Query("SELECT id, name FROM applications ORDER BY name")
+		if err != nil {
+			log.Println("Error listing applications:", err)
+		} else {
+			for rows.Next() {
+				var id int64
+				var name string
+				if err := rows.Scan(&id, &name); err != nil {
+					continue
+				}
+				v := 0.0
+				if sampled[id] {
+					v = 1
+				}
+				up = append(up, prom.Sample{Labels: []prom.Label{{Name: "app", Value: name}}, Value: v})
+			}
+			rows.Close()
+		}
+		if metrics.Interval() > 0 {
+			prom.WriteFamily(&buf, "gakwayapanel_app_up", "Whether the application container was running at the last sample (1) or not (0).", "gauge", up)
+		}
+
+		for _, g := range appGauges {
+			samples := make([]prom.Sample, 0, len(latest))
+			for _, s := range latest {
+				samples = append(samples, prom.Sample{Labels: []prom.Label{{Name: "app", Value: s.Name}}, Value: g.value(s)})
+			}
+			prom.WriteFamily(&buf, g.name, g.help, "gauge", samples)
+		}
+		c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", buf.Bytes())
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/gakwaya-panel/api/internal/proxy"
+	"github.com/gin-gonic/gin"
+)
+
+// ListProxyRoutes returns the reverse proxy's current routing table
+func ListProxyRoutes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"routes": proxy.Default.Routes()})
+	}
+}
+
+// ReloadProxyRoutes rebuilds the routing table from the applications table
+func ReloadProxyRoutes(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := proxy.Default.Reload(c, db); err != nil {
+			log.Println("Error reloading proxy routes:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload routes: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"routes": proxy.Default.Routes()})
+	}
+}
+
+// ListCertificates returns the TLS certificate state of every routed host
+func ListCertificates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"tls_enabled": proxy.TLSEnabled(), "certificates": proxy.Certificates(c)})
+	}
+}
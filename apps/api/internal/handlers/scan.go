@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/gakwaya-panel/api/internal/dockerutil"
+	"github.com/gakwaya-panel/api/internal/scanner"
+	"github.com/gin-gonic/gin"
+)
+
+// scanTimeout reads IMAGE_SCAN_TIMEOUT (a Go duration), defaulting to 10 minutes
+func scanTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("IMAGE_SCAN_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return 10 * time.Minute
+}
+
+// scanImage runs s against image and stores the result
+func scanImage(ctx context.Context, cli *client.Client, db *sql.DB, s scanner.Scanner, image string) (*scanner.Result, error) {
+	info, _, err := cli.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, scanTimeout())
+	defer cancel()
+	result, err := s.Scan(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	result.ImageID = info.ID
+	if err := scanner.Save(db, result); err != nil {
+		log.Printf("[WARN] Could not store scan of %s: %v", image, err)
+	}
+	return result, nil
+}
+
+// checkImageScan scans image before a deploy when a scanner is configured and
+// reports whether IMAGE_SCAN_BLOCK_SEVERITY forbids deploying it. Scan errors
+// only fail the deploy when a block threshold is set.
+func checkImageScan(ctx context.Context, cli *client.Client, db *sql.DB, image string) (*scanner.Result, bool, error) {
+	s, err := scanner.FromEnv()
+	if err != nil || s == nil {
+		return nil, false, err
+	}
+	threshold := scanner.BlockThreshold()
+	result, err := scanImage(ctx, cli, db, s, image)
+	if err != nil {
+		if threshold == "" {
+			log.Printf("[WARN] Image scan of %s failed: %v", image, err)
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return result, result.Blocks(threshold), nil
+}
+
+// ScanDockerImage scans an image with the configured scanner and stores the findings
+func ScanDockerImage(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := imageRef(c)
+		s, err := scanner.FromEnv()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if s == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No image scanner configured (set IMAGE_SCANNER)"})
+			return
+		}
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		result, err := scanImage(c.Request.Context(), cli, db, s, id)
+		if client.IsErrNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan image: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// ListDockerImageScans returns the stored scans of an image, newest first
+func ListDockerImageScans(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := imageRef(c)
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		info, _, err := cli.ImageInspectWithRaw(c, id)
+		if client.IsErrNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to inspect image: " + err.Error()})
+			return
+		}
+		scans, err := scanner.ListByImageID(db, info.ID, 20)
+		if err != nil {
+			log.Println("Error listing image scans:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		c.JSON(http.StatusOK, scans)
+	}
+}
+
+// GetApplicationScan returns the latest scan of the image an application runs
+func GetApplicationScan(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+		var image string
+		err = db.QueryRow("SELECT image FROM applications WHERE id = ?", id).Scan(&image)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		info, _, err := cli.ImageInspectWithRaw(c, image)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not present locally: " + image})
+			return
+		}
+		scans, err := scanner.ListByImageID(db, info.ID, 1)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		if len(scans) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image has not been scanned"})
+			return
+		}
+		c.JSON(http.StatusOK, scans[0])
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/gakwaya-panel/api/internal/dockerutil"
+	"github.com/gakwaya-panel/api/internal/metrics"
+	"github.com/gakwaya-panel/api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// maxStreamContainers bounds the containers followed by one stats stream
+const maxStreamContainers = 20
+
+// ContainerStatsFrame is the latest usage of one streamed container
+type ContainerStatsFrame struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	models.MetricPoint
+}
+
+// streamTarget is a container resolved from the ids parameter
+type streamTarget struct {
+	id, name string
+}
+
+// StreamDockerContainerStats pushes the CPU, memory, network and block I/O
+// rates of the containers in ?ids= (comma separated IDs or names) every
+// second, over Server-Sent Events or, when the client asks for an upgrade,
+// a WebSocket. The Docker stats streams are closed when the client goes away.
+func StreamDockerContainerStats() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ids []string
+		seen := map[string]bool{}
+		for _, id := range strings.Split(c.Query("ids"), ",") {
+			if id = strings.TrimSpace(id); id != "" && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing container IDs: use ?ids=a,b"})
+			return
+		}
+		if len(ids) > maxStreamContainers {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Too many containers; the limit is %d", maxStreamContainers)})
+			return
+		}
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+
+		targets := make([]streamTarget, 0, len(ids))
+		for _, id := range ids {
+			info, err := cli.ContainerInspect(c, id)
+			if err != nil {
+				if client.IsErrNotFound(err) {
+					c.JSON(http.StatusNotFound, gin.H{"error": "Container not found: " + id})
+				} else {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to inspect container: " + err.Error()})
+				}
+				return
+			}
+			targets = append(targets, streamTarget{info.ID, strings.TrimPrefix(info.Name, "/")})
+		}
+
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+
+		var send func(event string, data any) error
+		if websocket.IsWebSocketUpgrade(c.Request) {
+			upgrader := websocket.Upgrader{
+				CheckOrigin: func(r *http.Request) bool { return true },
+			}
+			ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+			if err != nil {
+				return
+			}
+			defer ws.Close()
+			// The request context outlives a hijacked connection; stop when
+			// the client closes the socket
+			go func() {
+				for {
+					if _, _, err := ws.ReadMessage(); err != nil {
+						cancel()
+						return
+					}
+				}
+			}()
+			send = func(event string, data any) error {
+				ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				return ws.WriteJSON(gin.H{"event": event, "data": data})
+			}
+		} else {
+			c.Header("Content-Type", "text/event-stream")
+			c.Header("Cache-Control", "no-cache")
+			c.Header("X-Accel-Buffering", "no")
+			c.Status(http.StatusOK)
+			send = func(event string, data any) error {
+				c.SSEvent(event, data)
+				c.Writer.Flush()
+				return ctx.Err()
+			}
+		}
+		streamStats(ctx, cli, targets, send)
+	}
+}
+
+// streamStats follows the targets and sends a "stats" event with the fresh
+// readings every second, an "error" event when a container's stream fails
+// and "end" once no stream is left
+func streamStats(ctx context.Context, cli *client.Client, targets []streamTarget, send func(string, any) error) {
+	ctx, cancel := context.WithCancel(ctx)
+	var (
+		mu     sync.Mutex
+		latest = map[string]ContainerStatsFrame{}
+		failed []gin.H
+		wg     sync.WaitGroup
+	)
+	for _, t := range targets {
+		wg.Add(1)
+		go func(t streamTarget) {
+			defer wg.Done()
+			err := metrics.Stream(ctx, cli, t.id, func(p models.MetricPoint) {
+				mu.Lock()
+				latest[t.id] = ContainerStatsFrame{ID: t.id, Name: t.name, MetricPoint: p}
+				mu.Unlock()
+			})
+			if ctx.Err() != nil {
+				return
+			}
+			msg := err.Error()
+			if errors.Is(err, metrics.ErrStreamEnded) {
+				msg = "container stopped"
+			}
+			mu.Lock()
+			failed = append(failed, gin.H{"id": t.id, "name": t.name, "error": msg})
+			mu.Unlock()
+		}(t)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	defer func() {
+		// Close the Docker streams before the client is released
+		cancel()
+		<-done
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+		case <-ticker.C:
+		}
+		mu.Lock()
+		frames := make([]ContainerStatsFrame, 0, len(latest))
+		for _, t := range targets {
+			if f, ok := latest[t.id]; ok {
+				frames = append(frames, f)
+			}
+		}
+		latest = map[string]ContainerStatsFrame{}
+		errs := failed
+		failed = nil
+		mu.Unlock()
+
+		for _, e := range errs {
+			if send("error", e) != nil {
+				return
+			}
+		}
+		if len(frames) > 0 {
+			if send("stats", gin.H{"t": time.Now().UTC(), "containers": frames}) != nil {
+				return
+			}
+		}
+		select {
+		case <-done:
+			send("end", gin.H{"reason": "no running containers left"})
+			return
+		default:
+		}
+	}
+}
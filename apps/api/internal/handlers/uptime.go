@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/models"
+	"github.com/gakwaya-panel/api/internal/uptime"
+	"github.com/gin-gonic/gin"
+)
+
+// UptimeCheckRequest is the request body for creating or updating an uptime check
+type UptimeCheckRequest struct {
+	Name             string `json:"name" binding:"required,max=100"`
+	Type             string `json:"type" binding:"required"`
+	URL              string `json:"url"`
+	ExpectedStatus   int    `json:"expected_status"`
+	BodyContains     string `json:"body_contains"`
+	Address          string `json:"address"`
+	IntervalSeconds  int    `json:"interval_seconds"`
+	TimeoutSeconds   int    `json:"timeout_seconds"`
+	FailureThreshold int    `json:"failure_threshold"`
+	Enabled          *bool  `json:"enabled"`
+}
+
+// check builds the check described by the request, with defaults filled in
+func (req UptimeCheckRequest) check() (models.UptimeCheck, error) {
+	c := models.UptimeCheck{
+		Name: req.Name, Type: req.Type, ExpectedStatus: req.ExpectedStatus,
+		IntervalSeconds: req.IntervalSeconds, TimeoutSeconds: req.TimeoutSeconds, FailureThreshold: req.FailureThreshold,
+		Enabled: req.Enabled == nil || *req.Enabled,
+	}
+	uptime.Defaults(&c)
+	switch req.Type {
+	case uptime.TypeHTTP:
+		u, err := url.Parse(req.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return c, errors.New("url must be an http or https URL")
+		}
+		if req.ExpectedStatus != 0 && (req.ExpectedStatus < 100 || req.ExpectedStatus > 599) {
+			return c, errors.New("expected_status must be an HTTP status code")
+		}
+		c.URL, c.BodyContains = req.URL, req.BodyContains
+	case uptime.TypeTCP:
+		_, port, err := net.SplitHostPort(req.Address)
+		if p, perr := strconv.Atoi(port); err != nil || perr != nil || p < 1 || p > 65535 {
+			return c, errors.New("address must be host:port, or :port to dial the application container")
+		}
+		c.Address = req.Address
+	default:
+		return c, errors.New("type must be http or tcp")
+	}
+	if c.IntervalSeconds < uptime.MinInterval || c.IntervalSeconds > 86400 {
+		return c, fmt.Errorf("interval_seconds must be between %d and 86400", uptime.MinInterval)
+	}
+	if c.TimeoutSeconds < 1 || c.TimeoutSeconds > 60 || c.TimeoutSeconds >= c.IntervalSeconds {
+		return c, errors.New("timeout_seconds must be between 1 and 60 and shorter than the interval")
+	}
+	if c.FailureThreshold < 1 || c.FailureThreshold > 10 {
+		return c, errors.New("failure_threshold must be between 1 and 10")
+	}
+	return c, nil
+}
+
+// loadUptimeCheck reads the check named by the :id path parameter, answering the request on failure
+func loadUptimeCheck(c *gin.Context, db *sql.DB) (models.UptimeCheck, bool) {
+	id, ok := pathID(c)
+	if !ok {
+		return models.UptimeCheck{}, false
+	}
+	check, err := uptime.Get(db, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Uptime check not found"})
+		return check, false
+	} else if err != nil {
+		log.Println("Error getting uptime check:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+		return check, false
+	}
+	return check, true
+}
+
+// respondUptimeChecks answers with checks and their uptime percentages
+func respondUptimeChecks(c *gin.Context, db *sql.DB, checks []models.UptimeCheck) {
+	for i := range checks {
+		stats, err := uptime.Stats(db, checks[i].ID)
+		if err != nil {
+			log.Println("Error reading uptime stats:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		checks[i].Uptime = stats
+	}
+	c.JSON(http.StatusOK, checks)
+}
+
+// ListUptimeChecks returns the uptime checks of every application
+func ListUptimeChecks(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		checks, err := uptime.List(db, 0)
+		if err != nil {
+			log.Println("Error listing uptime checks:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		respondUptimeChecks(c, db, checks)
+	}
+}
+
+// ListApplicationUptimeChecks returns the uptime checks of an application
+func ListApplicationUptimeChecks(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app, ok := loadApplication(c, db)
+		if !ok {
+			return
+		}
+		checks, err := uptime.List(db, app.ID)
+		if err != nil {
+			log.Println("Error listing uptime checks:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		respondUptimeChecks(c, db, checks)
+	}
+}
+
+// CreateUptimeCheck adds an uptime check to an application
+func CreateUptimeCheck(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app, ok := loadApplication(c, db)
+		if !ok {
+			return
+		}
+		var req UptimeCheckRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		check, err := req.check()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		check.ApplicationID = app.ID
+		id, err := uptime.Save(db, check)
+		if err != nil {
+			log.Println("Error creating uptime check:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		if check, err = uptime.Get(db, id); err != nil {
+			log.Println("Error getting uptime check:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		c.JSON(http.StatusCreated, check)
+	}
+}
+
+// GetUptimeCheck returns an uptime check with its uptime percentages
+func GetUptimeCheck(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		check, ok := loadUptimeCheck(c, db)
+		if !ok {
+			return
+		}
+		stats, err := uptime.Stats(db, check.ID)
+		if err != nil {
+			log.Println("Error reading uptime stats:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		check.Uptime = stats
+		c.JSON(http.StatusOK, check)
+	}
+}
+
+// UpdateUptimeCheck replaces the settings of an uptime check; its state and
+// history are kept
+func UpdateUptimeCheck(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		existing, ok := loadUptimeCheck(c, db)
+		if !ok {
+			return
+		}
+		var req UptimeCheckRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		check, err := req.check()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		check.ID, check.ApplicationID = existing.ID, existing.ApplicationID
+		if _, err := uptime.Save(db, check); err != nil {
+			log.Println("Error updating uptime check:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		if check, err = uptime.Get(db, check.ID); err != nil {
+			log.Println("Error getting uptime check:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		c.JSON(http.StatusOK, check)
+	}
+}
+
+// DeleteUptimeCheck deletes an uptime check with its history
+func DeleteUptimeCheck(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := pathID(c)
+		if !ok {
+			return
+		}
+		found, err := uptime.Delete(db, id)
+		if err != nil {
+			log.Println("Error deleting uptime check:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Uptime check not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Uptime check deleted"})
+	}
+}
+
+// RunUptimeCheck probes a check right away without recording the result
+func RunUptimeCheck(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		check, ok := loadUptimeCheck(c, db)
+		if !ok {
+			return
+		}
+		var containerID sql.NullString
+		if err := db.QueryRow("SELECT container_id FROM applications WHERE id = ?", check.ApplicationID).Scan(&containerID); err != nil && err != sql.ErrNoRows {
+			log.Println("Error getting application:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		r := uptime.Probe(c.Request.Context(), check, containerID.String)
+		c.JSON(http.StatusOK, models.UptimeResult{Time: r.At.UTC(), Up: r.Up, ResponseMS: r.Duration.Milliseconds(), StatusCode: r.StatusCode, Error: r.Error})
+	}
+}
+
+// GetUptimeCheckResults returns the probes of a check between ?from= and
+// ?to= (default: the last 24 hours), newest first
+func GetUptimeCheckResults(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		check, ok := loadUptimeCheck(c, db)
+		if !ok {
+			return
+		}
+		to, err := parseTimeParam(c.Query("to"), time.Now())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		from, err := parseTimeParam(c.Query("from"), to.Add(-24*time.Hour))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		limit := 1000
+		if v, err := strconv.Atoi(c.Query("limit")); err == nil && v > 0 && v <= 10000 {
+			limit = v
+		}
+		results, err := uptime.Results(db, check.ID, from, to, limit)
+		if err != nil {
+			log.Println("Error listing uptime results:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		c.JSON(http.StatusOK, results)
+	}
+}
+
+// GetUptimeCheckOutages returns the outages of a check, newest first
+func GetUptimeCheckOutages(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		check, ok := loadUptimeCheck(c, db)
+		if !ok {
+			return
+		}
+		limit := 100
+		if v, err := strconv.Atoi(c.Query("limit")); err == nil && v > 0 && v <= 1000 {
+			limit = v
+		}
+		outages, err := uptime.Outages(db, check.ID, limit)
+		if err != nil {
+			log.Println("Error listing uptime outages:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+		c.JSON(http.StatusOK, outages)
+	}
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/gakwaya-panel/api/internal/dockerutil"
+	"github.com/gakwaya-panel/api/internal/volumes"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateVolumeRequest is the request body for creating a named volume
+type CreateVolumeRequest struct {
+	Name       string            `json:"name" binding:"required"`
+	Driver     string            `json:"driver"`
+	DriverOpts map[string]string `json:"driver_opts"`
+	Labels     map[string]string `json:"labels"`
+}
+
+// volumeUsage describes who uses a given volume
+type volumeUsage struct {
+	Containers   []string           `json:"containers"`
+	Applications []ImageApplication `json:"applications"`
+}
+
+// collectVolumeUsage maps volume names to the containers mounting them and
+// the applications whose volume specs reference them
+func collectVolumeUsage(ctx context.Context, cli *client.Client, db *sql.DB) (map[string]*volumeUsage, error) {
+	usage := map[string]*volumeUsage{}
+	get := func(name string) *volumeUsage {
+		u, ok := usage[name]
+		if !ok {
+			u = &volumeUsage{Containers: []string{}, Applications: []ImageApplication{}}
+			usage[name] = u
+		}
+		return u
+	}
+
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	for _, ctr := range containers {
+		for _, m := range ctr.Mounts {
+			if m.Type == mount.TypeVolume && m.Name != "" {
+				u := get(m.Name)
+				u.Containers = append(u.Containers, ctr.ID)
+			}
+		}
+	}
+
+	rows, err := db.Query("SELECT id, name, volumes FROM applications")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var app ImageApplication
+		var volumesStr sql.NullString
+		if err := rows.Scan(&app.ID, &app.Name, &volumesStr); err != nil {
+			return nil, err
+		}
+		var specs []string
+		_ = json.Unmarshal([]byte(volumesStr.String), &specs)
+		seen := map[string]bool{}
+		for _, name := range volumes.NamedVolumes(specs) {
+			if !seen[name] {
+				seen[name] = true
+				u := get(name)
+				u.Applications = append(u.Applications, app)
+			}
+		}
+	}
+	return usage, rows.Err()
+}
+
+// ListDockerVolumes returns all named volumes with the containers and applications using them
+func ListDockerVolumes(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+
+		list, err := cli.VolumeList(c, volume.ListOptions{})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list volumes: " + err.Error()})
+			return
+		}
+		usage, err := collectVolumeUsage(c, cli, db)
+		if err != nil {
+			log.Println("Error resolving volume usage:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve volume usage: " + err.Error()})
+			return
+		}
+
+		result := []gin.H{}
+		for _, v := range list.Volumes {
+			u := usage[v.Name]
+			if u == nil {
+				u = &volumeUsage{Containers: []string{}, Applications: []ImageApplication{}}
+			}
+			result = append(result, gin.H{
+				"name":         v.Name,
+				"driver":       v.Driver,
+				"mountpoint":   v.Mountpoint,
+				"scope":        v.Scope,
+				"labels":       v.Labels,
+				"created":      v.CreatedAt,
+				"containers":   u.Containers,
+				"applications": u.Applications,
+			})
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// CreateDockerVolume creates a named volume
+func CreateDockerVolume() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateVolumeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !volumes.ValidName(req.Name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid volume name"})
+			return
+		}
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+
+		if _, err := cli.VolumeInspect(c, req.Name); err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "A volume with this name already exists"})
+			return
+		}
+		v, err := cli.VolumeCreate(c, volume.CreateOptions{
+			Name:       req.Name,
+			Driver:     req.Driver,
+			DriverOpts: req.DriverOpts,
+			Labels:     req.Labels,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create volume: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, v)
+	}
+}
+
+// InspectDockerVolume returns details of a volume and who uses it
+func InspectDockerVolume(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		v, err := cli.VolumeInspect(c, c.Param("name"))
+		if client.IsErrNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Volume not found"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to inspect volume: " + err.Error()})
+			return
+		}
+		usage, err := collectVolumeUsage(c, cli, db)
+		if err != nil {
+			log.Println("Error resolving volume usage:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve volume usage: " + err.Error()})
+			return
+		}
+		u := usage[v.Name]
+		if u == nil {
+			u = &volumeUsage{Containers: []string{}, Applications: []ImageApplication{}}
+		}
+		c.JSON(http.StatusOK, gin.H{"volume": v, "containers": u.Containers, "applications": u.Applications})
+	}
+}
+
+// RemoveDockerVolume removes a volume unless a container or application still uses it
+func RemoveDockerVolume(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Docker client error"})
+			return
+		}
+		defer cli.Close()
+		if _, err := cli.VolumeInspect(c, name); client.IsErrNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Volume not found"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to inspect volume: " + err.Error()})
+			return
+		}
+		usage, err := collectVolumeUsage(c, cli, db)
+		if err != nil {
+			log.Println("Error resolving volume usage:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve volume usage: " + err.Error()})
+			return
+		}
+		if u := usage[name]; u != nil && (len(u.Containers) > 0 || len(u.Applications) > 0) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":        "Volume is in use",
+				"containers":   u.Containers,
+				"applications": u.Applications,
+			})
+			return
+		}
+		if err := cli.VolumeRemove(c, name, false); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove volume: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"removed": true, "name": name})
+	}
+}
@@ -0,0 +1,210 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/prom"
+)
+
+// Job statuses
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// maxFinished is how many finished jobs are kept for inspection
+const maxFinished = 200
+
+// ErrNotFound is returned for unknown job IDs
+var ErrNotFound = errors.New("job not found")
+
+// ErrFinished is returned when cancelling a job that already ended
+var ErrFinished = errors.New("job already finished")
+
+// Job is a long-running deploy or build tracked by the panel
+type Job struct {
+	ID            int64      `json:"id"`
+	Kind          string     `json:"kind"`
+	ApplicationID int64      `json:"application_id"`
+	Status        string     `json:"status"`
+	Error         string     `json:"error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+var (
+	mu     sync.Mutex
+	nextID int64 = 1
+	all          = map[int64]*Job{}
+)
+
+// Start registers a new queued job whose context carries parent's values but
+// not its cancellation, so a closed browser tab or a proxy timeout on the
+// request does not abort the job. The returned context is cancelled by Cancel.
+func Start(parent context.Context, kind string, appID int64) (*Job, context.Context) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
+	mu.Lock()
+	defer mu.Unlock()
+	job := &Job{
+		ID:            nextID,
+		Kind:          kind,
+		ApplicationID: appID,
+		Status:        StatusQueued,
+		CreatedAt:     time.Now(),
+		cancel:        cancel,
+	}
+	nextID++
+	all[job.ID] = job
+	return job, ctx
+}
+
+// Running marks the job as started
+func (j *Job) Running() {
+	mu.Lock()
+	defer mu.Unlock()
+	now := time.Now()
+	j.Status = StatusRunning
+	j.StartedAt = &now
+}
+
+// Done marks the job as finished: cancelled if Cancel was called, otherwise
+// succeeded or failed according to ok
+func (j *Job) Done(ok bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	now := time.Now()
+	j.FinishedAt = &now
+	switch {
+	case j.cancelled:
+		j.Status = StatusCancelled
+		j.Error = "cancelled by user"
+	case ok:
+		j.Status = StatusSucceeded
+	default:
+		j.Status = StatusFailed
+	}
+	start := j.CreatedAt
+	if j.StartedAt != nil {
+		start = *j.StartedAt
+	}
+	prom.JobsFinished.Inc(j.Kind, j.Status)
+	prom.JobDuration.Observe(now.Sub(start).Seconds(), j.Kind, j.Status)
+	j.cancel()
+	trimFinished()
+}
+
+// SetError records an error message on the job
+func (j *Job) SetError(msg string) {
+	mu.Lock()
+	defer mu.Unlock()
+	j.Error = msg
+}
+
+// snapshot returns a copy that is safe to serialise
+func (j *Job) snapshot() Job {
+	return Job{
+		ID:            j.ID,
+		Kind:          j.Kind,
+		ApplicationID: j.ApplicationID,
+		Status:        j.Status,
+		Error:         j.Error,
+		CreatedAt:     j.CreatedAt,
+		StartedAt:     j.StartedAt,
+		FinishedAt:    j.FinishedAt,
+	}
+}
+
+// trimFinished drops the oldest finished jobs beyond maxFinished; mu must be held
+func trimFinished() {
+	var finished []*Job
+	for _, j := range all {
+		if j.FinishedAt != nil {
+			finished = append(finished, j)
+		}
+	}
+	if len(finished) <= maxFinished {
+		return
+	}
+	sort.Slice(finished, func(a, b int) bool { return finished[a].ID < finished[b].ID })
+	for _, j := range finished[:len(finished)-maxFinished] {
+		delete(all, j.ID)
+	}
+}
+
+// Get returns a job by ID
+func Get(id int64) (Job, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	j, ok := all[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return j.snapshot(), nil
+}
+
+// List returns known jobs, newest first, optionally filtered by application
+func List(appID int64) []Job {
+	mu.Lock()
+	defer mu.Unlock()
+	out := []Job{}
+	for _, j := range all {
+		if appID == 0 || j.ApplicationID == appID {
+			out = append(out, j.snapshot())
+		}
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].ID > out[b].ID })
+	return out
+}
+
+// Cancel aborts a queued or running job
+func Cancel(id int64) error {
+	mu.Lock()
+	defer mu.Unlock()
+	j, ok := all[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if j.FinishedAt != nil {
+		return ErrFinished
+	}
+	j.cancelled = true
+	j.cancel()
+	return nil
+}
+
+// Timeout returns BUILD_TIMEOUT (a Go duration, default 30 minutes), or the
+// per-application timeout in seconds when that is shorter. An application
+// cannot raise the global limit.
+func Timeout(appSeconds int) time.Duration {
+	limit := 30 * time.Minute
+	if d, err := time.ParseDuration(os.Getenv("BUILD_TIMEOUT")); err == nil && d > 0 {
+		limit = d
+	}
+	if d := time.Duration(appSeconds) * time.Second; d > 0 && d < limit {
+		return d
+	}
+	return limit
+}
+
+// Reason describes why ctx ended, for error responses
+func Reason(ctx context.Context) string {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return "timed out"
+	case context.Canceled:
+		return "cancelled"
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		env        string
+		appSeconds int
+		want       time.Duration
+	}{
+		{"", 0, 30 * time.Minute},
+		{"", 60, time.Minute},
+		{"", 3600, 30 * time.Minute},
+		{"10m", 0, 10 * time.Minute},
+		{"10m", 120, 2 * time.Minute},
+		{"10m", 3600, 10 * time.Minute},
+		{"bogus", 0, 30 * time.Minute},
+		{"-5m", 0, 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Setenv("BUILD_TIMEOUT", tt.env)
+		if got := Timeout(tt.appSeconds); got != tt.want {
+			t.Errorf("BUILD_TIMEOUT=%q: Timeout(%d) = %s, want %s", tt.env, tt.appSeconds, got, tt.want)
+		}
+	}
+}
+
+func TestStartOutlivesRequest(t *testing.T) {
+	request, endRequest := context.WithCancel(context.Background())
+	job, ctx := Start(request, "build", 1)
+	endRequest()
+	if ctx.Err() != nil {
+		t.Fatal("the job context ended with the request")
+	}
+
+	if err := Cancel(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("Cancel did not end the job context")
+	}
+	job.Done(false)
+	if got, _ := Get(job.ID); got.Status != StatusCancelled {
+		t.Errorf("status = %q, want %q", got.Status, StatusCancelled)
+	}
+	if err := Cancel(job.ID); err != ErrFinished {
+		t.Errorf("cancelling a finished job: err = %v, want ErrFinished", err)
+	}
+}
@@ -0,0 +1,113 @@
+package jobs
+
+import (
+	"container/list"
+	"context"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/gakwaya-panel/api/internal/prom"
+)
+
+// limiter is a counting semaphore that hands out slots in FIFO order
+type limiter struct {
+	mu      sync.Mutex
+	slots   int
+	active  int
+	waiters *list.List // of chan struct{}
+}
+
+var (
+	buildsOnce sync.Once
+	builds     *limiter
+)
+
+// buildLimiter returns the global build limiter sized by MAX_CONCURRENT_BUILDS (default 2)
+func buildLimiter() *limiter {
+	buildsOnce.Do(func() {
+		slots := 2
+		if v, err := strconv.Atoi(os.Getenv("MAX_CONCURRENT_BUILDS")); err == nil && v > 0 {
+			slots = v
+		}
+		builds = &limiter{slots: slots, waiters: list.New()}
+	})
+	return builds
+}
+
+func (l *limiter) acquire(ctx context.Context) error {
+	l.mu.Lock()
+	if l.active < l.slots && l.waiters.Len() == 0 {
+		l.active++
+		l.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	elem := l.waiters.PushBack(ready)
+	l.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		select {
+		case <-ready:
+			// The slot was handed over while we were giving up; pass it on
+			l.releaseLocked()
+		default:
+			l.waiters.Remove(elem)
+		}
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (l *limiter) release() {
+	l.mu.Lock()
+	l.releaseLocked()
+	l.mu.Unlock()
+}
+
+// releaseLocked hands the slot to the oldest waiter or frees it; mu must be held
+func (l *limiter) releaseLocked() {
+	if front := l.waiters.Front(); front != nil {
+		l.waiters.Remove(front)
+		close(front.Value.(chan struct{}))
+		return
+	}
+	l.active--
+}
+
+// AcquireBuild blocks until a build slot is free or ctx ends
+func AcquireBuild(ctx context.Context) error {
+	return buildLimiter().acquire(ctx)
+}
+
+// ReleaseBuild frees a slot obtained with AcquireBuild
+func ReleaseBuild() {
+	buildLimiter().release()
+}
+
+// BuildQueueDepth returns how many builds are waiting for a slot
+func BuildQueueDepth() int {
+	l := buildLimiter()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.waiters.Len()
+}
+
+// ActiveBuilds returns how many builds hold a slot
+func ActiveBuilds() int {
+	l := buildLimiter()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active
+}
+
+func init() {
+	prom.NewGaugeFunc("gakwayapanel_build_queue_depth", "Builds waiting for a slot (MAX_CONCURRENT_BUILDS).",
+		func() float64 { return float64(BuildQueueDepth()) })
+	prom.NewGaugeFunc("gakwayapanel_builds_active", "Builds holding a slot.",
+		func() float64 { return float64(ActiveBuilds()) })
+}
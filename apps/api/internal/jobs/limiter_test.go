@@ -0,0 +1,110 @@
+package jobs
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newLimiter(slots int) *limiter {
+	return &limiter{slots: slots, waiters: list.New()}
+}
+
+// queued waits until n callers are waiting on l
+func queued(t *testing.T, l *limiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		l.mu.Lock()
+		got := l.waiters.Len()
+		l.mu.Unlock()
+		if got == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d waiters, want %d", got, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLimiterFIFO(t *testing.T) {
+	l := newLimiter(1)
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	order := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			if err := l.acquire(context.Background()); err == nil {
+				order <- i
+			}
+		}(i)
+		queued(t, l, i+1)
+	}
+	for want := 0; want < 3; want++ {
+		l.release()
+		select {
+		case got := <-order:
+			if got != want {
+				t.Fatalf("waiter %d got the slot, want %d", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no waiter got the released slot")
+		}
+	}
+	l.release()
+	if l.active != 0 || l.waiters.Len() != 0 {
+		t.Errorf("after releasing everything: active %d, waiters %d", l.active, l.waiters.Len())
+	}
+}
+
+func TestLimiterSlots(t *testing.T) {
+	l := newLimiter(2)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		if err := l.acquire(ctx); err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+	}
+	if err := l.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("third acquire: err = %v, want DeadlineExceeded", err)
+	}
+	if l.waiters.Len() != 0 {
+		t.Errorf("a cancelled waiter stayed queued")
+	}
+}
+
+func TestLimiterCancelledWaiterIsSkipped(t *testing.T) {
+	l := newLimiter(1)
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	gaveUp := make(chan error, 1)
+	go func() { gaveUp <- l.acquire(ctx) }()
+	queued(t, l, 1)
+	next := make(chan error, 1)
+	go func() { next <- l.acquire(context.Background()) }()
+	queued(t, l, 2)
+
+	cancel()
+	if err := <-gaveUp; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled acquire: err = %v", err)
+	}
+	l.release()
+	select {
+	case err := <-next:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the slot was not handed past the cancelled waiter")
+	}
+	if l.active != 1 {
+		t.Errorf("active = %d, want 1", l.active)
+	}
+}
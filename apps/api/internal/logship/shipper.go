@@ -0,0 +1,369 @@
+package logship
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/gakwaya-panel/api/internal/dockerutil"
+)
+
+// syncInterval is how often new application containers are looked for
+const syncInterval = 10 * time.Second
+
+// maxLine bounds a stored line, timestamp included; the rest is cut off
+const maxLine = 16 << 10
+
+// Batching of inserts: at most batchSize lines or flushInterval apart
+const (
+	batchSize     = 500
+	flushInterval = time.Second
+)
+
+// entry is a line waiting to be stored. An entry with done set follows the
+// last line of a container whose log stream ended.
+type entry struct {
+	appID       int64
+	containerID string
+	stream      string
+	ts          time.Time
+	line        string
+	done        bool
+}
+
+var (
+	mu      sync.Mutex
+	tailing = map[string]bool{}      // container ID -> logs being followed
+	last    = map[string]time.Time{} // container ID -> time of the last stored line
+	drained = map[string]time.Time{} // container ID -> FinishedAt of a stopped container read to the end
+)
+
+// following returns how many containers are being tailed
+func following() int {
+	mu.Lock()
+	defer mu.Unlock()
+	return len(tailing)
+}
+
+// Start follows the output of every application container in the
+// background, unless LOG_RETENTION is 0, and prunes old lines every hour
+func Start(db *sql.DB) {
+	if err := Setup(db); err != nil {
+		log.Printf("[WARN] logship: could not set up full-text search: %v", err)
+	}
+	if Retention() == 0 {
+		log.Printf("[INFO] logship: log shipping disabled")
+		return
+	}
+	lines := make(chan entry, 4096)
+	go write(db, lines)
+	go func() {
+		for {
+			syncContainers(db, lines)
+			time.Sleep(syncInterval)
+		}
+	}()
+	go func() {
+		for range time.Tick(time.Hour) {
+			if n, err := Prune(db); err != nil {
+				log.Printf("[WARN] logship: prune failed: %v", err)
+			} else if n > 0 {
+				log.Printf("[INFO] logship: pruned %d old lines", n)
+			}
+		}
+	}()
+}
+
+// syncContainers starts following the application containers that are not
+// followed yet. A container replaced by a redeploy is followed until Docker
+// removes it, which ends its log stream, so its last lines are kept.
+func syncContainers(db *sql.DB, lines chan<- entry) {
+	rows, err := db.Query("SELECT id, container_id FROM applications WHERE container_id IS NOT NULL AND container_id != ''")
+	if err != nil {
+		log.Printf("[WARN] logship: could not load applications: %v", err)
+		return
+	}
+	targets := map[string]int64{}
+	for rows.Next() {
+		var id int64
+		var containerID string
+		if err := rows.Scan(&id, &containerID); err == nil {
+			targets[containerID] = id
+		}
+	}
+	rows.Close()
+
+	mu.Lock()
+	for id := range last {
+		if _, ok := targets[id]; !ok && !tailing[id] {
+			delete(last, id)
+		}
+	}
+	for id := range drained {
+		if _, ok := targets[id]; !ok {
+			delete(drained, id)
+		}
+	}
+	var start []string
+	for id := range targets {
+		if !tailing[id] {
+			start = append(start, id)
+		}
+	}
+	mu.Unlock()
+	if len(start) == 0 {
+		return
+	}
+
+	cli, err := dockerutil.NewClient()
+	if err != nil {
+		log.Printf("[WARN] logship: docker client: %v", err)
+		return
+	}
+	defer cli.Close()
+	for _, id := range start {
+		info, err := cli.ContainerInspect(context.Background(), id)
+		if err != nil {
+			continue
+		}
+		finished, _ := time.Parse(time.RFC3339Nano, info.State.FinishedAt)
+		mu.Lock()
+		skip := !info.State.Running && drained[id].Equal(finished)
+		if !skip {
+			tailing[id] = true
+			go follow(db, targets[id], id, info.Config != nil && info.Config.Tty, lines)
+		}
+		mu.Unlock()
+	}
+}
+
+// follow ships the output of a container from where the last pass stopped
+// until its log stream ends
+func follow(db *sql.DB, appID int64, containerID string, tty bool, lines chan<- entry) {
+	defer func() {
+		mu.Lock()
+		delete(tailing, containerID)
+		mu.Unlock()
+	}()
+	cli, err := dockerutil.NewClient()
+	if err != nil {
+		log.Printf("[WARN] logship: docker client: %v", err)
+		return
+	}
+	defer cli.Close()
+
+	// Docker takes whole seconds; lines already stored are skipped by scan
+	since := lastShipped(db, containerID)
+	if since.IsZero() {
+		since = time.Now().Add(-Retention())
+	}
+	opts := types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true, Follow: true, Timestamps: true, Since: strconv.FormatInt(since.Unix(), 10)}
+	reader, err := cli.ContainerLogs(context.Background(), containerID, opts)
+	if err != nil {
+		if !client.IsErrNotFound(err) {
+			log.Printf("[WARN] logship: could not follow container %s: %v", short(containerID), err)
+		}
+		return
+	}
+	defer reader.Close()
+
+	outR, outW := io.Pipe()
+	errR, errW := io.Pipe()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go scan(outR, &wg, appID, containerID, "stdout", since, lines)
+	go scan(errR, &wg, appID, containerID, "stderr", since, lines)
+	if tty {
+		_, err = io.Copy(outW, reader)
+	} else {
+		_, err = stdcopy.StdCopy(outW, errW, reader)
+	}
+	outW.CloseWithError(err)
+	errW.CloseWithError(err)
+	wg.Wait()
+	lines <- entry{containerID: containerID, done: true}
+
+	// The stream ends when the container stops; remember that it was read
+	// to the end so that it is not read again until it restarts
+	info, err := cli.ContainerInspect(context.Background(), containerID)
+	if err == nil && !info.State.Running {
+		finished, _ := time.Parse(time.RFC3339Nano, info.State.FinishedAt)
+		mu.Lock()
+		drained[containerID] = finished
+		mu.Unlock()
+	}
+}
+
+// scan splits one output stream of a container into lines and queues them,
+// skipping the ones stored by an earlier pass
+func scan(r *io.PipeReader, wg *sync.WaitGroup, appID int64, containerID, stream string, since time.Time, lines chan<- entry) {
+	defer wg.Done()
+	br := bufio.NewReaderSize(r, 64<<10)
+	for {
+		line, err := readLine(br)
+		if line == "" && err != nil {
+			// Unblock the demultiplexer if reading failed
+			r.CloseWithError(err)
+			return
+		}
+		e := entry{appID: appID, containerID: containerID, stream: stream, ts: time.Now(), line: line}
+		// Docker puts an RFC 3339 timestamp and a space before each line
+		if ts, rest, ok := strings.Cut(e.line, " "); ok {
+			if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+				e.ts, e.line = t, rest
+			}
+		}
+		if e.ts.After(since) {
+			lines <- e
+		}
+		if err != nil {
+			r.CloseWithError(err)
+			return
+		}
+	}
+}
+
+// truncatedMark ends a line that was cut off at maxLine
+const truncatedMark = " [truncated]"
+
+// readLine reads one line without its line ending. A line longer than
+// maxLine is cut off, marked, and the rest of it is skipped.
+func readLine(br *bufio.Reader) (string, error) {
+	var buf []byte
+	truncated := false
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if !truncated {
+			buf = append(buf, chunk...)
+			if len(buf) > maxLine {
+				buf, truncated = buf[:maxLine], true
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		line := strings.TrimSuffix(strings.TrimSuffix(string(buf), "\n"), "\r")
+		if truncated {
+			line = strings.ToValidUTF8(line, "") + truncatedMark
+		}
+		return line, err
+	}
+}
+
+// lastShipped returns the time of the last stored line of a container
+func lastShipped(db *sql.DB, containerID string) time.Time {
+	mu.Lock()
+	t, ok := last[containerID]
+	mu.Unlock()
+	if ok {
+		return t
+	}
+	var ts sql.NullInt64
+	if err := db.QueryRow("SELECT MAX(ts) FROM container_logs WHERE container_id = ?", containerID).Scan(&ts); err != nil || !ts.Valid {
+		return time.Time{}
+	}
+	return time.Unix(0, ts.Int64)
+}
+
+// write stores queued lines in batches, tagging them with the deployment
+// that created their container
+func write(db *sql.DB, lines <-chan entry) {
+	deployments := map[string]int64{} // container ID -> deployment ID
+	var batch []entry
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := insert(db, batch, deployments); err != nil {
+			log.Printf("[WARN] logship: could not store %d lines: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case e := <-lines:
+			if e.done {
+				// Store the container's last lines before forgetting it;
+				// a restarted stream looks its deployment up again
+				flush()
+				delete(deployments, e.containerID)
+				continue
+			}
+			batch = append(batch, e)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// insert stores a batch in one transaction
+func insert(db *sql.DB, batch []entry, deployments map[string]int64) error {
+	looked := map[string]bool{}
+	for _, e := range batch {
+		if _, ok := deployments[e.containerID]; ok || looked[e.containerID] {
+			continue
+		}
+		looked[e.containerID] = true
+		// The deployment is recorded once its container is up, so earlier
+		// lines are tagged when it shows up
+		var id int64
+		if err := db.QueryRow("SELECT id FROM deployments WHERE container_id = ? ORDER BY id DESC LIMIT 1", e.containerID).Scan(&id); err == nil {
+			deployments[e.containerID] = id
+			if _, err := db.Exec("UPDATE container_logs SET deployment_id = ? WHERE container_id = ? AND deployment_id IS NULL", id, e.containerID); err != nil {
+				log.Printf("[WARN] logship: could not tag lines of container %s: %v", short(e.containerID), err)
+			}
+		}
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare("INSERT INTO container_logs (application_id, deployment_id, container_id, stream, ts, line) VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, e := range batch {
+		var deployment sql.NullInt64
+		if id, ok := deployments[e.containerID]; ok {
+			deployment = sql.NullInt64{Int64: id, Valid: true}
+		}
+		if _, err := stmt.Exec(e.appID, deployment, e.containerID, e.stream, e.ts.UnixNano(), e.line); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	mu.Lock()
+	for _, e := range batch {
+		if e.ts.After(last[e.containerID]) {
+			last[e.containerID] = e.ts
+		}
+	}
+	mu.Unlock()
+	return nil
+}
+
+// short abbreviates a container ID like the Docker CLI
+func short(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,35 @@
+package logship
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadLine(t *testing.T) {
+	long := strings.Repeat("a", maxLine+100)
+	// A three-byte rune straddling maxLine is dropped rather than cut in half
+	split := strings.Repeat("a", maxLine-1) + "€" + "tail"
+	input := "first\nwindows\r\n" + long + "\nafter\n" + split + "\nlast"
+	br := bufio.NewReaderSize(strings.NewReader(input), 16)
+
+	want := []struct {
+		line string
+		err  error
+	}{
+		{"first", nil},
+		{"windows", nil},
+		{long[:maxLine] + truncatedMark, nil},
+		{"after", nil},
+		{split[:maxLine-1] + truncatedMark, nil},
+		{"last", io.EOF},
+		{"", io.EOF},
+	}
+	for i, w := range want {
+		line, err := readLine(br)
+		if line != w.line || err != w.err {
+			t.Errorf("line %d: got %.40q (%d bytes), %v; want %.40q (%d bytes), %v", i, line, len(line), err, w.line, len(w.line), w.err)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+// Package logship copies the output of application containers into the
+// database, so that logs outlive the containers replaced by redeploys, and
+// searches it across applications and deployments.
+package logship
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/gakwaya-panel/api/internal/models"
+)
+
+// Retention returns LOG_RETENTION, how long lines are kept, defaulting to
+// 7 days; 0 turns shipping off
+func Retention() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("LOG_RETENTION")); err == nil && d >= 0 {
+		return d
+	}
+	return 7 * 24 * time.Hour
+}
+
+// MaxSize returns LOG_MAX_SIZE, how many bytes of lines are kept before the
+// oldest are dropped, defaulting to 1 GB
+func MaxSize() int64 {
+	if v, err := units.RAMInBytes(os.Getenv("LOG_MAX_SIZE")); err == nil && v > 0 {
+		return v
+	}
+	return 1 << 30
+}
+
+// fullText is set when the SQLite build has FTS5 and the index is in place
+var fullText atomic.Bool
+
+// FullText reports whether searches use the FTS5 index; otherwise they scan
+// the lines with LIKE
+func FullText() bool {
+	return fullText.Load()
+}
+
+// Setup creates the full-text index of container_logs when SQLite was built
+// with FTS5 (the sqlite_fts5 build tag). Without it the triggers feeding the
+// index are dropped, so that inserts keep working on a database that had one.
+func Setup(db *sql.DB) error {
+	// An existing index table opens without the module, so ask the build
+	var fts5 bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5); err != nil {
+		return err
+	}
+	if !fts5 {
+		log.Printf("[WARN] logship: SQLite was built without FTS5, so log searches scan every line; build with scripts/build.sh or -tags sqlite_fts5 for full-text search")
+		_, err := db.Exec("DROP TRIGGER IF EXISTS container_logs_ai; DROP TRIGGER IF EXISTS container_logs_ad")
+		return err
+	}
+	if _, err := db.Exec("CREATE VIRTUAL TABLE IF NOT EXISTS container_logs_fts USING fts5(line, content='container_logs', content_rowid='id')"); err != nil {
+		return err
+	}
+	var triggers int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name IN ('container_logs_ai', 'container_logs_ad')").Scan(&triggers); err != nil {
+		return err
+	}
+	if triggers < 2 {
+		// The index is new, or lines were stored while it was not fed
+		_, err := db.Exec(`
+		CREATE TRIGGER IF NOT EXISTS container_logs_ai AFTER INSERT ON container_logs BEGIN
+			INSERT INTO container_logs_fts (rowid, line) VALUES (new.id, new.line);
+		END;
+		CREATE TRIGGER IF NOT EXISTS container_logs_ad AFTER DELETE ON container_logs BEGIN
+			INSERT INTO container_logs_fts (container_logs_fts, rowid, line) VALUES ('delete', old.id, old.line);
+		END;
+		INSERT INTO container_logs_fts (container_logs_fts) VALUES ('rebuild');`)
+		if err != nil {
+			return err
+		}
+	}
+	fullText.Store(true)
+	return nil
+}
+
+// Query selects stored lines; zero fields do not filter
+type Query struct {
+	Text          string // words that must all appear in the line
+	ApplicationID int64
+	DeploymentID  int64
+	ContainerID   string // full ID or prefix
+	Stream        string
+	From, To      time.Time
+	Cursor        string // NextCursor of the previous page
+	Limit         int
+}
+
+// NoFullText explains why searches are slow without the FTS5 index
+const NoFullText = "full-text search is unavailable: the API was built without the sqlite_fts5 tag, so searches scan every line"
+
+// Page is one page of search results, newest first
+type Page struct {
+	Lines      []models.LogEntry `json:"lines"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+	FullText   bool              `json:"full_text"`
+	Warning    string            `json:"warning,omitempty"`
+}
+
+// ParseCursor checks a cursor returned by Search
+func ParseCursor(v string) (ts, id int64, err error) {
+	a, b, ok := strings.Cut(v, "-")
+	if ts, err = strconv.ParseInt(a, 10, 64); ok && err == nil {
+		if id, err = strconv.ParseInt(b, 10, 64); err == nil {
+			return ts, id, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid cursor %q", v)
+}
+
+// Search returns the lines matching q, newest first
+func Search(db *sql.DB, q Query) (Page, error) {
+	page := Page{Lines: []models.LogEntry{}, FullText: FullText()}
+	if !page.FullText {
+		page.Warning = NoFullText
+	}
+	query := "SELECT id, application_id, deployment_id, container_id, stream, ts, line FROM container_logs WHERE 1 = 1"
+	var args []any
+	if words := strings.Fields(q.Text); len(words) > 0 {
+		if page.FullText {
+			// Quote every word so that user input is never FTS5 syntax, and
+			// match it as a prefix
+			terms := make([]string, len(words))
+			for i, w := range words {
+				terms[i] = `"` + strings.ReplaceAll(w, `"`, `""`) + `"*`
+			}
+			query += " AND id IN (SELECT rowid FROM container_logs_fts WHERE container_logs_fts MATCH ?)"
+			args = append(args, strings.Join(terms, " "))
+		} else {
+			escape := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+			for _, w := range words {
+				query += ` AND line LIKE ? ESCAPE '\'`
+				args = append(args, "%"+escape.Replace(w)+"%")
+			}
+		}
+	}
+	if q.ApplicationID != 0 {
+		query += " AND application_id = ?"
+		args = append(args, q.ApplicationID)
+	}
+	if q.DeploymentID != 0 {
+		query += " AND deployment_id = ?"
+		args = append(args, q.DeploymentID)
+	}
+	if q.ContainerID != "" {
+		query += " AND container_id >= ? AND container_id < ?"
+		args = append(args, q.ContainerID, q.ContainerID+"\xff")
+	}
+	if q.Stream != "" {
+		query += " AND stream = ?"
+		args = append(args, q.Stream)
+	}
+	if !q.From.IsZero() {
+		query += " AND ts >= ?"
+		args = append(args, q.From.UnixNano())
+	}
+	if !q.To.IsZero() {
+		query += " AND ts <= ?"
+		args = append(args, q.To.UnixNano())
+	}
+	if q.Cursor != "" {
+		ts, id, err := ParseCursor(q.Cursor)
+		if err != nil {
+			return page, err
+		}
+		query += " AND (ts < ? OR (ts = ? AND id < ?))"
+		args = append(args, ts, ts, id)
+	}
+	query += " ORDER BY ts DESC, id DESC LIMIT ?"
+	args = append(args, q.Limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+	var ts int64
+	for rows.Next() {
+		var e models.LogEntry
+		var deployment sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.ApplicationID, &deployment, &e.ContainerID, &e.Stream, &ts, &e.Line); err != nil {
+			return page, err
+		}
+		if deployment.Valid {
+			e.DeploymentID = &deployment.Int64
+		}
+		e.Time = time.Unix(0, ts).UTC()
+		page.Lines = append(page.Lines, e)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	if n := len(page.Lines); n == q.Limit {
+		page.NextCursor = fmt.Sprintf("%d-%d", ts, page.Lines[n-1].ID)
+	}
+	return page, nil
+}
+
+// Status describes the stored logs
+type Status struct {
+	Enabled   bool       `json:"enabled"`
+	FullText  bool       `json:"full_text"`
+	Lines     int64      `json:"lines"`
+	Bytes     int64      `json:"bytes"`
+	Oldest    *time.Time `json:"oldest,omitempty"`
+	Retention string     `json:"retention"`
+	MaxBytes  int64      `json:"max_bytes"`
+	Following int        `json:"following"`
+	Warning   string     `json:"warning,omitempty"`
+}
+
+// Stats reports how many lines are stored and the retention limits
+func Stats(db *sql.DB) (Status, error) {
+	s := Status{Enabled: Retention() > 0, FullText: FullText(), Retention: Retention().String(), MaxBytes: MaxSize(), Following: following()}
+	if !s.FullText {
+		s.Warning = NoFullText
+	}
+	var oldest sql.NullInt64
+	err := db.QueryRow("SELECT COUNT(*), COALESCE(SUM(LENGTH(CAST(line AS BLOB))), 0), MIN(ts) FROM container_logs").Scan(&s.Lines, &s.Bytes, &oldest)
+	if oldest.Valid {
+		t := time.Unix(0, oldest.Int64).UTC()
+		s.Oldest = &t
+	}
+	return s, err
+}
+
+// pruneBatch is how many lines one delete statement removes, so that the
+// shipper is not blocked for long
+const pruneBatch = 5000
+
+// Prune deletes lines older than the retention, then the oldest lines while
+// more than MaxSize bytes are stored
+func Prune(db *sql.DB) (int64, error) {
+	var total int64
+	cutoff := time.Now().Add(-Retention()).UnixNano()
+	for {
+		res, err := db.Exec("DELETE FROM container_logs WHERE id IN (SELECT id FROM container_logs WHERE ts < ? LIMIT ?)", cutoff, pruneBatch)
+		if err != nil {
+			return total, err
+		}
+		n, _ := res.RowsAffected()
+		total += n
+		if n < pruneBatch {
+			break
+		}
+	}
+
+	var size int64
+	if err := db.QueryRow("SELECT COALESCE(SUM(LENGTH(CAST(line AS BLOB))), 0) FROM container_logs").Scan(&size); err != nil {
+		return total, err
+	}
+	// Drop down to 90% of the limit so that pruning does not run on every
+	// pass once the limit is reached
+	excess := size - MaxSize()*9/10
+	if size <= MaxSize() {
+		excess = 0
+	}
+	for excess > 0 {
+		rows, err := db.Query("SELECT id, LENGTH(CAST(line AS BLOB)) FROM container_logs ORDER BY ts, id LIMIT ?", pruneBatch)
+		if err != nil {
+			return total, err
+		}
+		var ids []any
+		for rows.Next() && excess > 0 {
+			var id, n int64
+			if err := rows.Scan(&id, &n); err != nil {
+				rows.Close()
+				return total, err
+			}
+			ids = append(ids, id)
+			excess -= n
+		}
+		rows.Close()
+		if len(ids) == 0 {
+			break
+		}
+		res, err := db.Exec("DELETE FROM container_logs WHERE id IN (?"+strings.Repeat(", ?", len(ids)-1)+")", ids...)
+		if err != nil {
+			return total, err
+		}
+		n, _ := res.RowsAffected()
+		total += n
+	}
+	return total, nil
+}
@@ -0,0 +1,139 @@
+package logship
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/models"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestParseCursor(t *testing.T) {
+	tests := []struct {
+		in      string
+		ts, id  int64
+		wantErr bool
+	}{
+		{"1700000000000000000-42", 1700000000000000000, 42, false},
+		{"0-0", 0, 0, false},
+		{"", 0, 0, true},
+		{"123", 0, 0, true},
+		{"123-", 0, 0, true},
+		{"-42", 0, 0, true},
+		{"abc-42", 0, 0, true},
+		{"123-4-5", 0, 0, true},
+	}
+	for _, tt := range tests {
+		ts, id, err := ParseCursor(tt.in)
+		if (err != nil) != tt.wantErr || ts != tt.ts || id != tt.id {
+			t.Errorf("ParseCursor(%q) = %d, %d, %v; want %d, %d, error %v", tt.in, ts, id, err, tt.ts, tt.id, tt.wantErr)
+		}
+	}
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", t.TempDir()+"/panel.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := models.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := Setup(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSearch(t *testing.T) {
+	db := openTestDB(t)
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	batch := []entry{
+		{appID: 1, containerID: "aaa111", stream: "stdout", ts: base, line: "server started on port 8080"},
+		{appID: 1, containerID: "aaa111", stream: "stderr", ts: base.Add(time.Second), line: "error: connection refused"},
+		{appID: 1, containerID: "aaa111", stream: "stdout", ts: base.Add(2 * time.Second), line: "GET /health 200"},
+		{appID: 2, containerID: "bbb222", stream: "stdout", ts: base.Add(3 * time.Second), line: "100% done_ok"},
+		{appID: 2, containerID: "bbb222", stream: "stderr", ts: base.Add(4 * time.Second), line: "error: disk full"},
+	}
+	if err := insert(db, batch, map[string]int64{}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := func(p Page) string {
+		var s []string
+		for _, e := range p.Lines {
+			s = append(s, e.Line)
+		}
+		return fmt.Sprint(s)
+	}
+	tests := []struct {
+		name string
+		q    Query
+		want string
+	}{
+		{"all, newest first", Query{}, "[error: disk full 100% done_ok GET /health 200 error: connection refused server started on port 8080]"},
+		{"words all match", Query{Text: "error refused"}, "[error: connection refused]"},
+		{"prefix", Query{Text: "conn"}, "[error: connection refused]"},
+		{"application", Query{ApplicationID: 2}, "[error: disk full 100% done_ok]"},
+		{"container prefix", Query{ContainerID: "aaa"}, "[GET /health 200 error: connection refused server started on port 8080]"},
+		{"stream", Query{Stream: "stderr"}, "[error: disk full error: connection refused]"},
+		{"time range", Query{From: base.Add(time.Second), To: base.Add(2 * time.Second)}, "[GET /health 200 error: connection refused]"},
+		{"no match", Query{Text: "timeout"}, "[]"},
+	}
+	if !FullText() {
+		// LIKE treats % and _ literally once escaped
+		tests = append(tests, struct {
+			name string
+			q    Query
+			want string
+		}{"wildcards escaped", Query{Text: "0%"}, "[100% done_ok]"})
+	}
+	for _, tt := range tests {
+		if tt.q.Limit == 0 {
+			tt.q.Limit = 10
+		}
+		p, err := Search(db, tt.q)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := lines(p); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+		if p.FullText != FullText() || (p.Warning == "") != p.FullText {
+			t.Errorf("%s: full_text %v with warning %q", tt.name, p.FullText, p.Warning)
+		}
+	}
+
+	// Pages of two walk every line once
+	var seen []string
+	q := Query{Limit: 2}
+	for i := 0; i < 5; i++ {
+		p, err := Search(db, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range p.Lines {
+			seen = append(seen, e.Line)
+		}
+		if p.NextCursor == "" {
+			break
+		}
+		q.Cursor = p.NextCursor
+	}
+	if got, want := fmt.Sprint(seen), "[error: disk full 100% done_ok GET /health 200 error: connection refused server started on port 8080]"; got != want {
+		t.Errorf("paged: got %s, want %s", got, want)
+	}
+
+	// User input is never FTS5 syntax
+	if _, err := Search(db, Query{Text: `"error OR NOT (`, Limit: 10}); err != nil {
+		t.Errorf("Search with query syntax: %v", err)
+	}
+	if _, err := Search(db, Query{Cursor: "bogus", Limit: 10}); err == nil {
+		t.Error("Search with an invalid cursor succeeded")
+	}
+}
@@ -0,0 +1,225 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/gakwaya-panel/api/internal/dockerutil"
+)
+
+// maxParallel bounds the stats requests in flight during one pass
+const maxParallel = 8
+
+// counters are the cumulative values of one stats reading
+type counters struct {
+	containerID string
+	read        time.Time
+	cpuTotal    uint64
+	systemCPU   uint64
+	onlineCPUs  uint32
+	netRx       uint64
+	netTx       uint64
+	blkRead     uint64
+	blkWrite    uint64
+}
+
+// Collector samples the containers of all applications on an interval
+type Collector struct {
+	db   *sql.DB
+	mu   sync.Mutex
+	prev map[int64]counters // application ID -> previous reading
+}
+
+// Start runs the collector in the background unless METRICS_INTERVAL is 0,
+// and prunes expired points every hour
+func Start(db *sql.DB) {
+	c := &Collector{db: db, prev: map[int64]counters{}}
+	interval := Interval()
+	if interval == 0 {
+		log.Printf("[INFO] metrics: collector disabled")
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			c.collect(context.Background())
+		}
+	}()
+	go func() {
+		for range time.Tick(time.Hour) {
+			if n, err := Prune(db); err != nil {
+				log.Printf("[WARN] metrics: prune failed: %v", err)
+			} else if n > 0 {
+				log.Printf("[INFO] metrics: pruned %d expired points", n)
+			}
+		}
+	}()
+}
+
+// collect takes one reading of every deployed application container
+func (c *Collector) collect(ctx context.Context) {
+	rows, err := c.db.Query("SELECT id, container_id FROM applications WHERE container_id IS NOT NULL AND container_id != ''")
+	if err != nil {
+		log.Printf("[WARN] metrics: could not load applications: %v", err)
+		return
+	}
+	targets := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var containerID string
+		if err := rows.Scan(&id, &containerID); err == nil {
+			targets[id] = containerID
+		}
+	}
+	rows.Close()
+
+	c.mu.Lock()
+	for id := range c.prev {
+		if _, ok := targets[id]; !ok {
+			delete(c.prev, id)
+		}
+	}
+	c.mu.Unlock()
+	if len(targets) == 0 {
+		return
+	}
+
+	cli, err := dockerutil.NewClient()
+	if err != nil {
+		log.Printf("[WARN] metrics: docker client: %v", err)
+		return
+	}
+	defer cli.Close()
+
+	sem := make(chan struct{}, maxParallel)
+	var wg sync.WaitGroup
+	for id, containerID := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id int64, containerID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			c.sampleOne(ctx, cli, id, containerID)
+		}(id, containerID)
+	}
+	wg.Wait()
+}
+
+// sampleOne reads a container's stats and records the usage since the
+// previous reading. The first reading of a container only sets the baseline.
+func (c *Collector) sampleOne(ctx context.Context, cli *client.Client, appID int64, containerID string) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	resp, err := cli.ContainerStatsOneShot(ctx, containerID)
+	if err != nil {
+		c.forget(appID)
+		return
+	}
+	defer resp.Body.Close()
+	var stats types.StatsJSON
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		c.forget(appID)
+		return
+	}
+	// Stopped containers report zeroed stats
+	if stats.CPUStats.CPUUsage.TotalUsage == 0 && stats.MemoryStats.Usage == 0 {
+		c.forget(appID)
+		return
+	}
+	cur := readCounters(containerID, &stats)
+
+	c.mu.Lock()
+	prev, ok := c.prev[appID]
+	c.prev[appID] = cur
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	s, ok := rates(prev, cur, &stats)
+	if !ok {
+		return
+	}
+	if err := record(c.db, appID, cur.read, s); err != nil {
+		log.Printf("[WARN] metrics: could not record sample of application %d: %v", appID, err)
+	}
+}
+
+// rates computes the usage between two readings of a container. It fails
+// when the readings belong to a new container, a restart or a counter reset;
+// the caller then starts over from cur.
+func rates(prev, cur counters, stats *types.StatsJSON) (sample, bool) {
+	if prev.containerID != cur.containerID || !cur.read.After(prev.read) ||
+		cur.cpuTotal < prev.cpuTotal || cur.netRx < prev.netRx || cur.netTx < prev.netTx {
+		return sample{}, false
+	}
+	secs := cur.read.Sub(prev.read).Seconds()
+	s := sample{
+		memoryBytes: memoryUsage(stats),
+		memoryLimit: int64(stats.MemoryStats.Limit),
+		netRxRate:   float64(cur.netRx-prev.netRx) / secs,
+		netTxRate:   float64(cur.netTx-prev.netTx) / secs,
+	}
+	if cur.blkRead >= prev.blkRead && cur.blkWrite >= prev.blkWrite {
+		s.blkReadRate = float64(cur.blkRead-prev.blkRead) / secs
+		s.blkWriteRate = float64(cur.blkWrite-prev.blkWrite) / secs
+	}
+	if cur.systemCPU > prev.systemCPU {
+		// Same formula as `docker stats`: share of host CPU time, times CPUs
+		s.cpuPercent = float64(cur.cpuTotal-prev.cpuTotal) / float64(cur.systemCPU-prev.systemCPU) * float64(cur.onlineCPUs) * 100
+	}
+	return s, true
+}
+
+func (c *Collector) forget(appID int64) {
+	c.mu.Lock()
+	delete(c.prev, appID)
+	c.mu.Unlock()
+}
+
+// readCounters extracts the cumulative counters of a stats reading
+func readCounters(containerID string, stats *types.StatsJSON) counters {
+	cur := counters{
+		containerID: containerID,
+		read:        stats.Read,
+		cpuTotal:    stats.CPUStats.CPUUsage.TotalUsage,
+		systemCPU:   stats.CPUStats.SystemUsage,
+		onlineCPUs:  stats.CPUStats.OnlineCPUs,
+	}
+	if cur.read.IsZero() {
+		cur.read = time.Now()
+	}
+	if cur.onlineCPUs == 0 {
+		cur.onlineCPUs = uint32(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	for _, n := range stats.Networks {
+		cur.netRx += n.RxBytes
+		cur.netTx += n.TxBytes
+	}
+	for _, e := range stats.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(e.Op) {
+		case "read":
+			cur.blkRead += e.Value
+		case "write":
+			cur.blkWrite += e.Value
+		}
+	}
+	return cur
+}
+
+// memoryUsage returns the memory in use without the inactive page cache,
+// like `docker stats` (cgroup v1 and v2)
+func memoryUsage(stats *types.StatsJSON) int64 {
+	usage := stats.MemoryStats.Usage
+	if v, ok := stats.MemoryStats.Stats["total_inactive_file"]; ok && v < usage {
+		usage -= v
+	} else if v, ok := stats.MemoryStats.Stats["inactive_file"]; ok && v < usage {
+		usage -= v
+	}
+	return int64(usage)
+}
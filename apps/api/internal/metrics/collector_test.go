@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestRates(t *testing.T) {
+	at := time.Date(2024, 6, 10, 10, 0, 0, 0, time.UTC)
+	prev := counters{containerID: "c1", read: at, cpuTotal: 1e9, systemCPU: 100e9, onlineCPUs: 4,
+		netRx: 1000, netTx: 2000, blkRead: 100, blkWrite: 100}
+	stats := &types.StatsJSON{}
+	stats.MemoryStats.Usage = 300 << 20
+	stats.MemoryStats.Stats = map[string]uint64{"inactive_file": 100 << 20}
+	stats.MemoryStats.Limit = 1 << 30
+
+	cur := prev
+	cur.read = at.Add(10 * time.Second)
+	cur.cpuTotal += 5e9
+	cur.systemCPU += 40e9
+	cur.netRx += 10000
+	cur.netTx += 500
+	cur.blkRead += 4096
+	cur.blkWrite += 8192
+	s, ok := rates(prev, cur, stats)
+	if !ok {
+		t.Fatal("rates rejected consecutive readings")
+	}
+	want := sample{cpuPercent: 50, memoryBytes: 200 << 20, memoryLimit: 1 << 30,
+		netRxRate: 1000, netTxRate: 50, blkReadRate: 409.6, blkWriteRate: 819.2}
+	if math.Abs(s.cpuPercent-want.cpuPercent) > 1e-9 {
+		t.Errorf("cpuPercent = %v, want %v", s.cpuPercent, want.cpuPercent)
+	}
+	s.cpuPercent = want.cpuPercent
+	if s != want {
+		t.Errorf("rates = %+v, want %+v", s, want)
+	}
+
+	blkReset := cur
+	blkReset.blkRead = 50
+	if s, ok := rates(prev, blkReset, stats); !ok || s.blkReadRate != 0 || s.blkWriteRate != 0 {
+		t.Errorf("block counter reset: rates = %+v, %v; want zero block rates", s, ok)
+	}
+	noSystem := cur
+	noSystem.systemCPU = prev.systemCPU
+	if s, ok := rates(prev, noSystem, stats); !ok || s.cpuPercent != 0 {
+		t.Errorf("no system CPU time: rates = %+v, %v; want zero CPU", s, ok)
+	}
+
+	for name, bad := range map[string]func(c *counters){
+		"other container": func(c *counters) { c.containerID = "c2" },
+		"same time":       func(c *counters) { c.read = prev.read },
+		"cpu reset":       func(c *counters) { c.cpuTotal = 0 },
+		"network reset":   func(c *counters) { c.netRx = 0 },
+	} {
+		c := cur
+		bad(&c)
+		if _, ok := rates(prev, c, stats); ok {
+			t.Errorf("%s: rates accepted the readings", name)
+		}
+	}
+}
+
+func TestMemoryUsage(t *testing.T) {
+	tests := []struct {
+		usage uint64
+		stats map[string]uint64
+		want  int64
+	}{
+		{100, nil, 100},
+		{100, map[string]uint64{"total_inactive_file": 30}, 70},
+		{100, map[string]uint64{"inactive_file": 40}, 60},
+		{100, map[string]uint64{"inactive_file": 200}, 100},
+	}
+	for _, tt := range tests {
+		stats := &types.StatsJSON{}
+		stats.MemoryStats.Usage = tt.usage
+		stats.MemoryStats.Stats = tt.stats
+		if got := memoryUsage(stats); got != tt.want {
+			t.Errorf("memoryUsage(%d, %v) = %d, want %d", tt.usage, tt.stats, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/gakwaya-panel/api/internal/models"
+)
+
+// ErrStreamEnded is returned by Stream when Docker closes the stats stream,
+// usually because the container stopped
+var ErrStreamEnded = errors.New("stats stream ended")
+
+// Stream follows the streaming stats API of a container and calls fn with
+// the usage since the previous reading, about once a second. The first
+// reading, and the first after a restart, only set the baseline. It returns
+// when ctx is done, which also closes the Docker stream.
+func Stream(ctx context.Context, cli *client.Client, containerID string, fn func(models.MetricPoint)) error {
+	resp, err := cli.ContainerStats(ctx, containerID, true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	var prev counters
+	var havePrev bool
+	for {
+		var stats types.StatsJSON
+		if err := dec.Decode(&stats); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, io.EOF) {
+				return ErrStreamEnded
+			}
+			return err
+		}
+		// Stopped containers report zeroed stats
+		if stats.CPUStats.CPUUsage.TotalUsage == 0 && stats.MemoryStats.Usage == 0 {
+			havePrev = false
+			continue
+		}
+		cur := readCounters(containerID, &stats)
+		last := prev
+		ok := havePrev
+		prev, havePrev = cur, true
+		if !ok {
+			continue
+		}
+		s, ok := rates(last, cur, &stats)
+		if !ok {
+			continue
+		}
+		p := models.MetricPoint{
+			Time:           cur.read.UTC(),
+			CPUPercent:     s.cpuPercent,
+			MemoryBytes:    s.memoryBytes,
+			MemoryLimit:    s.memoryLimit,
+			NetworkRxRate:  s.netRxRate,
+			NetworkTxRate:  s.netTxRate,
+			BlockReadRate:  s.blkReadRate,
+			BlockWriteRate: s.blkWriteRate,
+			Samples:        1,
+		}
+		if p.MemoryLimit > 0 {
+			p.MemoryPercent = float64(p.MemoryBytes) / float64(p.MemoryLimit) * 100
+		}
+		fn(p)
+	}
+}
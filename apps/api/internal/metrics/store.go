@@ -0,0 +1,306 @@
+// Package metrics samples the resource usage of application containers and
+// keeps it as downsampled time series in the panel database.
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/models"
+)
+
+// MaxPoints caps the points returned by one query; larger ranges get a coarser step
+const MaxPoints = 1000
+
+// Tier is one resolution of the stored series and how long it is kept
+type Tier struct {
+	Resolution time.Duration
+	Retention  time.Duration
+}
+
+// Tiers returns the stored resolutions, finest first: every sample
+// (METRICS_INTERVAL) for METRICS_RETENTION_RAW, 5-minute averages for
+// METRICS_RETENTION_5M and hourly averages for METRICS_RETENTION_1H.
+// Resolutions are unique: an interval of 5 minutes or more replaces the
+// averages it is not finer than, keeping the longer retention, since their
+// points would share rows.
+func Tiers() []Tier {
+	raw := Tier{Interval(), envDuration("METRICS_RETENTION_RAW", 24*time.Hour)}
+	tiers := []Tier{raw}
+	for _, t := range []Tier{
+		{5 * time.Minute, envDuration("METRICS_RETENTION_5M", 7*24*time.Hour)},
+		{time.Hour, envDuration("METRICS_RETENTION_1H", 90*24*time.Hour)},
+	} {
+		if raw.Resolution > 0 && t.Resolution <= raw.Resolution {
+			tiers[0].Retention = max(tiers[0].Retention, t.Retention)
+			continue
+		}
+		tiers = append(tiers, t)
+	}
+	return tiers
+}
+
+// Interval returns METRICS_INTERVAL, defaulting to 15 seconds. Zero
+// disables the collector.
+func Interval() time.Duration {
+	if v, ok := os.LookupEnv("METRICS_INTERVAL"); ok {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			if d > 0 && d < time.Second {
+				d = time.Second
+			}
+			return d
+		}
+	}
+	return 15 * time.Second
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(name)); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+// sample is one computed measurement of a container
+type sample struct {
+	cpuPercent   float64
+	memoryBytes  int64
+	memoryLimit  int64
+	netRxRate    float64
+	netTxRate    float64
+	blkReadRate  float64
+	blkWriteRate float64
+}
+
+// record folds a sample into the current bucket of every tier as a running average
+func record(db *sql.DB, appID int64, at time.Time, s sample) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, tier := range Tiers() {
+		res := int64(tier.Resolution / time.Second)
+		if res <= 0 {
+			continue
+		}
+		ts := at.Unix() / res * res
+		_, err := tx.Exec(`INSERT INTO container_metrics (application_id, resolution, ts, cpu_percent, memory_bytes, memory_limit, net_rx_rate, net_tx_rate, blk_read_rate, blk_write_rate, samples)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)
+			ON CONFLICT(application_id, resolution, ts) DO UPDATE SET
+				cpu_percent = (cpu_percent * samples + excluded.cpu_percent) / (samples + 1),
+				memory_bytes = (memory_bytes * samples + excluded.memory_bytes) / (samples + 1),
+				memory_limit = excluded.memory_limit,
+				net_rx_rate = (net_rx_rate * samples + excluded.net_rx_rate) / (samples + 1),
+				net_tx_rate = (net_tx_rate * samples + excluded.net_tx_rate) / (samples + 1),
+				blk_read_rate = (blk_read_rate * samples + excluded.blk_read_rate) / (samples + 1),
+				blk_write_rate = (blk_write_rate * samples + excluded.blk_write_rate) / (samples + 1),
+				samples = samples + 1`,
+			appID, res, ts, s.cpuPercent, s.memoryBytes, s.memoryLimit, s.netRxRate, s.netTxRate, s.blkReadRate, s.blkWriteRate)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Prune deletes points older than their tier's retention
+func Prune(db *sql.DB) (int64, error) {
+	var total int64
+	now := time.Now()
+	for _, tier := range Tiers() {
+		res := int64(tier.Resolution / time.Second)
+		r, err := db.Exec("DELETE FROM container_metrics WHERE resolution = ? AND ts < ?", res, now.Add(-tier.Retention).Unix())
+		if err != nil {
+			return total, err
+		}
+		n, _ := r.RowsAffected()
+		total += n
+	}
+	// Series of resolutions no longer configured
+	var keep []any
+	for _, tier := range Tiers() {
+		keep = append(keep, int64(tier.Resolution/time.Second))
+	}
+	r, err := db.Exec("DELETE FROM container_metrics WHERE resolution NOT IN (?"+strings.Repeat(", ?", len(keep)-1)+")", keep...)
+	if err != nil {
+		return total, err
+	}
+	n, _ := r.RowsAffected()
+	return total + n, nil
+}
+
+// Series is the answer to a metrics query
+type Series struct {
+	ApplicationID int64                `json:"application_id"`
+	From          time.Time            `json:"from"`
+	To            time.Time            `json:"to"`
+	Step          int64                `json:"step"`       // seconds between points
+	Resolution    int64                `json:"resolution"` // seconds of the tier read
+	Points        []models.MetricPoint `json:"points"`
+}
+
+// Query returns the averaged series of an application between from and to.
+// It reads the finest tier that still covers from and whose resolution is
+// no finer than needed; step is rounded up to a multiple of that resolution.
+func Query(db *sql.DB, appID int64, from, to time.Time, step time.Duration) (*Series, error) {
+	if !to.After(from) {
+		return nil, errors.New("to must be after from")
+	}
+	span := to.Sub(from)
+	if step <= 0 {
+		step = span / 300
+	}
+	if min := span / MaxPoints; step < min {
+		step = min
+	}
+	tiers := Tiers()
+	tier := tiers[len(tiers)-1]
+	for _, t := range tiers {
+		if t.Resolution > 0 && time.Since(from) <= t.Retention {
+			tier = t
+			break
+		}
+	}
+	// A coarser tier is enough, and cheaper, when the step spans its buckets
+	for _, t := range tiers {
+		if t.Resolution > tier.Resolution && t.Resolution <= step {
+			tier = t
+		}
+	}
+	res := int64(tier.Resolution / time.Second)
+	if res <= 0 {
+		return nil, fmt.Errorf("invalid resolution %s", tier.Resolution)
+	}
+	stepSec := int64((step + time.Second - 1) / time.Second)
+	if stepSec < res {
+		stepSec = res
+	}
+	stepSec = (stepSec + res - 1) / res * res
+
+	rows, err := db.Query(`SELECT ts / ? * ? AS bucket,
+			SUM(cpu_percent * samples) / SUM(samples),
+			SUM(memory_bytes * samples) / SUM(samples),
+			MAX(memory_limit),
+			SUM(net_rx_rate * samples) / SUM(samples),
+			SUM(net_tx_rate * samples) / SUM(samples),
+			SUM(blk_read_rate * samples) / SUM(samples),
+			SUM(blk_write_rate * samples) / SUM(samples),
+			SUM(samples)
+		FROM container_metrics
+		WHERE application_id = ? AND resolution = ? AND ts >= ? AND ts < ? AND samples > 0
+		GROUP BY bucket ORDER BY bucket`,
+		stepSec, stepSec, appID, res, from.Unix()/res*res, to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := &Series{ApplicationID: appID, From: from, To: to, Step: stepSec, Resolution: res, Points: []models.MetricPoint{}}
+	for rows.Next() {
+		var p models.MetricPoint
+		var ts int64
+		var memory float64
+		if err := rows.Scan(&ts, &p.CPUPercent, &memory, &p.MemoryLimit, &p.NetworkRxRate, &p.NetworkTxRate, &p.BlockReadRate, &p.BlockWriteRate, &p.Samples); err != nil {
+			return nil, err
+		}
+		p.Time = time.Unix(ts, 0).UTC()
+		p.MemoryBytes = int64(memory)
+		if p.MemoryLimit > 0 {
+			p.MemoryPercent = float64(p.MemoryBytes) / float64(p.MemoryLimit) * 100
+		}
+		out.Points = append(out.Points, p)
+	}
+	return out, rows.Err()
+}
+
+// AppSample is the latest averaged sample of one application
+type AppSample struct {
+	ApplicationID int64
+	Name          string
+	Status        string
+	Point         models.MetricPoint
+}
+
+// Latest returns the newest finest-tier point of each application sampled
+// within the last three intervals
+func Latest(db *sql.DB) ([]AppSample, error) {
+	interval := Interval()
+	if interval == 0 {
+		return nil, nil
+	}
+	res := int64(interval / time.Second)
+	rows, err := db.Query(`SELECT a.id, a.name, a.status, m.ts, m.cpu_percent, m.memory_bytes, m.memory_limit,
+			m.net_rx_rate, m.net_tx_rate, m.blk_read_rate, m.blk_write_rate, m.samples
+		FROM container_metrics m JOIN applications a ON a.id = m.application_id
+		WHERE m.resolution = ? AND m.ts = (SELECT MAX(ts) FROM container_metrics WHERE application_id = m.application_id AND resolution = ?) AND m.ts >= ?
+		ORDER BY a.name`, res, res, time.Now().Add(-3*interval).Unix()/res*res)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []AppSample
+	for rows.Next() {
+		var s AppSample
+		var ts int64
+		var memory float64
+		p := &s.Point
+		if err := rows.Scan(&s.ApplicationID, &s.Name, &s.Status, &ts, &p.CPUPercent, &memory, &p.MemoryLimit,
+			&p.NetworkRxRate, &p.NetworkTxRate, &p.BlockReadRate, &p.BlockWriteRate, &p.Samples); err != nil {
+			return nil, err
+		}
+		p.Time = time.Unix(ts, 0).UTC()
+		p.MemoryBytes = int64(memory)
+		if p.MemoryLimit > 0 {
+			p.MemoryPercent = float64(p.MemoryBytes) / float64(p.MemoryLimit) * 100
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// Window summarizes the finest-tier points of an application since a time
+type Window struct {
+	Points            int
+	First, Last       time.Time
+	MinCPU            float64
+	LastCPU           float64
+	MinMemoryPercent  float64 // -1 without a memory limit
+	LastMemoryPercent float64 // -1 without a memory limit
+}
+
+// Summary returns the lowest and the latest CPU and memory usage of an
+// application since a time, for rules that need a value to stay high
+func Summary(db *sql.DB, appID int64, since time.Time) (Window, error) {
+	w := Window{MinMemoryPercent: -1, LastMemoryPercent: -1}
+	interval := Interval()
+	if interval == 0 {
+		return w, nil
+	}
+	res := int64(interval / time.Second)
+	var first, last sql.NullInt64
+	var minCPU, minMem sql.NullFloat64
+	err := db.QueryRow(`SELECT COUNT(*), MIN(ts), MAX(ts), MIN(cpu_percent),
+			MIN(CASE WHEN memory_limit > 0 THEN memory_bytes * 100.0 / memory_limit END)
+		FROM container_metrics WHERE application_id = ? AND resolution = ? AND ts >= ? AND samples > 0`,
+		appID, res, since.Unix()).Scan(&w.Points, &first, &last, &minCPU, &minMem)
+	if err != nil || w.Points == 0 {
+		return w, err
+	}
+	w.First, w.Last = time.Unix(first.Int64, 0), time.Unix(last.Int64, 0)
+	w.MinCPU = minCPU.Float64
+	if minMem.Valid {
+		w.MinMemoryPercent = minMem.Float64
+	}
+	var memory float64
+	var limit int64
+	err = db.QueryRow("SELECT cpu_percent, memory_bytes, memory_limit FROM container_metrics WHERE application_id = ? AND resolution = ? AND ts = ?",
+		appID, res, last.Int64).Scan(&w.LastCPU, &memory, &limit)
+	if limit > 0 {
+		w.LastMemoryPercent = memory * 100 / float64(limit)
+	}
+	return w, err
+}
@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/models"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setTierEnv(t *testing.T, interval, raw, fiveMin, hour string) {
+	t.Helper()
+	t.Setenv("METRICS_INTERVAL", interval)
+	t.Setenv("METRICS_RETENTION_RAW", raw)
+	t.Setenv("METRICS_RETENTION_5M", fiveMin)
+	t.Setenv("METRICS_RETENTION_1H", hour)
+}
+
+func TestTiers(t *testing.T) {
+	const day = 24 * time.Hour
+	tests := []struct {
+		name                         string
+		interval, raw, fiveMin, hour string
+		want                         []Tier
+	}{
+		{"defaults", "15s", "", "", "", []Tier{{15 * time.Second, day}, {5 * time.Minute, 7 * day}, {time.Hour, 90 * day}}},
+		{"retention overrides", "30s", "2h", "48h", "720h", []Tier{{30 * time.Second, 2 * time.Hour}, {5 * time.Minute, 2 * day}, {time.Hour, 30 * day}}},
+		{"interval replaces 5m", "5m", "", "", "", []Tier{{5 * time.Minute, 7 * day}, {time.Hour, 90 * day}}},
+		{"interval replaces both", "2h", "2400h", "", "", []Tier{{2 * time.Hour, 100 * day}}},
+		{"longer raw retention kept", "10m", "240h", "", "", []Tier{{10 * time.Minute, 10 * day}, {time.Hour, 90 * day}}},
+		{"collector off", "0s", "", "", "", []Tier{{0, day}, {5 * time.Minute, 7 * day}, {time.Hour, 90 * day}}},
+	}
+	for _, tt := range tests {
+		setTierEnv(t, tt.interval, tt.raw, tt.fiveMin, tt.hour)
+		if got := Tiers(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Tiers() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", t.TempDir()+"/panel.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := models.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestQuery(t *testing.T) {
+	setTierEnv(t, "15s", "", "", "")
+	db := openTestDB(t)
+	base := time.Now().Add(-2 * time.Hour).Truncate(time.Hour)
+	for i, cpu := range []float64{10, 20, 30} {
+		s := sample{cpuPercent: cpu, memoryBytes: 100, memoryLimit: 400}
+		if err := record(db, 1, base.Add(time.Duration(i)*15*time.Second), s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := record(db, 2, base, sample{cpuPercent: 99}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		from, to   time.Time
+		step       time.Duration
+		resolution int64
+		stepSec    int64
+		cpu        []float64
+	}{
+		{"raw points", base, base.Add(time.Minute), 0, 15, 15, []float64{10, 20, 30}},
+		{"averaged step", base, base.Add(time.Minute), time.Minute, 15, 60, []float64{20}},
+		{"step rounded to the resolution", base, base.Add(time.Minute), 20 * time.Second, 15, 30, []float64{15, 30}},
+		{"coarser tier for a long step", base.Add(-time.Hour), base.Add(time.Hour), time.Hour, 3600, 3600, []float64{20}},
+		{"older than raw retention", base.Add(-72 * time.Hour), base.Add(time.Hour), 0, 300, 900, []float64{20}},
+		{"empty range", base.Add(time.Minute), base.Add(2 * time.Minute), 0, 15, 15, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series, err := Query(db, 1, tt.from, tt.to, tt.step)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if series.Resolution != tt.resolution || series.Step != tt.stepSec {
+				t.Errorf("resolution %d, step %d; want %d, %d", series.Resolution, series.Step, tt.resolution, tt.stepSec)
+			}
+			var cpu []float64
+			for _, p := range series.Points {
+				cpu = append(cpu, p.CPUPercent)
+				if p.MemoryPercent != 25 {
+					t.Errorf("MemoryPercent = %v, want 25", p.MemoryPercent)
+				}
+			}
+			if !reflect.DeepEqual(cpu, tt.cpu) {
+				t.Errorf("cpu = %v, want %v", cpu, tt.cpu)
+			}
+		})
+	}
+	if _, err := Query(db, 1, base, base, 0); err == nil {
+		t.Error("Query accepted an empty range")
+	}
+}
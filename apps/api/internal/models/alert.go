@@ -0,0 +1,74 @@
+package models
+
+import "time"
+
+// AlertRule raises an alert on an application event or when a measurement
+// stays past a threshold
+// Type is one of the rule types listed in docs/api/alerts_api.md; Threshold,
+// ForMinutes and Path are read per type. ApplicationID 0 matches every
+// application. Channels lists channel IDs to notify, all enabled channels
+// when empty. RepeatMinutes re-sends a still firing alert; 0 notifies once.
+
+type AlertRule struct {
+	ID            int64     `db:"id" json:"id"`
+	Name          string    `db:"name" json:"name"`
+	Type          string    `db:"type" json:"type"`
+	ApplicationID int64     `db:"application_id" json:"application_id,omitempty"`
+	Threshold     float64   `db:"threshold" json:"threshold,omitempty"`
+	ForMinutes    int       `db:"for_minutes" json:"for_minutes,omitempty"`
+	Path          string    `db:"path" json:"path,omitempty"`
+	Channels      []int64   `db:"channels" json:"channels"`
+	RepeatMinutes int       `db:"repeat_minutes" json:"repeat_minutes"`
+	Enabled       bool      `db:"enabled" json:"enabled"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+}
+
+// AlertChannel is a destination for alert notifications
+// Type is "webhook" (the alert as JSON), "slack", "discord" or "email".
+// URL is used by the webhook types and To by email; URL is masked in
+// responses because chat webhooks embed their token.
+
+type AlertChannel struct {
+	ID        int64     `db:"id" json:"id"`
+	Name      string    `db:"name" json:"name"`
+	Type      string    `db:"type" json:"type"`
+	URL       string    `db:"-" json:"url,omitempty"`
+	To        []string  `db:"-" json:"to,omitempty"`
+	Enabled   bool      `db:"enabled" json:"enabled"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// Alert is one incident of a rule for an application and subject (a disk
+// path, a certificate host, or empty). Repeated occurrences while it is
+// firing only raise Count, so each incident is notified once.
+
+type Alert struct {
+	ID             int64      `db:"id" json:"id"`
+	RuleID         int64      `db:"rule_id" json:"rule_id"`
+	RuleName       string     `db:"-" json:"rule_name"`
+	Type           string     `db:"type" json:"type"`
+	ApplicationID  int64      `db:"application_id" json:"application_id,omitempty"`
+	Subject        string     `db:"subject" json:"subject,omitempty"`
+	Message        string     `db:"message" json:"message"`
+	Status         string     `db:"status" json:"status"`
+	Silenced       bool       `db:"silenced" json:"silenced"`
+	Count          int        `db:"count" json:"count"`
+	StartedAt      time.Time  `db:"started_at" json:"started_at"`
+	LastSeenAt     time.Time  `db:"last_seen_at" json:"last_seen_at"`
+	ResolvedAt     *time.Time `db:"resolved_at" json:"resolved_at,omitempty"`
+	LastNotifiedAt *time.Time `db:"last_notified_at" json:"last_notified_at,omitempty"`
+}
+
+// AlertSilence mutes notifications of a rule, an application or both
+// until EndsAt; a zero RuleID or ApplicationID matches any
+
+type AlertSilence struct {
+	ID            int64     `db:"id" json:"id"`
+	RuleID        int64     `db:"rule_id" json:"rule_id,omitempty"`
+	ApplicationID int64     `db:"application_id" json:"application_id,omitempty"`
+	Reason        string    `db:"reason" json:"reason,omitempty"`
+	StartsAt      time.Time `db:"starts_at" json:"starts_at"`
+	EndsAt        time.Time `db:"ends_at" json:"ends_at"`
+	CreatedBy     string    `db:"created_by" json:"created_by,omitempty"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+}
@@ -6,19 +6,31 @@ import "time"
 // Env is a JSON-encoded string of environment variables
 
 type Application struct {
-	ID             int64             `db:"id" json:"id"`
-	Name           string            `db:"name" json:"name"`
-	Image          string            `db:"image" json:"image"`
-	Env            string            `db:"env" json:"env"`
-	Status         string            `db:"status" json:"status"`
-	CreatedAt      time.Time         `db:"created_at" json:"created_at"`
-	ContainerID    string            `db:"container_id" json:"container_id"`
-	Domain         string            `db:"domain" json:"domain"`
-	Port           int               `db:"port" json:"host_port"`
-	ContainerPort  int               `db:"container_port" json:"container_port"`
-	GitURL         string            `db:"git_url" json:"git_url,omitempty"`                 // Optional: Git repository URL
-	Branch         string            `db:"branch" json:"branch,omitempty"`                   // Optional: Git branch name
-	DockerfilePath string            `db:"dockerfile_path" json:"dockerfile_path,omitempty"` // Optional: Path to Dockerfile
-	Volumes        []string          `db:"volumes" json:"volumes,omitempty"`                 // Optional: Volumes (as string array)
-	BuildArgs      map[string]string `db:"build_args" json:"build_args,omitempty"`           // Optional: Build arguments (as map)
+	ID              int64               `db:"id" json:"id"`
+	Name            string              `db:"name" json:"name"`
+	Image           string              `db:"image" json:"image"`
+	Env             string              `db:"env" json:"env"`
+	Status          string              `db:"status" json:"status"`
+	CreatedAt       time.Time           `db:"created_at" json:"created_at"`
+	ContainerID     string              `db:"container_id" json:"container_id"`
+	Domain          string              `db:"domain" json:"domain"`
+	Port            int                 `db:"port" json:"host_port"`
+	ContainerPort   int                 `db:"container_port" json:"container_port"`
+	GitURL          string              `db:"git_url" json:"git_url,omitempty"`                     // Optional: Git repository URL
+	Branch          string              `db:"branch" json:"branch,omitempty"`                       // Optional: Git branch name
+	DockerfilePath  string              `db:"dockerfile_path" json:"dockerfile_path,omitempty"`     // Optional: Path to Dockerfile
+	Volumes         []string            `db:"volumes" json:"volumes,omitempty"`                     // Optional: Volumes (as string array)
+	BuildArgs       map[string]string   `db:"build_args" json:"build_args,omitempty"`               // Optional: Build arguments (as map)
+	ImageRetention  int                 `db:"image_retention" json:"image_retention"`               // Number of built images to keep (0 = panel default)
+	BuildTimeout    int                 `db:"build_timeout" json:"build_timeout"`                   // Build/deploy timeout in seconds (0 = BUILD_TIMEOUT)
+	ReleaseCommand  string              `db:"release_command" json:"release_command,omitempty"`     // Optional: Command run in a one-off container before switching traffic
+	PostDeployHooks []string            `db:"post_deploy_hooks" json:"post_deploy_hooks,omitempty"` // Optional: Commands run in the new container after a successful deploy
+	Domains         []string            `db:"domains" json:"domains,omitempty"`                     // Optional: Extra routed domains, each "host" or "host/path-prefix"
+	Ports           []PortMapping       `db:"ports" json:"ports,omitempty"`                         // Optional: Published ports; replaces host_port/container_port when set
+	Project         string              `db:"project" json:"project,omitempty"`                     // Optional: Apps in the same project share a private network
+	Networks        []NetworkAttachment `db:"networks" json:"networks,omitempty"`                   // Optional: Extra Docker networks joined at deploy time
+	Secrets         []string            `db:"secrets" json:"secrets,omitempty"`                     // Optional: Env/build arg names whose values are masked in responses
+	EnvGroups       []string            `db:"env_groups" json:"env_groups,omitempty"`               // Optional: Shared env groups, lowest precedence first
+	ServiceType     string              `db:"service_type" json:"service_type,omitempty"`           // Managed database engine ("postgres", "redis", ...); empty for apps
+	DatabaseLinks   []DatabaseLink      `db:"database_links" json:"database_links,omitempty"`       // Optional: Managed databases whose URLs are injected into env
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// AuditEntry records a sensitive action taken through the API
+// Action is a dotted verb such as "file.upload"; Target names what it acted on
+
+type AuditEntry struct {
+	ID            int64     `db:"id" json:"id"`
+	UserID        int64     `db:"user_id" json:"user_id"`
+	Username      string    `db:"username" json:"username"`
+	Action        string    `db:"action" json:"action"`
+	ApplicationID int64     `db:"application_id" json:"application_id,omitempty"`
+	Target        string    `db:"target" json:"target"`
+	Details       string    `db:"details" json:"details,omitempty"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Backup records one snapshot of an application volume or bind path, or one
+// logical dump of a database
+// Kind is "volume", "bind" or "dump" (Source is then the engine); Key locates
+// the file in Storage ("local" or "s3") and Checksum is its hex SHA-256
+
+type Backup struct {
+	ID            int64     `db:"id" json:"id"`
+	ApplicationID int64     `db:"application_id" json:"application_id"`
+	Kind          string    `db:"kind" json:"kind"`
+	Source        string    `db:"source" json:"source"`
+	Storage       string    `db:"storage" json:"storage"`
+	Key           string    `db:"key" json:"key"`
+	Size          int64     `db:"size" json:"size"`
+	Checksum      string    `db:"checksum" json:"checksum,omitempty"`
+	Status        string    `db:"status" json:"status"`
+	Error         string    `db:"error" json:"error,omitempty"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+}
+
+// BackupSchedule runs backups of an application on a cron expression and
+// keeps the newest Keep successful backups of each source. An application
+// can have several, e.g. hourly dumps and nightly volume snapshots.
+// Mode is "volumes" (tarballs of volumes and bind paths) or "dump" (a
+// logical dump with Engine, defaulting to the managed database's engine)
+
+type BackupSchedule struct {
+	ID            int64      `db:"id" json:"id"`
+	ApplicationID int64      `db:"application_id" json:"application_id"`
+	Cron          string     `db:"cron" json:"cron"`
+	Keep          int        `db:"keep" json:"keep"`
+	StopApp       bool       `db:"stop_app" json:"stop_app"`
+	Mode          string     `db:"mode" json:"mode"`
+	Engine        string     `db:"engine" json:"engine,omitempty"`
+	Enabled       bool       `db:"enabled" json:"enabled"`
+	LastRunAt     *time.Time `db:"last_run_at" json:"last_run_at,omitempty"`
+	NextRunAt     *time.Time `db:"-" json:"next_run_at,omitempty"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,8 @@
+package models
+
+// DatabaseLink injects the connection URL of a managed database into an
+// application's env under Env (the engine's default variable when empty)
+type DatabaseLink struct {
+	Database string `json:"database"`
+	Env      string `json:"env,omitempty"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Deployment records a single deploy of an application
+// Status is "succeeded" or "failed"; Log holds build/deploy output
+
+type Deployment struct {
+	ID            int64     `db:"id" json:"id"`
+	ApplicationID int64     `db:"application_id" json:"application_id"`
+	Image         string    `db:"image" json:"image"`
+	ContainerID   string    `db:"container_id" json:"container_id"`
+	Status        string    `db:"status" json:"status"`
+	Log           string    `db:"log" json:"log,omitempty"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// EnvGroup is a named set of environment variables shared by applications
+// Applications list groups in env_groups; later groups and the app's own env win
+
+type EnvGroup struct {
+	ID          int64             `db:"id" json:"id"`
+	Name        string            `db:"name" json:"name"`
+	Description string            `db:"description" json:"description,omitempty"`
+	Env         map[string]string `db:"env" json:"env"`
+	Secrets     []string          `db:"secrets" json:"secrets,omitempty"`
+	CreatedAt   time.Time         `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time         `db:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// LogEntry is one stored line of application container output
+// DeploymentID is nil for containers no deployment was recorded for
+
+type LogEntry struct {
+	ID            int64     `json:"id"`
+	ApplicationID int64     `json:"application_id"`
+	DeploymentID  *int64    `json:"deployment_id,omitempty"`
+	ContainerID   string    `json:"container_id"`
+	Stream        string    `json:"stream"`
+	Time          time.Time `json:"t"`
+	Line          string    `json:"line"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// MetricPoint is one averaged sample of a container's resource usage
+// Rates are per second; memory excludes the page cache like `docker stats`
+
+type MetricPoint struct {
+	Time           time.Time `json:"t"`
+	CPUPercent     float64   `json:"cpu_percent"`
+	MemoryBytes    int64     `json:"memory_bytes"`
+	MemoryLimit    int64     `json:"memory_limit_bytes"`
+	MemoryPercent  float64   `json:"memory_percent"`
+	NetworkRxRate  float64   `json:"network_rx_bytes_per_sec"`
+	NetworkTxRate  float64   `json:"network_tx_bytes_per_sec"`
+	BlockReadRate  float64   `json:"block_read_bytes_per_sec"`
+	BlockWriteRate float64   `json:"block_write_bytes_per_sec"`
+	Samples        int       `json:"samples"`
+}
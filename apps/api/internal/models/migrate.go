@@ -30,12 +30,251 @@ func Migrate(db *sql.DB) error {
 		volumes TEXT,
 		build_args TEXT
 	);
+	CREATE TABLE IF NOT EXISTS deployments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		application_id INTEGER NOT NULL,
+		image TEXT NOT NULL,
+		container_id TEXT,
+		status TEXT NOT NULL,
+		log TEXT,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_deployments_application ON deployments (application_id, id);
+	CREATE TABLE IF NOT EXISTS image_scans (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		image TEXT NOT NULL,
+		image_id TEXT NOT NULL,
+		scanner TEXT NOT NULL,
+		critical INTEGER NOT NULL DEFAULT 0,
+		high INTEGER NOT NULL DEFAULT 0,
+		medium INTEGER NOT NULL DEFAULT 0,
+		low INTEGER NOT NULL DEFAULT 0,
+		unknown INTEGER NOT NULL DEFAULT 0,
+		findings TEXT,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_image_scans_image_id ON image_scans (image_id, id);
+	CREATE TABLE IF NOT EXISTS backups (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		application_id INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		source TEXT NOT NULL,
+		storage TEXT NOT NULL,
+		key TEXT NOT NULL DEFAULT '',
+		size INTEGER NOT NULL DEFAULT 0,
+		status TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_backups_application ON backups (application_id, id);
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL DEFAULT 0,
+		username TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		application_id INTEGER NOT NULL DEFAULT 0,
+		target TEXT NOT NULL DEFAULT '',
+		details TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log (id);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_application ON audit_log (application_id, id);
+	CREATE TABLE IF NOT EXISTS backup_schedules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		application_id INTEGER NOT NULL,
+		cron TEXT NOT NULL,
+		keep INTEGER NOT NULL DEFAULT 0,
+		stop_app INTEGER NOT NULL DEFAULT 0,
+		enabled INTEGER NOT NULL DEFAULT 1,
+		last_run_at DATETIME,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_backup_schedules_application ON backup_schedules (application_id);
+	CREATE TABLE IF NOT EXISTS env_groups (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		description TEXT NOT NULL DEFAULT '',
+		env TEXT NOT NULL DEFAULT '',
+		secrets TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS container_metrics (
+		application_id INTEGER NOT NULL,
+		resolution INTEGER NOT NULL,
+		ts INTEGER NOT NULL,
+		cpu_percent REAL NOT NULL DEFAULT 0,
+		memory_bytes REAL NOT NULL DEFAULT 0,
+		memory_limit INTEGER NOT NULL DEFAULT 0,
+		net_rx_rate REAL NOT NULL DEFAULT 0,
+		net_tx_rate REAL NOT NULL DEFAULT 0,
+		blk_read_rate REAL NOT NULL DEFAULT 0,
+		blk_write_rate REAL NOT NULL DEFAULT 0,
+		samples INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (application_id, resolution, ts)
+	) WITHOUT ROWID;
+	CREATE TABLE IF NOT EXISTS alert_rules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL,
+		application_id INTEGER NOT NULL DEFAULT 0,
+		threshold REAL NOT NULL DEFAULT 0,
+		for_minutes INTEGER NOT NULL DEFAULT 0,
+		path TEXT NOT NULL DEFAULT '',
+		channels TEXT NOT NULL DEFAULT '',
+		repeat_minutes INTEGER NOT NULL DEFAULT 0,
+		enabled INTEGER NOT NULL DEFAULT 1,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS alert_channels (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		type TEXT NOT NULL,
+		config TEXT NOT NULL DEFAULT '',
+		enabled INTEGER NOT NULL DEFAULT 1,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS alerts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		rule_id INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		application_id INTEGER NOT NULL DEFAULT 0,
+		subject TEXT NOT NULL DEFAULT '',
+		message TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL,
+		silenced INTEGER NOT NULL DEFAULT 0,
+		count INTEGER NOT NULL DEFAULT 1,
+		started_at DATETIME NOT NULL,
+		last_seen_at DATETIME NOT NULL,
+		resolved_at DATETIME,
+		last_notified_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_alerts_open ON alerts (rule_id, application_id, subject, status);
+	CREATE TABLE IF NOT EXISTS uptime_checks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		application_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL,
+		url TEXT NOT NULL DEFAULT '',
+		expected_status INTEGER NOT NULL DEFAULT 0,
+		body_contains TEXT NOT NULL DEFAULT '',
+		address TEXT NOT NULL DEFAULT '',
+		interval_seconds INTEGER NOT NULL DEFAULT 60,
+		timeout_seconds INTEGER NOT NULL DEFAULT 10,
+		failure_threshold INTEGER NOT NULL DEFAULT 2,
+		enabled INTEGER NOT NULL DEFAULT 1,
+		state TEXT NOT NULL DEFAULT 'unknown',
+		state_since DATETIME,
+		failures INTEGER NOT NULL DEFAULT 0,
+		failing_since DATETIME,
+		last_checked_at DATETIME,
+		last_response_ms INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_uptime_checks_application ON uptime_checks (application_id);
+	CREATE TABLE IF NOT EXISTS uptime_results (
+		check_id INTEGER NOT NULL,
+		ts INTEGER NOT NULL,
+		up INTEGER NOT NULL,
+		response_ms INTEGER NOT NULL DEFAULT 0,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (check_id, ts)
+	) WITHOUT ROWID;
+	CREATE TABLE IF NOT EXISTS uptime_outages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		check_id INTEGER NOT NULL,
+		started_at DATETIME NOT NULL,
+		ended_at DATETIME,
+		error TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_uptime_outages_check ON uptime_outages (check_id, id);
+	CREATE TABLE IF NOT EXISTS container_logs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		application_id INTEGER NOT NULL,
+		deployment_id INTEGER,
+		container_id TEXT NOT NULL,
+		stream TEXT NOT NULL,
+		ts INTEGER NOT NULL,
+		line TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_container_logs_application ON container_logs (application_id, ts);
+	CREATE INDEX IF NOT EXISTS idx_container_logs_deployment ON container_logs (deployment_id, ts);
+	CREATE INDEX IF NOT EXISTS idx_container_logs_container ON container_logs (container_id, ts);
+	CREATE INDEX IF NOT EXISTS idx_container_logs_ts ON container_logs (ts);
+	CREATE TABLE IF NOT EXISTS alert_silences (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		rule_id INTEGER NOT NULL DEFAULT 0,
+		application_id INTEGER NOT NULL DEFAULT 0,
+		reason TEXT NOT NULL DEFAULT '',
+		starts_at DATETIME NOT NULL,
+		ends_at DATETIME NOT NULL,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
 	`
-	_, err := db.Exec(query)
-	return err
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+	columns := []struct{ name, definition string }{
+		{"image_retention", "INTEGER NOT NULL DEFAULT 0"},
+		{"build_timeout", "INTEGER NOT NULL DEFAULT 0"},
+		{"release_command", "TEXT NOT NULL DEFAULT ''"},
+		{"post_deploy_hooks", "TEXT NOT NULL DEFAULT ''"},
+		{"domains", "TEXT NOT NULL DEFAULT ''"},
+		{"ports", "TEXT NOT NULL DEFAULT ''"},
+		{"project", "TEXT NOT NULL DEFAULT ''"},
+		{"networks", "TEXT NOT NULL DEFAULT ''"},
+		{"secrets", "TEXT NOT NULL DEFAULT ''"},
+		{"env_groups", "TEXT NOT NULL DEFAULT ''"},
+		{"service_type", "TEXT NOT NULL DEFAULT ''"},
+		{"database_links", "TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, col := range columns {
+		if err := addColumnIfMissing(db, "applications", col.name, col.definition); err != nil {
+			return err
+		}
+	}
+	others := []struct{ table, name, definition string }{
+		{"backups", "checksum", "TEXT NOT NULL DEFAULT ''"},
+		{"backup_schedules", "mode", "TEXT NOT NULL DEFAULT 'volumes'"},
+		{"backup_schedules", "engine", "TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, col := range others {
+		if err := addColumnIfMissing(db, col.table, col.name, col.definition); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func AddContainerPortColumn(db *sql.DB) error {
 	_, err := db.Exec("ALTER TABLE applications ADD COLUMN container_port INTEGER;")
 	return err
 }
+
+// addColumnIfMissing adds a column to an existing table unless it is already there
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
+}
@@ -0,0 +1,8 @@
+package models
+
+// NetworkAttachment joins an application's container to a Docker network
+// under extra DNS aliases
+type NetworkAttachment struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+}
@@ -0,0 +1,11 @@
+package models
+
+// PortMapping publishes a container port on the host. A HostPort of 0 is
+// filled in from the panel's port range on the first deploy; a ContainerPort
+// of 0 uses the lowest port the image exposes (or 80).
+type PortMapping struct {
+	HostIP        string `json:"host_ip,omitempty"` // Empty binds all interfaces
+	HostPort      int    `json:"host_port"`
+	ContainerPort int    `json:"container_port"`
+	Protocol      string `json:"protocol,omitempty"` // tcp (default) or udp
+}
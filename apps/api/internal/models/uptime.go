@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// UptimeCheck probes an application endpoint from the panel on an interval
+// Type is "http" (URL must answer ExpectedStatus, any 2xx or 3xx when 0,
+// with BodyContains in the body when set) or "tcp" (Address must accept a
+// connection; without a host the application container is dialed). The
+// check goes down after FailureThreshold consecutive failures.
+
+type UptimeCheck struct {
+	ID               int64                  `db:"id" json:"id"`
+	ApplicationID    int64                  `db:"application_id" json:"application_id"`
+	Name             string                 `db:"name" json:"name"`
+	Type             string                 `db:"type" json:"type"`
+	URL              string                 `db:"url" json:"url,omitempty"`
+	ExpectedStatus   int                    `db:"expected_status" json:"expected_status,omitempty"`
+	BodyContains     string                 `db:"body_contains" json:"body_contains,omitempty"`
+	Address          string                 `db:"address" json:"address,omitempty"`
+	IntervalSeconds  int                    `db:"interval_seconds" json:"interval_seconds"`
+	TimeoutSeconds   int                    `db:"timeout_seconds" json:"timeout_seconds"`
+	FailureThreshold int                    `db:"failure_threshold" json:"failure_threshold"`
+	Enabled          bool                   `db:"enabled" json:"enabled"`
+	State            string                 `db:"state" json:"state"`
+	StateSince       *time.Time             `db:"state_since" json:"state_since,omitempty"`
+	Failures         int                    `db:"failures" json:"consecutive_failures"`
+	LastCheckedAt    *time.Time             `db:"last_checked_at" json:"last_checked_at,omitempty"`
+	LastResponseMS   int64                  `db:"last_response_ms" json:"last_response_ms"`
+	LastError        string                 `db:"last_error" json:"last_error,omitempty"`
+	CreatedAt        time.Time              `db:"created_at" json:"created_at"`
+	Uptime           map[string]UptimeStats `db:"-" json:"uptime,omitempty"`
+}
+
+// UptimeStats summarizes the results of a check over a window
+// UptimePercent and AverageResponseMS are nil without results
+
+type UptimeStats struct {
+	UptimePercent     *float64 `json:"uptime_percent"`
+	Checks            int      `json:"checks"`
+	Failures          int      `json:"failures"`
+	AverageResponseMS *float64 `json:"average_response_ms"`
+}
+
+// UptimeResult is one probe of a check
+
+type UptimeResult struct {
+	Time       time.Time `json:"t"`
+	Up         bool      `json:"up"`
+	ResponseMS int64     `json:"response_ms"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// UptimeOutage is a period a check was down; EndedAt is nil while it lasts
+
+type UptimeOutage struct {
+	ID        int64      `db:"id" json:"id"`
+	CheckID   int64      `db:"check_id" json:"check_id"`
+	StartedAt time.Time  `db:"started_at" json:"started_at"`
+	EndedAt   *time.Time `db:"ended_at" json:"ended_at,omitempty"`
+	Error     string     `db:"error" json:"error,omitempty"`
+}
@@ -0,0 +1,282 @@
+package ports
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/gakwaya-panel/api/internal/models"
+)
+
+// Range is the inclusive host port range automatic mappings are taken from
+type Range struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// ConfiguredRange returns PORT_RANGE ("start-end"), defaulting to 20000-29999
+func ConfiguredRange() Range {
+	r := Range{Start: 20000, End: 29999}
+	start, end, ok := strings.Cut(os.Getenv("PORT_RANGE"), "-")
+	if !ok {
+		return r
+	}
+	s, err1 := strconv.Atoi(strings.TrimSpace(start))
+	e, err2 := strconv.Atoi(strings.TrimSpace(end))
+	if err1 != nil || err2 != nil || s < 1 || e > 65535 || s > e {
+		return r
+	}
+	return Range{Start: s, End: e}
+}
+
+// Usage is a host port held by an application or a container
+type Usage struct {
+	HostIP        string `json:"host_ip,omitempty"`
+	HostPort      int    `json:"host_port"`
+	Protocol      string `json:"protocol"`
+	Owner         string `json:"owner"`
+	ApplicationID int64  `json:"application_id,omitempty"`
+}
+
+// ConflictError is returned when a requested host port is already taken
+type ConflictError struct {
+	Mapping models.PortMapping
+	Owner   string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("host port %s is already used by %s", describe(e.Mapping.HostIP, e.Mapping.HostPort, e.Mapping.Protocol), e.Owner)
+}
+
+// ErrRangeExhausted is returned when no free port is left in the range
+var ErrRangeExhausted = errors.New("no free host port left in PORT_RANGE")
+
+// mu serialises allocations so two deploys cannot pick the same free port
+var mu sync.Mutex
+
+func describe(ip string, port int, proto string) string {
+	if ip == "" {
+		return fmt.Sprintf("%d/%s", port, proto)
+	}
+	return fmt.Sprintf("%s/%s", net.JoinHostPort(ip, strconv.Itoa(port)), proto)
+}
+
+// isWildcard reports whether ip binds every interface
+func isWildcard(ip string) bool {
+	return ip == "" || ip == "0.0.0.0" || ip == "::"
+}
+
+// overlaps reports whether two bindings would collide on the host
+func overlaps(ipA string, portA int, protoA string, ipB string, portB int, protoB string) bool {
+	if portA != portB || protoA != protoB {
+		return false
+	}
+	return isWildcard(ipA) || isWildcard(ipB) || ipA == ipB
+}
+
+// Normalize validates mappings and fills in the default protocol
+func Normalize(mappings []models.PortMapping) ([]models.PortMapping, error) {
+	out := make([]models.PortMapping, 0, len(mappings))
+	for i, m := range mappings {
+		m.Protocol = strings.ToLower(strings.TrimSpace(m.Protocol))
+		if m.Protocol == "" {
+			m.Protocol = "tcp"
+		}
+		if m.Protocol != "tcp" && m.Protocol != "udp" {
+			return nil, fmt.Errorf("ports[%d]: protocol must be tcp or udp", i)
+		}
+		m.HostIP = strings.TrimSpace(m.HostIP)
+		if m.HostIP == "0.0.0.0" {
+			m.HostIP = ""
+		}
+		if m.HostIP != "" && net.ParseIP(m.HostIP) == nil {
+			return nil, fmt.Errorf("ports[%d]: invalid host_ip %q", i, m.HostIP)
+		}
+		if m.HostPort < 0 || m.HostPort > 65535 {
+			return nil, fmt.Errorf("ports[%d]: host_port must be between 0 and 65535", i)
+		}
+		if m.ContainerPort < 0 || m.ContainerPort > 65535 {
+			return nil, fmt.Errorf("ports[%d]: container_port must be between 0 and 65535", i)
+		}
+		for _, prev := range out {
+			if m.HostPort != 0 && overlaps(prev.HostIP, prev.HostPort, prev.Protocol, m.HostIP, m.HostPort, m.Protocol) {
+				return nil, fmt.Errorf("ports[%d]: host port %s is listed twice", i, describe(m.HostIP, m.HostPort, m.Protocol))
+			}
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// InUse lists host ports reserved by applications (other than excludeAppID)
+// and published by running containers that do not belong to excludeAppID
+func InUse(ctx context.Context, cli *client.Client, db *sql.DB, excludeAppID int64) ([]Usage, error) {
+	rows, err := db.Query("SELECT id, name, host_port, ports, container_id FROM applications")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	used := []Usage{}
+	owners := map[string]string{} // container ID -> owner
+	skip := map[string]bool{}
+	for rows.Next() {
+		var id int64
+		var name string
+		var hostPort sql.NullInt64
+		var portsJSON, containerID sql.NullString
+		if err := rows.Scan(&id, &name, &hostPort, &portsJSON, &containerID); err != nil {
+			return nil, err
+		}
+		if id == excludeAppID {
+			if containerID.String != "" {
+				skip[containerID.String] = true
+			}
+			continue
+		}
+		owner := "application " + name
+		if containerID.String != "" {
+			owners[containerID.String] = owner
+		}
+		var mappings []models.PortMapping
+		_ = json.Unmarshal([]byte(portsJSON.String), &mappings)
+		if len(mappings) == 0 && hostPort.Int64 > 0 {
+			mappings = []models.PortMapping{{HostPort: int(hostPort.Int64)}}
+		}
+		for _, m := range mappings {
+			if m.HostPort == 0 {
+				continue
+			}
+			proto := m.Protocol
+			if proto == "" {
+				proto = "tcp"
+			}
+			used = append(used, Usage{HostIP: m.HostIP, HostPort: m.HostPort, Protocol: proto, Owner: owner, ApplicationID: id})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, ctr := range containers {
+		if skip[ctr.ID] {
+			continue
+		}
+		// Panel containers are listed too: they may still hold ports their
+		// application no longer reserves until the next deploy
+		owner := owners[ctr.ID]
+		if owner == "" && len(ctr.Names) > 0 {
+			owner = "container " + strings.TrimPrefix(ctr.Names[0], "/")
+		} else if owner == "" {
+			owner = "container " + ctr.ID[:12]
+		}
+		for _, p := range ctr.Ports {
+			if p.PublicPort == 0 {
+				continue
+			}
+			used = append(used, Usage{HostIP: p.IP, HostPort: int(p.PublicPort), Protocol: p.Type, Owner: owner})
+		}
+	}
+	return used, nil
+}
+
+// hostFree reports whether nothing outside Docker listens on the port. It
+// only sees this host, so it is a best-effort check for automatic picks.
+func hostFree(ip string, port int, proto string) bool {
+	addr := net.JoinHostPort(ip, strconv.Itoa(port))
+	if proto == "udp" {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return false
+	}
+	ln.Close()
+	return true
+}
+
+// Allocate resolves the host ports of an application's mappings. Explicit
+// ports are checked against other applications and running containers; zero
+// ports get the first free port in the configured range. When ports were
+// picked and save is true, the mappings are stored on the application so
+// later deploys keep the same ports.
+func Allocate(ctx context.Context, cli *client.Client, db *sql.DB, appID int64, mappings []models.PortMapping, save bool) ([]models.PortMapping, error) {
+	mappings, err := Normalize(mappings)
+	if err != nil {
+		return nil, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	used, err := InUse(ctx, cli, db, appID)
+	if err != nil {
+		return nil, err
+	}
+	taken := func(ip string, port int, proto string) (string, bool) {
+		for _, u := range used {
+			if overlaps(u.HostIP, u.HostPort, u.Protocol, ip, port, proto) {
+				return u.Owner, true
+			}
+		}
+		return "", false
+	}
+
+	for _, m := range mappings {
+		if m.HostPort == 0 {
+			continue
+		}
+		if owner, ok := taken(m.HostIP, m.HostPort, m.Protocol); ok {
+			return nil, &ConflictError{Mapping: m, Owner: owner}
+		}
+		used = append(used, Usage{HostIP: m.HostIP, HostPort: m.HostPort, Protocol: m.Protocol})
+	}
+
+	r := ConfiguredRange()
+	picked := false
+	for i, m := range mappings {
+		if m.HostPort != 0 {
+			continue
+		}
+		for port := r.Start; port <= r.End; port++ {
+			if _, ok := taken(m.HostIP, port, m.Protocol); ok {
+				continue
+			}
+			if !hostFree(m.HostIP, port, m.Protocol) {
+				continue
+			}
+			mappings[i].HostPort = port
+			break
+		}
+		if mappings[i].HostPort == 0 {
+			return nil, ErrRangeExhausted
+		}
+		used = append(used, Usage{HostIP: m.HostIP, HostPort: mappings[i].HostPort, Protocol: m.Protocol})
+		picked = true
+	}
+
+	if picked && save {
+		data, _ := json.Marshal(mappings)
+		if _, err := db.Exec("UPDATE applications SET ports = ? WHERE id = ?", string(data), appID); err != nil {
+			return nil, err
+		}
+	}
+	return mappings, nil
+}
@@ -0,0 +1,97 @@
+package ports
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gakwaya-panel/api/internal/models"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []models.PortMapping
+		want []models.PortMapping
+	}{
+		{"empty", nil, []models.PortMapping{}},
+		{
+			"default protocol",
+			[]models.PortMapping{{HostPort: 8080, ContainerPort: 80}},
+			[]models.PortMapping{{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}},
+		},
+		{
+			"protocol case and wildcard IP",
+			[]models.PortMapping{{HostIP: " 0.0.0.0 ", HostPort: 53, ContainerPort: 53, Protocol: " UDP "}},
+			[]models.PortMapping{{HostPort: 53, ContainerPort: 53, Protocol: "udp"}},
+		},
+		{
+			"same port on tcp and udp",
+			[]models.PortMapping{{HostPort: 53, Protocol: "tcp"}, {HostPort: 53, Protocol: "udp"}},
+			[]models.PortMapping{{HostPort: 53, Protocol: "tcp"}, {HostPort: 53, Protocol: "udp"}},
+		},
+		{
+			"same port on two addresses",
+			[]models.PortMapping{{HostIP: "127.0.0.1", HostPort: 80}, {HostIP: "::1", HostPort: 80}},
+			[]models.PortMapping{{HostIP: "127.0.0.1", HostPort: 80, Protocol: "tcp"}, {HostIP: "::1", HostPort: 80, Protocol: "tcp"}},
+		},
+		{
+			"several automatic ports",
+			[]models.PortMapping{{ContainerPort: 80}, {ContainerPort: 443}},
+			[]models.PortMapping{{ContainerPort: 80, Protocol: "tcp"}, {ContainerPort: 443, Protocol: "tcp"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.in)
+			if err != nil {
+				t.Fatalf("Normalize: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Normalize = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []models.PortMapping
+	}{
+		{"protocol", []models.PortMapping{{HostPort: 80, Protocol: "sctp"}}},
+		{"host IP", []models.PortMapping{{HostIP: "localhost", HostPort: 80}}},
+		{"host port too large", []models.PortMapping{{HostPort: 65536}}},
+		{"negative host port", []models.PortMapping{{HostPort: -1}}},
+		{"container port too large", []models.PortMapping{{ContainerPort: 70000}}},
+		{"duplicate", []models.PortMapping{{HostPort: 80}, {HostPort: 80, ContainerPort: 8080}}},
+		{"wildcard overlaps address", []models.PortMapping{{HostPort: 80}, {HostIP: "127.0.0.1", HostPort: 80}}},
+	}
+	for _, tt := range tests {
+		if _, err := Normalize(tt.in); err == nil {
+			t.Errorf("%s: Normalize(%+v) succeeded, want an error", tt.name, tt.in)
+		}
+	}
+}
+
+func TestConfiguredRange(t *testing.T) {
+	def := Range{Start: 20000, End: 29999}
+	tests := []struct {
+		env  string
+		want Range
+	}{
+		{"", def},
+		{"30000-30100", Range{Start: 30000, End: 30100}},
+		{" 40000 - 40010 ", Range{Start: 40000, End: 40010}},
+		{"30000", def},
+		{"a-b", def},
+		{"0-100", def},
+		{"100-70000", def},
+		{"200-100", def},
+	}
+	for _, tt := range tests {
+		t.Setenv("PORT_RANGE", tt.env)
+		if got := ConfiguredRange(); got != tt.want {
+			t.Errorf("PORT_RANGE=%q: ConfiguredRange() = %+v, want %+v", tt.env, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package prom
+
+// JobBuckets suit deploy and build durations in seconds
+var JobBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200, 1800, 3600}
+
+// Panel-internal metrics
+var (
+	HTTPRequestDuration = NewHistogramVec("gakwayapanel_http_request_duration_seconds",
+		"Latency of API requests by method, route and status code.", DefaultBuckets, "method", "route", "status")
+	JobsFinished = NewCounterVec("gakwayapanel_jobs_total",
+		"Finished jobs (deploys, builds, backups, restores) by kind and status.", "kind", "status")
+	JobDuration = NewHistogramVec("gakwayapanel_job_duration_seconds",
+		"Run time of finished jobs by kind and status, excluding time queued.", JobBuckets, "kind", "status")
+	DockerRequests = NewCounterVec("gakwayapanel_docker_api_requests_total",
+		"Requests to the Docker API by resource.", "resource")
+	DockerErrors = NewCounterVec("gakwayapanel_docker_api_errors_total",
+		"Docker API requests that failed, by resource and status code (\"error\" when no response).", "resource", "code")
+)
@@ -0,0 +1,245 @@
+// Package prom keeps panel-internal counters, histograms and gauges and
+// writes them in the Prometheus text exposition format.
+package prom
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Label is one label pair of a sample
+type Label struct {
+	Name, Value string
+}
+
+// Sample is one value of a metric family
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// collector is a registered metric family
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []collector
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, c)
+}
+
+// WriteText writes every registered metric, sorted by name
+func WriteText(w io.Writer) {
+	registryMu.Lock()
+	list := append([]collector(nil), registry...)
+	registryMu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].name() < list[j].name() })
+	for _, c := range list {
+		c.write(w)
+	}
+}
+
+// WriteFamily writes one metric family of the given type ("gauge",
+// "counter") from samples collected elsewhere
+func WriteFamily(w io.Writer, name, help, typ string, samples []Sample) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, typ)
+	for _, s := range samples {
+		fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(s.Labels), formatValue(s.Value))
+	}
+}
+
+// series is the state of one label combination
+type series struct {
+	labels  []string
+	value   float64  // counters
+	buckets []uint64 // histograms: cumulative counts per upper bound
+	sum     float64  // histograms
+	count   uint64   // histograms
+}
+
+type vec struct {
+	metric string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func (v *vec) name() string { return v.metric }
+
+// get returns the series for label values, creating it; mu must be held
+func (v *vec) get(values []string, buckets int) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("prom: %s takes %d label values, got %d", v.metric, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...), buckets: make([]uint64, buckets)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series ordered by label values; mu must be held
+func (v *vec) sorted() []*series {
+	out := make([]*series, 0, len(v.series))
+	for _, s := range v.series {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return strings.Join(out[i].labels, "\xff") < strings.Join(out[j].labels, "\xff")
+	})
+	return out
+}
+
+func (v *vec) pairs(s *series, extra ...Label) []Label {
+	out := make([]Label, 0, len(v.labels)+len(extra))
+	for i, name := range v.labels {
+		out = append(out, Label{name, s.labels[i]})
+	}
+	return append(out, extra...)
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct{ vec }
+
+// NewCounterVec registers a counter
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec{metric: name, help: help, labels: labels, series: map[string]*series{}}}
+	register(c)
+	return c
+}
+
+// Inc adds one to the series with the given label values
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds delta to the series with the given label values
+func (c *CounterVec) Add(delta float64, values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(values, 0).value += delta
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var samples []Sample
+	for _, s := range c.sorted() {
+		samples = append(samples, Sample{c.pairs(s), s.value})
+	}
+	WriteFamily(w, c.metric, c.help, "counter", samples)
+}
+
+// DefaultBuckets suit request latencies in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	vec
+	bounds []float64
+}
+
+// NewHistogramVec registers a histogram with the given bucket upper bounds
+func NewHistogramVec(name, help string, bounds []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{vec{metric: name, help: help, labels: labels, series: map[string]*series{}}, bounds}
+	register(h)
+	return h
+}
+
+// Observe records one value in the series with the given label values
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.get(values, len(h.bounds))
+	for i, bound := range h.bounds {
+		if value <= bound {
+			s.buckets[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.metric, escapeHelp(h.help), h.metric)
+	for _, s := range h.sorted() {
+		for i, bound := range h.bounds {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metric, formatLabels(h.pairs(s, Label{"le", formatValue(bound)})), s.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metric, formatLabels(h.pairs(s, Label{"le", "+Inf"})), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metric, formatLabels(h.pairs(s)), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metric, formatLabels(h.pairs(s)), s.count)
+	}
+}
+
+// GaugeFunc is a gauge read when metrics are written
+type GaugeFunc struct {
+	metric string
+	help   string
+	fn     func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value comes from fn
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{name, help, fn}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) name() string { return g.metric }
+
+func (g *GaugeFunc) write(w io.Writer) {
+	WriteFamily(w, g.metric, g.help, "gauge", []Sample{{Value: g.fn()}})
+}
+
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.Name)
+		b.WriteString(`="`)
+		b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(l.Value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,324 @@
+package proxy
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/gakwaya-panel/api/internal/dockerutil"
+	"github.com/gakwaya-panel/api/internal/models"
+)
+
+// Route maps a host (and optional path prefix) to an application container
+type Route struct {
+	Host          string `json:"host"`
+	PathPrefix    string `json:"path_prefix"`
+	ApplicationID int64  `json:"application_id"`
+	Application   string `json:"application"`
+	Target        string `json:"target"`
+
+	proxy *httputil.ReverseProxy
+}
+
+// Router is an http.Handler that forwards requests by Host header
+type Router struct {
+	mu     sync.RWMutex
+	routes map[string][]*Route // host -> routes, longest prefix first
+}
+
+// Default is the router served by the panel's proxy listeners
+var Default = &Router{routes: map[string][]*Route{}}
+
+// ParseDomain splits "example.com/api" into host and path prefix
+func ParseDomain(entry string) (host, prefix string) {
+	entry = strings.TrimSpace(entry)
+	entry = strings.TrimPrefix(strings.TrimPrefix(entry, "https://"), "http://")
+	host, prefix = entry, "/"
+	if i := strings.Index(entry, "/"); i >= 0 {
+		host, prefix = entry[:i], entry[i:]
+	}
+	if len(prefix) > 1 {
+		prefix = strings.TrimSuffix(prefix, "/")
+	}
+	return strings.ToLower(host), prefix
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route := rt.match(r.Host, r.URL.Path)
+	if route == nil {
+		http.Error(w, "no application is configured for this host", http.StatusNotFound)
+		return
+	}
+	route.proxy.ServeHTTP(w, r)
+}
+
+// match returns the route for host and path, or nil
+func (rt *Router) match(hostport, path string) *Route {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	for _, route := range rt.routes[host] {
+		if route.PathPrefix == "/" || path == route.PathPrefix || strings.HasPrefix(path, route.PathPrefix+"/") {
+			return route
+		}
+	}
+	return nil
+}
+
+// Routes returns a copy of the current routing table
+func (rt *Router) Routes() []Route {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	out := []Route{}
+	for _, routes := range rt.routes {
+		for _, r := range routes {
+			out = append(out, Route{Host: r.Host, PathPrefix: r.PathPrefix, ApplicationID: r.ApplicationID, Application: r.Application, Target: r.Target})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Host != out[j].Host {
+			return out[i].Host < out[j].Host
+		}
+		return out[i].PathPrefix < out[j].PathPrefix
+	})
+	return out
+}
+
+// Hosts returns every host that currently has a route
+func (rt *Router) Hosts() []string {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	hosts := make([]string, 0, len(rt.routes))
+	for h := range rt.routes {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// HasHost reports whether host has a route
+func (rt *Router) HasHost(host string) bool {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	_, ok := rt.routes[strings.ToLower(host)]
+	return ok
+}
+
+// Reload rebuilds the routing table from the applications table and the
+// containers' addresses on the panel network
+func (rt *Router) Reload(ctx context.Context, db *sql.DB) error {
+	rows, err := db.Query("SELECT id, name, domain, domains, ports, container_port, container_id FROM applications WHERE container_id IS NOT NULL AND container_id != ''")
+	if err != nil {
+		return err
+	}
+	type appRow struct {
+		id            int64
+		name          string
+		domains       []string
+		containerPort int
+		containerID   string
+	}
+	var apps []appRow
+	for rows.Next() {
+		var a appRow
+		var domain, domains, ports sql.NullString
+		var containerPort sql.NullInt64
+		if err := rows.Scan(&a.id, &a.name, &domain, &domains, &ports, &containerPort, &a.containerID); err != nil {
+			rows.Close()
+			return err
+		}
+		if domain.String != "" {
+			a.domains = append(a.domains, domain.String)
+		}
+		var extra []string
+		_ = json.Unmarshal([]byte(domains.String), &extra)
+		a.domains = append(a.domains, extra...)
+		var mappings []models.PortMapping
+		_ = json.Unmarshal([]byte(ports.String), &mappings)
+		a.containerPort = upstreamPort(mappings, int(containerPort.Int64))
+		if len(a.domains) > 0 {
+			apps = append(apps, a)
+		}
+	}
+	rows.Close()
+
+	cli, err := dockerutil.NewClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	network := dockerutil.PanelNetwork()
+	table := map[string][]*Route{}
+	for _, a := range apps {
+		target, err := containerTarget(ctx, cli, a.containerID, network, a.containerPort)
+		if err != nil {
+			continue
+		}
+		for _, d := range a.domains {
+			host, prefix := ParseDomain(d)
+			if host == "" {
+				continue
+			}
+			route := &Route{Host: host, PathPrefix: prefix, ApplicationID: a.id, Application: a.name, Target: target.String()}
+			route.proxy = newReverseProxy(target)
+			table[host] = append(table[host], route)
+		}
+	}
+	for _, routes := range table {
+		sort.Slice(routes, func(i, j int) bool { return len(routes[i].PathPrefix) > len(routes[j].PathPrefix) })
+	}
+
+	rt.mu.Lock()
+	rt.routes = table
+	rt.mu.Unlock()
+	return nil
+}
+
+// upstreamPort picks the container port requests go to: the first TCP port
+// of the application's ports list, which replaces container_port when set.
+// 0 leaves the choice to the ports the image exposes.
+func upstreamPort(ports []models.PortMapping, containerPort int) int {
+	for _, m := range ports {
+		if m.Protocol == "" || m.Protocol == "tcp" {
+			return m.ContainerPort
+		}
+	}
+	return containerPort
+}
+
+// containerTarget returns the URL of a running container on the panel network
+func containerTarget(ctx context.Context, cli *client.Client, containerID, network string, port int) (*url.URL, error) {
+	info, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	if info.State == nil || !info.State.Running {
+		return nil, fmt.Errorf("container %s is not running", containerID)
+	}
+	ep, ok := info.NetworkSettings.Networks[network]
+	if !ok || ep.IPAddress == "" {
+		return nil, fmt.Errorf("container %s is not attached to %s", containerID, network)
+	}
+	if port == 0 {
+		// Fall back to the lowest TCP port the image exposes, then 80
+		port = 80
+		lowest := 0
+		for p := range info.Config.ExposedPorts {
+			if p.Proto() == "tcp" && (lowest == 0 || p.Int() < lowest) {
+				lowest = p.Int()
+			}
+		}
+		if lowest > 0 {
+			port = lowest
+		}
+	}
+	return &url.URL{Scheme: "http", Host: net.JoinHostPort(ep.IPAddress, strconv.Itoa(port))}, nil
+}
+
+func newReverseProxy(target *url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.SetXForwarded()
+			r.Out.Host = r.In.Host
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("[WARN] proxy: %s%s -> %s: %v", r.Host, r.URL.Path, target, err)
+			http.Error(w, "application is unavailable", http.StatusBadGateway)
+		},
+	}
+}
+
+// reload rebuilds the default router and requests certificates for new hosts
+func reload(ctx context.Context, db *sql.DB) error {
+	if err := Default.Reload(ctx, db); err != nil {
+		return err
+	}
+	if certs != nil {
+		certs.issueMissing()
+	}
+	return nil
+}
+
+// Refresh reloads the default router in the background
+func Refresh(db *sql.DB) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := reload(ctx, db); err != nil {
+			log.Printf("[WARN] proxy: reload failed: %v", err)
+		}
+	}()
+}
+
+// Start loads the routing table, keeps it in sync every 30 seconds and
+// serves plain HTTP on httpAddr and HTTPS on httpsAddr (each skipped when
+// empty). With HTTPS enabled, certificates are issued through ACME: HTTP-01
+// challenges are answered on httpAddr and TLS-ALPN-01 on httpsAddr.
+func Start(db *sql.DB, httpAddr, httpsAddr string) {
+	ctx := context.Background()
+	cli, err := dockerutil.NewClient()
+	if err == nil {
+		if err := dockerutil.EnsureNetwork(ctx, cli, dockerutil.PanelNetwork(), nil); err != nil {
+			log.Printf("[WARN] proxy: could not create network %s: %v", dockerutil.PanelNetwork(), err)
+		}
+		cli.Close()
+	}
+	if httpsAddr != "" {
+		cm, err := newCertManager()
+		if err != nil {
+			log.Printf("[WARN] proxy: TLS disabled: %v", err)
+		} else {
+			certs = cm
+		}
+	}
+	if err := reload(ctx, db); err != nil {
+		log.Printf("[WARN] proxy: initial load failed: %v", err)
+	}
+	go func() {
+		for range time.Tick(30 * time.Second) {
+			if err := reload(ctx, db); err != nil {
+				log.Printf("[WARN] proxy: reload failed: %v", err)
+			}
+		}
+	}()
+
+	if httpAddr != "" {
+		var handler http.Handler = Default
+		if certs != nil {
+			handler = certs.m.HTTPHandler(Default)
+		}
+		go func() {
+			log.Printf("[INFO] proxy: serving HTTP on %s", httpAddr)
+			if err := http.ListenAndServe(httpAddr, handler); err != nil {
+				log.Printf("[WARN] proxy: HTTP listener stopped: %v", err)
+			}
+		}()
+	}
+	if certs != nil {
+		srv := &http.Server{Addr: httpsAddr, Handler: Default, TLSConfig: certs.m.TLSConfig()}
+		go func() {
+			log.Printf("[INFO] proxy: serving HTTPS on %s", httpsAddr)
+			if err := srv.ListenAndServeTLS("", ""); err != nil {
+				log.Printf("[WARN] proxy: HTTPS listener stopped: %v", err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gakwaya-panel/api/internal/models"
+)
+
+func TestParseDomain(t *testing.T) {
+	tests := []struct {
+		entry, host, prefix string
+	}{
+		{"example.com", "example.com", "/"},
+		{" Example.COM ", "example.com", "/"},
+		{"example.com/", "example.com", "/"},
+		{"example.com/api", "example.com", "/api"},
+		{"example.com/api/", "example.com", "/api"},
+		{"https://example.com/api/v1", "example.com", "/api/v1"},
+		{"http://example.com", "example.com", "/"},
+		{"", "", "/"},
+	}
+	for _, tt := range tests {
+		if host, prefix := ParseDomain(tt.entry); host != tt.host || prefix != tt.prefix {
+			t.Errorf("ParseDomain(%q) = %q, %q, want %q, %q", tt.entry, host, prefix, tt.host, tt.prefix)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	// Longest prefix first, as Reload sorts them
+	rt := &Router{routes: map[string][]*Route{
+		"example.com": {
+			{Host: "example.com", PathPrefix: "/api/v2", ApplicationID: 3},
+			{Host: "example.com", PathPrefix: "/api", ApplicationID: 2},
+			{Host: "example.com", PathPrefix: "/", ApplicationID: 1},
+		},
+		"api.example.com": {
+			{Host: "api.example.com", PathPrefix: "/v1", ApplicationID: 4},
+		},
+	}}
+	tests := []struct {
+		host, path string
+		want       int64 // 0 for no route
+	}{
+		{"example.com", "/", 1},
+		{"example.com", "/about", 1},
+		{"example.com", "/api", 2},
+		{"example.com", "/api/users", 2},
+		{"example.com", "/apis", 1},
+		{"example.com", "/api/v2/users", 3},
+		{"example.com", "/api/v20", 2},
+		{"EXAMPLE.com:8080", "/api", 2},
+		{"api.example.com", "/v1/x", 4},
+		{"api.example.com", "/v2", 0},
+		{"other.com", "/", 0},
+	}
+	for _, tt := range tests {
+		var got int64
+		if route := rt.match(tt.host, tt.path); route != nil {
+			got = route.ApplicationID
+		}
+		if got != tt.want {
+			t.Errorf("match(%q, %q) = application %d, want %d", tt.host, tt.path, got, tt.want)
+		}
+	}
+	if !rt.HasHost("API.example.com") || rt.HasHost("other.com") {
+		t.Error("HasHost does not follow the routing table")
+	}
+}
+
+func TestServeUnknownHost(t *testing.T) {
+	rt := &Router{routes: map[string][]*Route{}}
+	rec := httptest.NewRecorder()
+	rt.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://unknown.example/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestUpstreamPort(t *testing.T) {
+	tests := []struct {
+		name          string
+		ports         []models.PortMapping
+		containerPort int
+		want          int
+	}{
+		{"container_port", nil, 3000, 3000},
+		{"unset", nil, 0, 0},
+		{"first tcp mapping", []models.PortMapping{{ContainerPort: 8080, Protocol: "tcp"}, {ContainerPort: 9090, Protocol: "tcp"}}, 3000, 8080},
+		{"udp skipped", []models.PortMapping{{ContainerPort: 53, Protocol: "udp"}, {ContainerPort: 8080}}, 3000, 8080},
+		{"only udp", []models.PortMapping{{ContainerPort: 53, Protocol: "udp"}}, 3000, 3000},
+	}
+	for _, tt := range tests {
+		if got := upstreamPort(tt.ports, tt.containerPort); got != tt.want {
+			t.Errorf("%s: upstreamPort = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Certificate is the TLS state of one routed host
+type Certificate struct {
+	Host      string     `json:"host"`
+	Issuer    string     `json:"issuer,omitempty"`
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	NotAfter  *time.Time `json:"not_after,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// certManager issues and renews certificates for routed hosts
+type certManager struct {
+	m *autocert.Manager
+
+	mu       sync.Mutex
+	attempts map[string]time.Time // host -> last proactive issuance attempt
+	errors   map[string]string    // host -> last issuance error
+}
+
+// certs is nil until the HTTPS listener is enabled
+var certs *certManager
+
+// retryAfter is how long a failed proactive issuance waits before retrying
+const retryAfter = time.Hour
+
+// stagingDirectory is Let's Encrypt staging, used unless ACME_DIRECTORY_URL
+// is set. Its certificates are not trusted by browsers, but a panel that was
+// not meant to issue cannot use up production rate limits.
+const stagingDirectory = "https://acme-staging-v02.api.letsencrypt.org/directory"
+
+// certDir returns ACME_CERT_DIR, defaulting to "certs"
+func certDir() string {
+	if dir := os.Getenv("ACME_CERT_DIR"); dir != "" {
+		return dir
+	}
+	return "certs"
+}
+
+// newCertManager builds an autocert manager from the ACME_* settings. Only
+// hosts with a route are allowed, so unknown SNI names never hit the CA.
+func newCertManager() (*certManager, error) {
+	client := &acme.Client{DirectoryURL: stagingDirectory}
+	if dir := os.Getenv("ACME_DIRECTORY_URL"); dir != "" {
+		client.DirectoryURL = dir
+	}
+	log.Printf("[INFO] proxy: requesting certificates from %s", client.DirectoryURL)
+	// A private CA (e.g. Pebble) serves its directory with its own certificate
+	if caFile := os.Getenv("ACME_CA_CERT"); caFile != "" {
+		pemData, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ACME_CA_CERT: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pemData) {
+			return nil, errors.New("ACME_CA_CERT contains no certificates")
+		}
+		client.HTTPClient = &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}}
+	}
+	if err := os.MkdirAll(certDir(), 0o700); err != nil {
+		return nil, err
+	}
+	return &certManager{
+		m: &autocert.Manager{
+			Prompt: autocert.AcceptTOS,
+			Cache:  autocert.DirCache(certDir()),
+			Email:  os.Getenv("ACME_EMAIL"),
+			Client: client,
+			HostPolicy: func(_ context.Context, host string) error {
+				if !Default.HasHost(host) {
+					return fmt.Errorf("no application is configured for %s", host)
+				}
+				return nil
+			},
+		},
+		attempts: map[string]time.Time{},
+		errors:   map[string]string{},
+	}, nil
+}
+
+// issueMissing requests certificates for routed hosts in the background.
+// autocert renews each certificate it has loaded 30 days before expiry.
+func (cm *certManager) issueMissing() {
+	for _, host := range Default.Hosts() {
+		cm.mu.Lock()
+		last, tried := cm.attempts[host]
+		failed := cm.errors[host] != ""
+		if tried && (!failed || time.Since(last) < retryAfter) {
+			cm.mu.Unlock()
+			continue
+		}
+		cm.attempts[host] = time.Now()
+		cm.mu.Unlock()
+
+		go cm.obtain(host)
+	}
+}
+
+// obtain loads or issues the certificate for host, the same way a TLS
+// handshake for that name would
+func (cm *certManager) obtain(host string) {
+	hello := &tls.ClientHelloInfo{
+		ServerName:   host,
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+	}
+	_, err := cm.m.GetCertificate(hello)
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if err != nil {
+		log.Printf("[WARN] proxy: certificate for %s: %v", host, err)
+		cm.errors[host] = err.Error()
+		return
+	}
+	delete(cm.errors, host)
+}
+
+// status reads the cached certificate for host
+func (cm *certManager) status(ctx context.Context, host string) Certificate {
+	out := Certificate{Host: host}
+	cm.mu.Lock()
+	out.Error = cm.errors[host]
+	cm.mu.Unlock()
+
+	data, err := cm.m.Cache.Get(ctx, host)
+	if err != nil {
+		return out
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		leaf, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			break
+		}
+		out.Issuer = leaf.Issuer.CommonName
+		out.NotBefore = &leaf.NotBefore
+		out.NotAfter = &leaf.NotAfter
+		break
+	}
+	return out
+}
+
+// Certificates returns the certificate state of every routed host, or nil
+// when TLS is disabled
+func Certificates(ctx context.Context) []Certificate {
+	if certs == nil {
+		return nil
+	}
+	hosts := Default.Hosts()
+	out := make([]Certificate, 0, len(hosts))
+	for _, host := range hosts {
+		out = append(out, certs.status(ctx, host))
+	}
+	return out
+}
+
+// TLSEnabled reports whether the HTTPS listener is running
+func TLSEnabled() bool {
+	return certs != nil
+}
@@ -0,0 +1,242 @@
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/gakwaya-panel/api/internal/dockerutil"
+)
+
+// DefaultKeep is the number of built images kept per application when
+// neither the application nor IMAGE_RETENTION_DEFAULT says otherwise
+const DefaultKeep = 5
+
+// rollbackDepth is how many previous successful deployments stay protected
+const rollbackDepth = 1
+
+// Report describes the outcome of a retention pass for one application.
+// ReclaimedBytes is the drop in image layer disk usage across the removals.
+type Report struct {
+	ApplicationID  int64    `json:"application_id"`
+	Kept           []string `json:"kept"`
+	Removed        []string `json:"removed"`
+	Skipped        []string `json:"skipped,omitempty"`
+	ReclaimedBytes int64    `json:"reclaimed_bytes"`
+}
+
+// ImageRepository returns the repository name used for images built for an application
+func ImageRepository(appID int64) string {
+	return fmt.Sprintf("gakwayapanel-app-%d", appID)
+}
+
+// defaultKeep reads IMAGE_RETENTION_DEFAULT, falling back to DefaultKeep
+func defaultKeep() int {
+	if v, err := strconv.Atoi(os.Getenv("IMAGE_RETENTION_DEFAULT")); err == nil && v > 0 {
+		return v
+	}
+	return DefaultKeep
+}
+
+// Enforce removes old build images of an application, keeping the newest N
+// plus the currently deployed image and the rollback targets
+func Enforce(ctx context.Context, cli *client.Client, db *sql.DB, appID int64) (Report, error) {
+	report := Report{ApplicationID: appID, Kept: []string{}, Removed: []string{}}
+
+	var currentImage string
+	var keep int
+	err := db.QueryRow("SELECT image, image_retention FROM applications WHERE id = ?", appID).Scan(&currentImage, &keep)
+	if err != nil {
+		return report, err
+	}
+	if keep <= 0 {
+		keep = defaultKeep()
+	}
+
+	protected := map[string]bool{currentImage: true}
+	rows, err := db.Query(
+		"SELECT image FROM deployments WHERE application_id = ? AND status = 'succeeded' ORDER BY id DESC LIMIT ?",
+		appID, rollbackDepth+1,
+	)
+	if err != nil {
+		return report, err
+	}
+	for rows.Next() {
+		var image string
+		if err := rows.Scan(&image); err != nil {
+			rows.Close()
+			return report, err
+		}
+		protected[image] = true
+	}
+	rows.Close()
+
+	repo := ImageRepository(appID)
+	f := filters.NewArgs()
+	f.Add("reference", repo)
+	images, err := cli.ImageList(ctx, types.ImageListOptions{Filters: f})
+	if err != nil {
+		return report, err
+	}
+	kept, remove := selectImages(images, repo, keep, protected)
+	report.Kept = append(report.Kept, kept...)
+	if len(remove) == 0 {
+		return report, nil
+	}
+
+	// Layers shared with kept images (e.g. the base image) stay on disk, so
+	// measure the space actually freed instead of adding up image sizes
+	before, sizeErr := layersSize(ctx, cli)
+	for _, tags := range remove {
+		for _, tag := range tags {
+			if _, err := cli.ImageRemove(ctx, tag, types.ImageRemoveOptions{PruneChildren: true}); err != nil {
+				// Most likely still used by a (stopped) container
+				log.Printf("[WARN] retention: could not remove %s: %v", tag, err)
+				report.Skipped = append(report.Skipped, tag)
+				continue
+			}
+			report.Removed = append(report.Removed, tag)
+		}
+	}
+	if len(report.Removed) > 0 {
+		after, err := layersSize(ctx, cli)
+		if sizeErr == nil {
+			sizeErr = err
+		}
+		if sizeErr != nil {
+			log.Printf("[WARN] retention: could not measure reclaimed space: %v", sizeErr)
+		} else if after < before {
+			report.ReclaimedBytes = before - after
+		}
+	}
+	return report, nil
+}
+
+// selectImages splits the build images of repo into the tags to keep and the
+// tag sets of images to remove. The newest keep tagged images stay, as do
+// protected ones; untagged images are left to docker image prune.
+func selectImages(images []types.ImageSummary, repo string, keep int, protected map[string]bool) ([]string, [][]string) {
+	images = append([]types.ImageSummary(nil), images...)
+	sort.Slice(images, func(i, j int) bool { return images[i].Created > images[j].Created })
+	kept := []string{}
+	var remove [][]string
+	tagged := 0
+	for _, img := range images {
+		tags := repoTags(img.RepoTags, repo)
+		if len(tags) == 0 {
+			continue
+		}
+		newest := tagged < keep
+		tagged++
+		if newest || anyProtected(tags, protected) || protected[img.ID] {
+			kept = append(kept, tags...)
+			continue
+		}
+		remove = append(remove, tags)
+	}
+	return kept, remove
+}
+
+// layersSize returns the disk space taken by image layers
+func layersSize(ctx context.Context, cli *client.Client) (int64, error) {
+	du, err := cli.DiskUsage(ctx, types.DiskUsageOptions{Types: []types.DiskUsageObject{types.ImageObject}})
+	if err != nil {
+		return 0, err
+	}
+	return du.LayersSize, nil
+}
+
+// repoTags returns the tags of an image that belong to the given repository
+func repoTags(tags []string, repo string) []string {
+	var out []string
+	for _, t := range tags {
+		if strings.HasPrefix(t, repo+":") {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func anyProtected(tags []string, protected map[string]bool) bool {
+	for _, t := range tags {
+		if protected[t] {
+			return true
+		}
+	}
+	return false
+}
+
+// Sweep enforces retention for every application
+func Sweep(ctx context.Context, db *sql.DB) ([]Report, error) {
+	rows, err := db.Query("SELECT id FROM applications ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	cli, err := dockerutil.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	reports := []Report{}
+	for _, id := range ids {
+		report, err := Enforce(ctx, cli, db, id)
+		if err != nil {
+			log.Printf("[WARN] retention: application %d: %v", id, err)
+			continue
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// StartNightlySweep runs Sweep once a day at IMAGE_RETENTION_SWEEP_HOUR (local time, default 3)
+func StartNightlySweep(db *sql.DB) {
+	hour := 3
+	if v, err := strconv.Atoi(os.Getenv("IMAGE_RETENTION_SWEEP_HOUR")); err == nil && v >= 0 && v < 24 {
+		hour = v
+	}
+	go func() {
+		for {
+			now := time.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+			if !next.After(now) {
+				next = next.Add(24 * time.Hour)
+			}
+			time.Sleep(time.Until(next))
+
+			reports, err := Sweep(context.Background(), db)
+			if err != nil {
+				log.Printf("[WARN] retention: nightly sweep failed: %v", err)
+				continue
+			}
+			var removed int
+			var reclaimed int64
+			for _, r := range reports {
+				removed += len(r.Removed)
+				reclaimed += r.ReclaimedBytes
+			}
+			log.Printf("[INFO] retention: nightly sweep removed %d images, reclaimed %d bytes", removed, reclaimed)
+		}
+	}()
+}
@@ -0,0 +1,56 @@
+package retention
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestSelectImages(t *testing.T) {
+	repo := ImageRepository(7)
+	img := func(id string, created int64, tags ...string) types.ImageSummary {
+		return types.ImageSummary{ID: id, Created: created, RepoTags: tags}
+	}
+	images := []types.ImageSummary{
+		img("sha256:a", 100, repo+":100"),
+		img("sha256:e", 500, repo+":500", "registry.local/app:prod"),
+		img("sha256:c", 300, repo+":300"),
+		img("sha256:d", 400),
+		img("sha256:b", 200, repo+":200"),
+	}
+	tests := []struct {
+		name      string
+		keep      int
+		protected map[string]bool
+		kept      []string
+		remove    [][]string
+	}{
+		{"keep newest", 2, nil, []string{repo + ":500", repo + ":300"}, [][]string{{repo + ":200"}, {repo + ":100"}}},
+		{"untagged images do not count", 3, nil, []string{repo + ":500", repo + ":300", repo + ":200"}, [][]string{{repo + ":100"}}},
+		{"keep all", 10, nil, []string{repo + ":500", repo + ":300", repo + ":200", repo + ":100"}, nil},
+		{"protected tag", 1, map[string]bool{repo + ":100": true}, []string{repo + ":500", repo + ":100"}, [][]string{{repo + ":300"}, {repo + ":200"}}},
+		{"protected image ID", 1, map[string]bool{"sha256:b": true}, []string{repo + ":500", repo + ":200"}, [][]string{{repo + ":300"}, {repo + ":100"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, remove := selectImages(images, repo, tt.keep, tt.protected)
+			if !reflect.DeepEqual(kept, tt.kept) {
+				t.Errorf("kept = %q, want %q", kept, tt.kept)
+			}
+			if !reflect.DeepEqual(remove, tt.remove) {
+				t.Errorf("remove = %q, want %q", remove, tt.remove)
+			}
+		})
+	}
+	if images[0].ID != "sha256:a" {
+		t.Error("selectImages reordered the caller's slice")
+	}
+}
+
+func TestRepoTags(t *testing.T) {
+	got := repoTags([]string{"gakwayapanel-app-1:1", "gakwayapanel-app-10:2", "other:1", "gakwayapanel-app-1:3"}, ImageRepository(1))
+	if want := []string{"gakwayapanel-app-1:1", "gakwayapanel-app-1:3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("repoTags = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,239 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Severity levels in ascending order
+const (
+	SeverityUnknown  = "UNKNOWN"
+	SeverityLow      = "LOW"
+	SeverityMedium   = "MEDIUM"
+	SeverityHigh     = "HIGH"
+	SeverityCritical = "CRITICAL"
+)
+
+var severityRank = map[string]int{
+	SeverityUnknown:  0,
+	SeverityLow:      1,
+	SeverityMedium:   2,
+	SeverityHigh:     3,
+	SeverityCritical: 4,
+}
+
+// Finding is a single vulnerability reported for an image
+type Finding struct {
+	ID               string `json:"id"`
+	Package          string `json:"package"`
+	InstalledVersion string `json:"installed_version"`
+	FixedVersion     string `json:"fixed_version,omitempty"`
+	Severity         string `json:"severity"`
+	Title            string `json:"title,omitempty"`
+}
+
+// Result is the outcome of scanning one image
+type Result struct {
+	ID        int64          `json:"id,omitempty"`
+	Scanner   string         `json:"scanner"`
+	Image     string         `json:"image"`
+	ImageID   string         `json:"image_id"`
+	Counts    map[string]int `json:"counts"`
+	Findings  []Finding      `json:"findings,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// Scanner scans a local image for known vulnerabilities
+type Scanner interface {
+	Name() string
+	Scan(ctx context.Context, image string) (*Result, error)
+}
+
+// FromEnv returns the scanner selected by IMAGE_SCANNER ("trivy" or "grype"),
+// or nil when scanning is disabled. IMAGE_SCANNER_PATH overrides the binary.
+func FromEnv() (Scanner, error) {
+	name := strings.ToLower(os.Getenv("IMAGE_SCANNER"))
+	path := os.Getenv("IMAGE_SCANNER_PATH")
+	switch name {
+	case "":
+		return nil, nil
+	case "trivy":
+		if path == "" {
+			path = "trivy"
+		}
+		return &Trivy{Path: path}, nil
+	case "grype":
+		if path == "" {
+			path = "grype"
+		}
+		return &Grype{Path: path}, nil
+	}
+	return nil, fmt.Errorf("unknown IMAGE_SCANNER %q", name)
+}
+
+// BlockThreshold returns the severity configured in IMAGE_SCAN_BLOCK_SEVERITY,
+// or "" when deploys are never blocked. CheckEnv rejects unknown values.
+func BlockThreshold() string {
+	s := strings.ToUpper(os.Getenv("IMAGE_SCAN_BLOCK_SEVERITY"))
+	if _, ok := severityRank[s]; !ok {
+		return ""
+	}
+	return s
+}
+
+// CheckEnv validates IMAGE_SCANNER and IMAGE_SCAN_BLOCK_SEVERITY, so that a
+// typo stops the panel at startup instead of failing every deploy or
+// silently never blocking one
+func CheckEnv() error {
+	if _, err := FromEnv(); err != nil {
+		return err
+	}
+	if s := os.Getenv("IMAGE_SCAN_BLOCK_SEVERITY"); s != "" && BlockThreshold() == "" {
+		return fmt.Errorf("unknown IMAGE_SCAN_BLOCK_SEVERITY %q (want CRITICAL, HIGH, MEDIUM, LOW or UNKNOWN)", s)
+	}
+	return nil
+}
+
+// Blocks reports whether the result contains findings at or above threshold
+func (r *Result) Blocks(threshold string) bool {
+	min, ok := severityRank[threshold]
+	if !ok {
+		return false
+	}
+	for sev, n := range r.Counts {
+		if severityRank[sev] >= min && n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// newResult builds a Result and fills in the severity counts
+func newResult(scanner, image string, findings []Finding) *Result {
+	counts := map[string]int{
+		SeverityCritical: 0,
+		SeverityHigh:     0,
+		SeverityMedium:   0,
+		SeverityLow:      0,
+		SeverityUnknown:  0,
+	}
+	for i, f := range findings {
+		sev := strings.ToUpper(f.Severity)
+		if sev == "NEGLIGIBLE" {
+			sev = SeverityLow
+		}
+		if _, ok := severityRank[sev]; !ok {
+			sev = SeverityUnknown
+		}
+		findings[i].Severity = sev
+		counts[sev]++
+	}
+	return &Result{Scanner: scanner, Image: image, Counts: counts, Findings: findings, CreatedAt: time.Now()}
+}
+
+// run executes a scanner binary and returns its stdout
+func run(ctx context.Context, env []string, path string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = append(os.Environ(), env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// Trivy runs `trivy image` against its local vulnerability DB only
+type Trivy struct {
+	Path string
+}
+
+func (t *Trivy) Name() string { return "trivy" }
+
+func (t *Trivy) Scan(ctx context.Context, image string) (*Result, error) {
+	out, err := run(ctx, nil, t.Path, "image", "--format", "json", "--quiet", "--skip-db-update", "--offline-scan", image)
+	if err != nil {
+		return nil, err
+	}
+	var report struct {
+		Results []struct {
+			Vulnerabilities []struct {
+				VulnerabilityID  string
+				PkgName          string
+				InstalledVersion string
+				FixedVersion     string
+				Severity         string
+				Title            string
+			}
+		}
+	}
+	if err := json.Unmarshal(out, &report); err != nil {
+		return nil, fmt.Errorf("parse trivy output: %w", err)
+	}
+	findings := []Finding{}
+	for _, res := range report.Results {
+		for _, v := range res.Vulnerabilities {
+			findings = append(findings, Finding{
+				ID:               v.VulnerabilityID,
+				Package:          v.PkgName,
+				InstalledVersion: v.InstalledVersion,
+				FixedVersion:     v.FixedVersion,
+				Severity:         v.Severity,
+				Title:            v.Title,
+			})
+		}
+	}
+	return newResult(t.Name(), image, findings), nil
+}
+
+// Grype runs `grype` with database auto-update disabled
+type Grype struct {
+	Path string
+}
+
+func (g *Grype) Name() string { return "grype" }
+
+func (g *Grype) Scan(ctx context.Context, image string) (*Result, error) {
+	out, err := run(ctx, []string{"GRYPE_DB_AUTO_UPDATE=false", "GRYPE_CHECK_FOR_APP_UPDATE=false"}, g.Path, image, "-o", "json", "-q")
+	if err != nil {
+		return nil, err
+	}
+	var report struct {
+		Matches []struct {
+			Vulnerability struct {
+				ID          string `json:"id"`
+				Severity    string `json:"severity"`
+				Description string `json:"description"`
+				Fix         struct {
+					Versions []string `json:"versions"`
+				} `json:"fix"`
+			} `json:"vulnerability"`
+			Artifact struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"artifact"`
+		} `json:"matches"`
+	}
+	if err := json.Unmarshal(out, &report); err != nil {
+		return nil, fmt.Errorf("parse grype output: %w", err)
+	}
+	findings := []Finding{}
+	for _, m := range report.Matches {
+		findings = append(findings, Finding{
+			ID:               m.Vulnerability.ID,
+			Package:          m.Artifact.Name,
+			InstalledVersion: m.Artifact.Version,
+			FixedVersion:     strings.Join(m.Vulnerability.Fix.Versions, ", "),
+			Severity:         m.Vulnerability.Severity,
+			Title:            m.Vulnerability.Description,
+		})
+	}
+	return newResult(g.Name(), image, findings), nil
+}
@@ -0,0 +1,53 @@
+package scanner
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+// Save stores a scan result and sets its ID
+func Save(db *sql.DB, r *Result) error {
+	findings, _ := json.Marshal(r.Findings)
+	res, err := db.Exec(
+		"INSERT INTO image_scans (image, image_id, scanner, critical, high, medium, low, unknown, findings, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		r.Image, r.ImageID, r.Scanner,
+		r.Counts[SeverityCritical], r.Counts[SeverityHigh], r.Counts[SeverityMedium], r.Counts[SeverityLow], r.Counts[SeverityUnknown],
+		string(findings), r.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	r.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// ListByImageID returns the most recent scans of an image, newest first
+func ListByImageID(db *sql.DB, imageID string, limit int) ([]Result, error) {
+	rows, err := db.Query(
+		"SELECT id, image, image_id, scanner, critical, high, medium, low, unknown, findings, created_at FROM image_scans WHERE image_id = ? ORDER BY id DESC LIMIT ?",
+		imageID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := []Result{}
+	for rows.Next() {
+		var r Result
+		var critical, high, medium, low, unknown int
+		var findings string
+		if err := rows.Scan(&r.ID, &r.Image, &r.ImageID, &r.Scanner, &critical, &high, &medium, &low, &unknown, &findings, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.Counts = map[string]int{
+			SeverityCritical: critical,
+			SeverityHigh:     high,
+			SeverityMedium:   medium,
+			SeverityLow:      low,
+			SeverityUnknown:  unknown,
+		}
+		_ = json.Unmarshal([]byte(findings), &r.Findings)
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
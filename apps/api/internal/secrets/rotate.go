@@ -0,0 +1,142 @@
+package secrets
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Column is a table column holding values encrypted with Encrypt
+type Column struct {
+	Table  string
+	Column string
+}
+
+// Columns lists every encrypted column; Seal and Rotate walk all of them
+var Columns = []Column{
+	{"applications", "env"},
+	{"applications", "build_args"},
+	{"env_groups", "env"},
+	{"alert_channels", "config"},
+}
+
+// Seal encrypts the values still stored as plaintext, e.g. rows written
+// before encryption was introduced, and returns how many were changed
+func Seal(db *sql.DB) (int, error) {
+	return reencrypt(db, false)
+}
+
+// Rotate re-encrypts every value under the current master key so that
+// previous keys can be retired, and returns how many values were rewritten
+func Rotate(db *sql.DB) (int, error) {
+	return reencrypt(db, true)
+}
+
+func reencrypt(db *sql.DB, all bool) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	changed := 0
+	for _, col := range Columns {
+		n, err := reencryptColumn(tx, col, all)
+		if err != nil {
+			return 0, fmt.Errorf("%s.%s: %w", col.Table, col.Column, err)
+		}
+		changed += n
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return changed, nil
+}
+
+func reencryptColumn(tx *sql.Tx, col Column, all bool) (int, error) {
+	rows, err := tx.Query("SELECT id, " + col.Column + " FROM " + col.Table)
+	if err != nil {
+		return 0, err
+	}
+	type row struct {
+		id    int64
+		value string
+	}
+	var pending []row
+	for rows.Next() {
+		var id int64
+		var value sql.NullString
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if value.String == "" || (IsEncrypted(value.String) && !all) {
+			continue
+		}
+		pending = append(pending, row{id, value.String})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, r := range pending {
+		plaintext, err := Decrypt(r.value)
+		if err != nil {
+			return 0, fmt.Errorf("row %d: %w", r.id, err)
+		}
+		sealed, err := Encrypt(plaintext)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec("UPDATE "+col.Table+" SET "+col.Column+" = ? WHERE id = ?", sealed, r.id); err != nil {
+			return 0, err
+		}
+	}
+	return len(pending), nil
+}
+
+// RotateKeyFile generates a new master key, re-encrypts every value with it
+// and replaces the key file, keeping the old key next to it as a backup that
+// Init still loads. It only applies when the key comes from the key file.
+func RotateKeyFile(db *sql.DB) (int, string, error) {
+	if !UsesKeyFile() {
+		return 0, "", fmt.Errorf("SECRETS_MASTER_KEY is set; rotate by changing it and listing the old key in SECRETS_PREVIOUS_KEYS")
+	}
+	path := KeyFile()
+	oldKey, err := os.ReadFile(path)
+	if err != nil {
+		return 0, "", err
+	}
+	newRaw, err := GenerateKey()
+	if err != nil {
+		return 0, "", err
+	}
+	newKey, _ := parseKey(newRaw)
+	// Write the new key aside first so it is never lost once rows use it
+	tmp := path + ".new"
+	if err := writeKeyFile(tmp, newRaw); err != nil {
+		return 0, "", err
+	}
+
+	mu.Lock()
+	old := current
+	current, previous = newMasterKey(newKey), append([]*masterKey{old}, previous...)
+	mu.Unlock()
+	n, err := Rotate(db)
+	if err != nil {
+		mu.Lock()
+		current, previous = old, previous[1:]
+		mu.Unlock()
+		os.Remove(tmp)
+		return 0, "", err
+	}
+
+	backup := fmt.Sprintf("%s.%s.bak", path, time.Now().UTC().Format("20060102T150405Z"))
+	if err := os.WriteFile(backup, oldKey, 0o600); err != nil {
+		return n, "", fmt.Errorf("rows now use the key in %s but backing up the old key failed: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return n, "", fmt.Errorf("rows now use the key in %s but replacing %s failed: %w", tmp, path, err)
+	}
+	return n, backup, nil
+}
@@ -0,0 +1,277 @@
+// Package secrets encrypts sensitive columns at rest with envelope
+// encryption: every value gets its own random data key, which is itself
+// encrypted with the panel's master key. Rotating the master key only needs
+// the data keys to be re-wrapped.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// prefix marks values produced by Encrypt; anything else is legacy plaintext
+const prefix = "enc:v1:"
+
+// keySize is the size of master and data keys (AES-256)
+const keySize = 32
+
+// ErrUnknownKey is returned when a value was encrypted with a master key
+// that is neither the current one, listed in SECRETS_PREVIOUS_KEYS nor a
+// backup of the key file
+var ErrUnknownKey = errors.New("value was encrypted with an unknown master key")
+
+// masterKey is a key-encryption key and its short identifier
+type masterKey struct {
+	id  string
+	key []byte
+}
+
+var (
+	mu       sync.RWMutex
+	current  *masterKey
+	previous []*masterKey
+)
+
+func newMasterKey(key []byte) *masterKey {
+	sum := sha256.Sum256(key)
+	return &masterKey{id: hex.EncodeToString(sum[:4]), key: key}
+}
+
+// parseKey decodes a 32-byte key given as base64 or hex
+func parseKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil && len(b) == keySize {
+		return b, nil
+	}
+	if b, err := hex.DecodeString(s); err == nil && len(b) == keySize {
+		return b, nil
+	}
+	return nil, errors.New("master key must be 32 bytes encoded as base64 or hex")
+}
+
+// GenerateKey returns a new random master key, base64 encoded
+func GenerateKey() (string, error) {
+	key := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// KeyFile returns the master key file used when SECRETS_MASTER_KEY is not set
+// (SECRETS_MASTER_KEY_FILE, default "master.key")
+func KeyFile() string {
+	if f := os.Getenv("SECRETS_MASTER_KEY_FILE"); f != "" {
+		return f
+	}
+	return "master.key"
+}
+
+// UsesKeyFile reports whether the master key comes from KeyFile
+func UsesKeyFile() bool {
+	return os.Getenv("SECRETS_MASTER_KEY") == ""
+}
+
+// Init loads the master key from SECRETS_MASTER_KEY or the key file, creating
+// the file with a random key on first start, plus any SECRETS_PREVIOUS_KEYS
+// (comma-separated) still needed to decrypt values during a rotation. With
+// a key file, the keys RotateKeyFile backed up next to it stay loaded too.
+func Init() error {
+	var raw string
+	if UsesKeyFile() {
+		data, err := os.ReadFile(KeyFile())
+		if os.IsNotExist(err) {
+			if raw, err = GenerateKey(); err != nil {
+				return err
+			}
+			if err := writeKeyFile(KeyFile(), raw); err != nil {
+				return fmt.Errorf("create master key file: %w", err)
+			}
+		} else if err != nil {
+			return fmt.Errorf("read master key file: %w", err)
+		} else {
+			raw = string(data)
+		}
+	} else {
+		raw = os.Getenv("SECRETS_MASTER_KEY")
+	}
+	key, err := parseKey(raw)
+	if err != nil {
+		return err
+	}
+	var prev []*masterKey
+	for _, s := range strings.Split(os.Getenv("SECRETS_PREVIOUS_KEYS"), ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		k, err := parseKey(s)
+		if err != nil {
+			return fmt.Errorf("SECRETS_PREVIOUS_KEYS: %w", err)
+		}
+		prev = append(prev, newMasterKey(k))
+	}
+	if UsesKeyFile() {
+		// A panel still running during rotate-keys --generate keeps writing
+		// with the old key, which then only survives in the backup
+		backups, err := backupKeys()
+		if err != nil {
+			return err
+		}
+		prev = append(prev, backups...)
+	}
+	mu.Lock()
+	current, previous = newMasterKey(key), prev
+	mu.Unlock()
+	return nil
+}
+
+// backupKeys loads the master.key.<timestamp>.bak files written by
+// RotateKeyFile, newest first
+func backupKeys() ([]*masterKey, error) {
+	paths, err := filepath.Glob(KeyFile() + ".*.bak")
+	if err != nil {
+		return nil, err
+	}
+	var keys []*masterKey
+	for i := len(paths) - 1; i >= 0; i-- {
+		data, err := os.ReadFile(paths[i])
+		if err != nil {
+			return nil, fmt.Errorf("read backup key: %w", err)
+		}
+		k, err := parseKey(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", paths[i], err)
+		}
+		keys = append(keys, newMasterKey(k))
+	}
+	return keys, nil
+}
+
+// writeKeyFile writes a key readable only by the panel user
+func writeKeyFile(path, key string) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, []byte(key+"\n"), 0o600)
+}
+
+// lookup finds the master key with the given id
+func lookup(id string) *masterKey {
+	mu.RLock()
+	defer mu.RUnlock()
+	if current != nil && current.id == id {
+		return current
+	}
+	for _, k := range previous {
+		if k.id == id {
+			return k
+		}
+	}
+	return nil
+}
+
+func seal(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+// Encrypt encrypts plaintext under a fresh data key wrapped with the current
+// master key. The result is "enc:v1:<key id>:<wrapped data key>:<ciphertext>".
+func Encrypt(plaintext string) (string, error) {
+	mu.RLock()
+	kek := current
+	mu.RUnlock()
+	if kek == nil {
+		return "", errors.New("secrets: master key not loaded")
+	}
+	dek := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return "", err
+	}
+	wrapped, err := seal(kek.key, dek)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(dek, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return prefix + kek.id + ":" + base64.StdEncoding.EncodeToString(wrapped) + ":" + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// IsEncrypted reports whether s was produced by Encrypt
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+// Decrypt reverses Encrypt. Values without the encryption prefix are
+// returned unchanged so rows written before encryption keep working.
+func Decrypt(s string) (string, error) {
+	if !IsEncrypted(s) {
+		return s, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(s, prefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("secrets: malformed encrypted value")
+	}
+	kek := lookup(parts[0])
+	if kek == nil {
+		return "", fmt.Errorf("%w (key id %s)", ErrUnknownKey, parts[0])
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.New("secrets: malformed data key")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("secrets: malformed ciphertext")
+	}
+	dek, err := open(kek.key, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("secrets: unwrap data key: %w", err)
+	}
+	plaintext, err := open(dek, ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("secrets: decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,168 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useKeys loads key as the master key and previous as SECRETS_PREVIOUS_KEYS
+func useKeys(t *testing.T, key string, previous ...string) {
+	t.Helper()
+	t.Setenv("SECRETS_MASTER_KEY", key)
+	t.Setenv("SECRETS_PREVIOUS_KEYS", strings.Join(previous, ","))
+	if err := Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+}
+
+func newKey(t *testing.T) string {
+	t.Helper()
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestRoundTrip(t *testing.T) {
+	useKeys(t, newKey(t))
+	for _, plaintext := range []string{"", "s3cret", "multi\nline ünïcode", strings.Repeat("x", 1<<16)} {
+		sealed, err := Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Encrypt: %v", err)
+		}
+		if !IsEncrypted(sealed) {
+			t.Errorf("Encrypt(%.20q) = %.40q, missing the %s prefix", plaintext, sealed, prefix)
+		}
+		got, err := Decrypt(sealed)
+		if err != nil {
+			t.Fatalf("Decrypt: %v", err)
+		}
+		if got != plaintext {
+			t.Errorf("Decrypt(Encrypt(%.20q)) = %.20q", plaintext, got)
+		}
+	}
+}
+
+func TestEncryptUsesFreshKeys(t *testing.T) {
+	useKeys(t, newKey(t))
+	a, _ := Encrypt("same")
+	b, _ := Encrypt("same")
+	if a == b {
+		t.Error("encrypting the same value twice gave the same result")
+	}
+}
+
+func TestDecryptPlaintext(t *testing.T) {
+	useKeys(t, newKey(t))
+	got, err := Decrypt("legacy value")
+	if err != nil || got != "legacy value" {
+		t.Errorf("Decrypt(plaintext) = %q, %v; want it unchanged", got, err)
+	}
+}
+
+func TestTamper(t *testing.T) {
+	useKeys(t, newKey(t))
+	sealed, err := Encrypt("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(strings.TrimPrefix(sealed, prefix), ":")
+	flip := func(field string) string {
+		b, _ := base64.StdEncoding.DecodeString(field)
+		b[len(b)-1] ^= 1
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"ciphertext", prefix + parts[0] + ":" + parts[1] + ":" + flip(parts[2])},
+		{"data key", prefix + parts[0] + ":" + flip(parts[1]) + ":" + parts[2]},
+		{"truncated ciphertext", prefix + parts[0] + ":" + parts[1] + ":" + base64.StdEncoding.EncodeToString([]byte("short"))},
+		{"not base64", prefix + parts[0] + ":" + parts[1] + ":!!!"},
+		{"missing field", prefix + parts[0] + ":" + parts[1]},
+	}
+	for _, tt := range tests {
+		if got, err := Decrypt(tt.value); err == nil {
+			t.Errorf("%s: Decrypt succeeded with %q, want an error", tt.name, got)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, newKeyValue := newKey(t), newKey(t)
+	useKeys(t, oldKey)
+	sealed, err := Encrypt("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	useKeys(t, newKeyValue)
+	if _, err := Decrypt(sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt with another master key: err = %v, want ErrUnknownKey", err)
+	}
+
+	useKeys(t, newKeyValue, oldKey)
+	if got, err := Decrypt(sealed); err != nil || got != "s3cret" {
+		t.Errorf("Decrypt with the old key in SECRETS_PREVIOUS_KEYS = %q, %v", got, err)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		key string
+		ok  bool
+	}{
+		{base64.StdEncoding.EncodeToString(make([]byte, 32)), true},
+		{strings.Repeat("ab", 32), true},
+		{" " + strings.Repeat("ab", 32) + "\n", true},
+		{base64.StdEncoding.EncodeToString(make([]byte, 16)), false},
+		{strings.Repeat("ab", 31), false},
+		{"not a key", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if _, err := parseKey(tt.key); (err == nil) != tt.ok {
+			t.Errorf("parseKey(%q) error = %v, want ok %v", tt.key, err, tt.ok)
+		}
+	}
+}
+
+func TestInitLoadsBackupKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "master.key")
+	oldKey, newKeyValue := newKey(t), newKey(t)
+	t.Setenv("SECRETS_MASTER_KEY_FILE", path)
+	if err := os.WriteFile(path, []byte(oldKey+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	useKeys(t, "")
+	sealed, err := Encrypt("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// What rotate-keys --generate leaves behind
+	if err := os.WriteFile(path+".20240610T103000Z.bak", []byte(oldKey+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(newKeyValue+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	useKeys(t, "")
+	if got, err := Decrypt(sealed); err != nil || got != "s3cret" {
+		t.Errorf("Decrypt with the old key in a backup file = %q, %v", got, err)
+	}
+
+	if err := os.WriteFile(path+".20240611T103000Z.bak", []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SECRETS_MASTER_KEY", "")
+	if err := Init(); err == nil {
+		t.Error("Init accepted an invalid backup key")
+	}
+}
@@ -0,0 +1,270 @@
+package uptime
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/alerts"
+	"github.com/gakwaya-panel/api/internal/dockerutil"
+	"github.com/gakwaya-panel/api/internal/models"
+)
+
+// tick is how often due checks are looked for
+const tick = 5 * time.Second
+
+// maxParallel bounds the probes in flight
+const maxParallel = 16
+
+// maxBody is how much of an HTTP response is searched for BodyContains
+const maxBody = 1 << 20
+
+var (
+	runningMu sync.Mutex
+	running   = map[int64]bool{} // check ID -> probe in progress
+	sem       = make(chan struct{}, maxParallel)
+)
+
+// Start probes the enabled checks on their intervals and prunes old results
+// every hour, in the background
+func Start(db *sql.DB) {
+	go func() {
+		for range time.Tick(tick) {
+			runDue(db)
+		}
+	}()
+	go func() {
+		for range time.Tick(time.Hour) {
+			if n, err := Prune(db); err != nil {
+				log.Printf("[WARN] uptime: prune failed: %v", err)
+			} else if n > 0 {
+				log.Printf("[INFO] uptime: pruned %d old results and outages", n)
+			}
+		}
+	}()
+}
+
+// runDue starts a probe of every enabled check whose interval has passed
+func runDue(db *sql.DB) {
+	rows, err := db.Query(`SELECT c.id, a.container_id FROM uptime_checks c JOIN applications a ON a.id = c.application_id
+		WHERE c.enabled = 1 AND (c.last_checked_at IS NULL OR c.last_checked_at <= ?)`, time.Now().Add(-MinInterval*time.Second))
+	if err != nil {
+		log.Printf("[WARN] uptime: could not load checks: %v", err)
+		return
+	}
+	type due struct {
+		id          int64
+		containerID sql.NullString
+	}
+	var list []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.id, &d.containerID); err == nil {
+			list = append(list, d)
+		}
+	}
+	rows.Close()
+
+	for _, d := range list {
+		c, err := Get(db, d.id)
+		if err != nil {
+			continue
+		}
+		if c.LastCheckedAt != nil && time.Since(*c.LastCheckedAt) < time.Duration(c.IntervalSeconds)*time.Second {
+			continue
+		}
+		runningMu.Lock()
+		if running[c.ID] {
+			runningMu.Unlock()
+			continue
+		}
+		running[c.ID] = true
+		runningMu.Unlock()
+		go func(c models.UptimeCheck, containerID string) {
+			defer func() {
+				runningMu.Lock()
+				delete(running, c.ID)
+				runningMu.Unlock()
+			}()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			record(db, c, Probe(context.Background(), c, containerID))
+		}(c, d.containerID.String)
+	}
+}
+
+// Result is the outcome of one probe
+type Result struct {
+	At         time.Time
+	Up         bool
+	Duration   time.Duration
+	StatusCode int
+	Error      string
+}
+
+// Probe runs a check once; containerID is dialed by TCP checks without a host
+func Probe(ctx context.Context, c models.UptimeCheck, containerID string) Result {
+	Defaults(&c)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(c.TimeoutSeconds)*time.Second)
+	defer cancel()
+	res := Result{At: time.Now()}
+	var err error
+	if c.Type == TypeTCP {
+		err = probeTCP(ctx, c, containerID)
+	} else {
+		res.StatusCode, err = probeHTTP(ctx, c)
+	}
+	res.Duration = time.Since(res.At)
+	if err != nil {
+		res.Error = err.Error()
+		if ctx.Err() == context.DeadlineExceeded {
+			res.Error = fmt.Sprintf("timed out after %ds", c.TimeoutSeconds)
+		}
+	}
+	res.Up = err == nil
+	return res
+}
+
+// httpClient does not reuse connections, so every probe measures a full
+// connect, like a new visitor
+var httpClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		DisableKeepAlives: true,
+		TLSClientConfig:   &tls.Config{},
+	},
+}
+
+func probeHTTP(ctx context.Context, c models.UptimeCheck) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "gakwaya-panel-uptime")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if c.ExpectedStatus != 0 {
+		if resp.StatusCode != c.ExpectedStatus {
+			return resp.StatusCode, fmt.Errorf("status %d, expected %d", resp.StatusCode, c.ExpectedStatus)
+		}
+	} else if resp.StatusCode >= 400 {
+		return resp.StatusCode, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if c.BodyContains != "" && !strings.Contains(string(body), c.BodyContains) {
+		return resp.StatusCode, fmt.Errorf("body does not contain %q", c.BodyContains)
+	}
+	return resp.StatusCode, nil
+}
+
+func probeTCP(ctx context.Context, c models.UptimeCheck, containerID string) error {
+	host, port, err := net.SplitHostPort(c.Address)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		if containerID == "" {
+			return errors.New("application is not deployed")
+		}
+		cli, err := dockerutil.NewClient()
+		if err != nil {
+			return err
+		}
+		defer cli.Close()
+		if host, err = dockerutil.ContainerIP(ctx, cli, containerID); err != nil {
+			return err
+		}
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// record stores a probe result and moves the check up or down. A check goes
+// down after FailureThreshold consecutive failures; its outage starts at
+// the first of them.
+func record(db *sql.DB, c models.UptimeCheck, r Result) {
+	ms := r.Duration.Milliseconds()
+	if _, err := db.Exec("INSERT OR REPLACE INTO uptime_results (check_id, ts, up, response_ms, status_code, error) VALUES (?, ?, ?, ?, ?, ?)",
+		c.ID, r.At.Unix(), r.Up, ms, r.StatusCode, r.Error); err != nil {
+		log.Printf("[WARN] uptime: could not record result of check %d: %v", c.ID, err)
+	}
+
+	var failingSince sql.NullTime
+	_ = db.QueryRow("SELECT failing_since FROM uptime_checks WHERE id = ?", c.ID).Scan(&failingSince)
+	state, since := c.State, c.StateSince
+	failures := 0
+	if r.Up {
+		failingSince = sql.NullTime{}
+		if state != StateUp {
+			state, since = StateUp, &r.At
+		}
+	} else {
+		failures = c.Failures + 1
+		if !failingSince.Valid {
+			failingSince = sql.NullTime{Time: r.At, Valid: true}
+		}
+		if state != StateDown && failures >= c.FailureThreshold {
+			state, since = StateDown, &failingSince.Time
+		}
+	}
+	_, err := db.Exec(`UPDATE uptime_checks SET state = ?, state_since = ?, failures = ?, failing_since = ?, last_checked_at = ?, last_response_ms = ?, last_error = ? WHERE id = ?`,
+		state, since, failures, failingSince, r.At, ms, r.Error, c.ID)
+	if err != nil {
+		log.Printf("[WARN] uptime: could not update check %d: %v", c.ID, err)
+		return
+	}
+	if state == c.State {
+		return
+	}
+
+	subject := fmt.Sprintf("uptime check %d", c.ID)
+	switch state {
+	case StateDown:
+		log.Printf("[INFO] uptime: check %q of application %d is down: %s", c.Name, c.ApplicationID, r.Error)
+		if _, err := db.Exec("INSERT INTO uptime_outages (check_id, started_at, error) VALUES (?, ?, ?)", c.ID, *since, r.Error); err != nil {
+			log.Printf("[WARN] uptime: could not record outage of check %d: %v", c.ID, err)
+		}
+		alerts.Raise(db, alerts.RuleUptimeDown, c.ApplicationID, subject,
+			fmt.Sprintf("Uptime check %q (%s) is down after %d failed probes: %s", c.Name, target(c), failures, r.Error))
+	case StateUp:
+		if c.State == StateUnknown {
+			return
+		}
+		log.Printf("[INFO] uptime: check %q of application %d is up", c.Name, c.ApplicationID)
+		if _, err := db.Exec("UPDATE uptime_outages SET ended_at = ? WHERE check_id = ? AND ended_at IS NULL", r.At, c.ID); err != nil {
+			log.Printf("[WARN] uptime: could not close outage of check %d: %v", c.ID, err)
+		}
+		message := fmt.Sprintf("Uptime check %q (%s) is up again", c.Name, target(c))
+		if c.StateSince != nil {
+			message += fmt.Sprintf(" after %s", r.At.Sub(*c.StateSince).Round(time.Second))
+		}
+		alerts.Resolve(db, alerts.RuleUptimeDown, c.ApplicationID, subject, message+".")
+	}
+}
+
+// target describes what a check probes
+func target(c models.UptimeCheck) string {
+	if c.Type == TypeTCP {
+		return "tcp " + c.Address
+	}
+	return c.URL
+}
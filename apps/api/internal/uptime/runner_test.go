@@ -0,0 +1,94 @@
+package uptime
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/models"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", t.TempDir()+"/panel.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := models.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestRecord(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := db.Exec("INSERT INTO applications (name, image, status, created_at) VALUES ('web', 'nginx', 'running', ?)", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	id, err := Save(db, models.UptimeCheck{ApplicationID: 1, Name: "home", Type: TypeHTTP, URL: "http://web/",
+		IntervalSeconds: 60, TimeoutSeconds: 10, FailureThreshold: 3, Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	steps := []struct {
+		up       bool
+		state    string
+		failures int
+		outages  int
+	}{
+		{true, StateUp, 0, 0},
+		{false, StateUp, 1, 0},
+		{true, StateUp, 0, 0},  // a success resets the count
+		{false, StateUp, 1, 0}, // the outage starts here
+		{false, StateUp, 2, 0},
+		{false, StateDown, 3, 1},
+		{false, StateDown, 4, 1},
+		{true, StateUp, 0, 1},
+	}
+	for i, s := range steps {
+		c, err := Get(db, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := Result{At: base.Add(time.Duration(i) * time.Minute), Up: s.up}
+		if !s.up {
+			r.Error = "connection refused"
+		}
+		record(db, c, r)
+
+		c, err = Get(db, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.State != s.state || c.Failures != s.failures {
+			t.Errorf("step %d: state %s with %d failures, want %s with %d", i, c.State, c.Failures, s.state, s.failures)
+		}
+		outages, err := Outages(db, id, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(outages) != s.outages {
+			t.Errorf("step %d: %d outages, want %d", i, len(outages), s.outages)
+		}
+	}
+
+	c, _ := Get(db, id)
+	if c.StateSince == nil || !c.StateSince.Equal(base.Add(7*time.Minute)) {
+		t.Errorf("up since %v, want %v", c.StateSince, base.Add(7*time.Minute))
+	}
+	outages, _ := Outages(db, id, 10)
+	o := outages[0]
+	if !o.StartedAt.Equal(base.Add(3 * time.Minute)) {
+		t.Errorf("outage started at %v, want the first failure at %v", o.StartedAt, base.Add(3*time.Minute))
+	}
+	if o.EndedAt == nil || !o.EndedAt.Equal(base.Add(7*time.Minute)) {
+		t.Errorf("outage ended at %v, want %v", o.EndedAt, base.Add(7*time.Minute))
+	}
+	if o.Error != "connection refused" {
+		t.Errorf("outage error = %q", o.Error)
+	}
+}
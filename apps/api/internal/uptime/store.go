@@ -0,0 +1,237 @@
+// Package uptime probes application endpoints over HTTP or TCP from the
+// panel, records response times and outages and reports uptime percentages.
+package uptime
+
+import (
+	"database/sql"
+	"os"
+	"time"
+
+	"github.com/gakwaya-panel/api/internal/models"
+)
+
+// Check types
+const (
+	TypeHTTP = "http"
+	TypeTCP  = "tcp"
+)
+
+// Check states
+const (
+	StateUnknown = "unknown"
+	StateUp      = "up"
+	StateDown    = "down"
+)
+
+// MinInterval is the shortest interval between two probes of a check
+const MinInterval = 10
+
+// Windows are the periods uptime percentages are reported for
+var Windows = []struct {
+	Name     string
+	Duration time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+// Retention returns UPTIME_RETENTION, how long probe results and outages
+// are kept, defaulting to 30 days
+func Retention() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("UPTIME_RETENTION")); err == nil && d > 0 {
+		return d
+	}
+	return 30 * 24 * time.Hour
+}
+
+// Defaults fills the unset settings of a check
+func Defaults(c *models.UptimeCheck) {
+	if c.IntervalSeconds == 0 {
+		c.IntervalSeconds = 60
+	}
+	if c.TimeoutSeconds == 0 {
+		c.TimeoutSeconds = 10
+	}
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = 2
+	}
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+const checkColumns = "id, application_id, name, type, url, expected_status, body_contains, address, interval_seconds, timeout_seconds, failure_threshold, enabled, state, state_since, failures, last_checked_at, last_response_ms, last_error, created_at"
+
+func scanCheck(row rowScanner) (models.UptimeCheck, error) {
+	var c models.UptimeCheck
+	var since, checked sql.NullTime
+	err := row.Scan(&c.ID, &c.ApplicationID, &c.Name, &c.Type, &c.URL, &c.ExpectedStatus, &c.BodyContains, &c.Address,
+		&c.IntervalSeconds, &c.TimeoutSeconds, &c.FailureThreshold, &c.Enabled, &c.State, &since, &c.Failures, &checked,
+		&c.LastResponseMS, &c.LastError, &c.CreatedAt)
+	if since.Valid {
+		c.StateSince = &since.Time
+	}
+	if checked.Valid {
+		c.LastCheckedAt = &checked.Time
+	}
+	return c, err
+}
+
+// Get returns one check
+func Get(db *sql.DB, id int64) (models.UptimeCheck, error) {
+	return scanCheck(db.QueryRow("SELECT "+checkColumns+" FROM uptime_checks WHERE id = ?", id))
+}
+
+// List returns the checks of an application, or of every application
+// when appID is 0
+func List(db *sql.DB, appID int64) ([]models.UptimeCheck, error) {
+	query := "SELECT " + checkColumns + " FROM uptime_checks WHERE application_id IN (SELECT id FROM applications)"
+	var args []any
+	if appID != 0 {
+		query += " AND application_id = ?"
+		args = append(args, appID)
+	}
+	rows, err := db.Query(query+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []models.UptimeCheck{}
+	for rows.Next() {
+		c, err := scanCheck(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// Save creates the check, or updates its settings when c.ID is set, and
+// returns its ID. Changing a check keeps its state and history.
+func Save(db *sql.DB, c models.UptimeCheck) (int64, error) {
+	if c.ID != 0 {
+		_, err := db.Exec(`UPDATE uptime_checks SET name = ?, type = ?, url = ?, expected_status = ?, body_contains = ?, address = ?,
+			interval_seconds = ?, timeout_seconds = ?, failure_threshold = ?, enabled = ? WHERE id = ?`,
+			c.Name, c.Type, c.URL, c.ExpectedStatus, c.BodyContains, c.Address, c.IntervalSeconds, c.TimeoutSeconds, c.FailureThreshold, c.Enabled, c.ID)
+		return c.ID, err
+	}
+	res, err := db.Exec(`INSERT INTO uptime_checks (application_id, name, type, url, expected_status, body_contains, address,
+		interval_seconds, timeout_seconds, failure_threshold, enabled, state, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.ApplicationID, c.Name, c.Type, c.URL, c.ExpectedStatus, c.BodyContains, c.Address,
+		c.IntervalSeconds, c.TimeoutSeconds, c.FailureThreshold, c.Enabled, StateUnknown, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// Delete removes a check with its results and outages
+func Delete(db *sql.DB, id int64) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("DELETE FROM uptime_checks WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if _, err := tx.Exec("DELETE FROM uptime_results WHERE check_id = ?", id); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec("DELETE FROM uptime_outages WHERE check_id = ?", id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// Stats returns the uptime of a check over each of the Windows
+func Stats(db *sql.DB, id int64) (map[string]models.UptimeStats, error) {
+	out := map[string]models.UptimeStats{}
+	now := time.Now()
+	for _, w := range Windows {
+		var s models.UptimeStats
+		var up sql.NullInt64
+		var avg sql.NullFloat64
+		err := db.QueryRow("SELECT COUNT(*), SUM(up), AVG(CASE WHEN up = 1 THEN response_ms END) FROM uptime_results WHERE check_id = ? AND ts >= ?",
+			id, now.Add(-w.Duration).Unix()).Scan(&s.Checks, &up, &avg)
+		if err != nil {
+			return nil, err
+		}
+		if s.Checks > 0 {
+			pct := float64(up.Int64) / float64(s.Checks) * 100
+			s.UptimePercent = &pct
+			s.Failures = s.Checks - int(up.Int64)
+		}
+		if avg.Valid {
+			s.AverageResponseMS = &avg.Float64
+		}
+		out[w.Name] = s
+	}
+	return out, nil
+}
+
+// Results returns the probes of a check between from and to, newest first
+func Results(db *sql.DB, id int64, from, to time.Time, limit int) ([]models.UptimeResult, error) {
+	rows, err := db.Query("SELECT ts, up, response_ms, status_code, error FROM uptime_results WHERE check_id = ? AND ts >= ? AND ts <= ? ORDER BY ts DESC LIMIT ?",
+		id, from.Unix(), to.Unix(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []models.UptimeResult{}
+	for rows.Next() {
+		var r models.UptimeResult
+		var ts int64
+		if err := rows.Scan(&ts, &r.Up, &r.ResponseMS, &r.StatusCode, &r.Error); err != nil {
+			return nil, err
+		}
+		r.Time = time.Unix(ts, 0).UTC()
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// Outages returns the outages of a check, newest first
+func Outages(db *sql.DB, id int64, limit int) ([]models.UptimeOutage, error) {
+	rows, err := db.Query("SELECT id, check_id, started_at, ended_at, error FROM uptime_outages WHERE check_id = ? ORDER BY id DESC LIMIT ?", id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []models.UptimeOutage{}
+	for rows.Next() {
+		var o models.UptimeOutage
+		var ended sql.NullTime
+		if err := rows.Scan(&o.ID, &o.CheckID, &o.StartedAt, &ended, &o.Error); err != nil {
+			return nil, err
+		}
+		if ended.Valid {
+			o.EndedAt = &ended.Time
+		}
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
+
+// Prune deletes results and finished outages older than the retention
+func Prune(db *sql.DB) (int64, error) {
+	cutoff := time.Now().Add(-Retention())
+	res, err := db.Exec("DELETE FROM uptime_results WHERE ts < ?", cutoff.Unix())
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	res, err = db.Exec("DELETE FROM uptime_outages WHERE ended_at IS NOT NULL AND ended_at < ?", cutoff)
+	if err != nil {
+		return n, err
+	}
+	m, _ := res.RowsAffected()
+	return n + m, nil
+}
@@ -0,0 +1,103 @@
+package volumes
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-units"
+)
+
+// namePattern matches Docker volume names
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// ValidName reports whether name is usable as a Docker volume name
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// Parse turns a volume spec into a mount. Accepted forms:
+//
+//	/host/path:/container/path[:ro|rw]   bind mount
+//	volume-name:/container/path[:ro|rw]  named volume (created on first use)
+//	tmpfs:/container/path[:size]         tmpfs, size like 64m
+//	/path                                bind mount of the same path (legacy)
+func Parse(spec string) (mount.Mount, error) {
+	parts := strings.Split(strings.TrimSpace(spec), ":")
+	if len(parts) == 1 {
+		if !path.IsAbs(parts[0]) {
+			return mount.Mount{}, fmt.Errorf("volume %q: a single path must be absolute", spec)
+		}
+		return mount.Mount{Type: mount.TypeBind, Source: parts[0], Target: parts[0]}, nil
+	}
+	if len(parts) > 3 {
+		return mount.Mount{}, fmt.Errorf("volume %q: expected source:target[:mode]", spec)
+	}
+	source, target := parts[0], parts[1]
+	if !path.IsAbs(target) {
+		return mount.Mount{}, fmt.Errorf("volume %q: target must be an absolute path", spec)
+	}
+	option := ""
+	if len(parts) == 3 {
+		option = parts[2]
+	}
+
+	if source == "tmpfs" {
+		m := mount.Mount{Type: mount.TypeTmpfs, Target: target}
+		if option != "" {
+			size, err := units.RAMInBytes(option)
+			if err != nil || size <= 0 {
+				return mount.Mount{}, fmt.Errorf("volume %q: invalid tmpfs size %q", spec, option)
+			}
+			m.TmpfsOptions = &mount.TmpfsOptions{SizeBytes: size}
+		}
+		return m, nil
+	}
+
+	readOnly := false
+	switch option {
+	case "", "rw":
+	case "ro":
+		readOnly = true
+	default:
+		return mount.Mount{}, fmt.Errorf("volume %q: mode must be ro or rw", spec)
+	}
+	if path.IsAbs(source) {
+		return mount.Mount{Type: mount.TypeBind, Source: source, Target: target, ReadOnly: readOnly}, nil
+	}
+	if !ValidName(source) {
+		return mount.Mount{}, fmt.Errorf("volume %q: %q is neither an absolute path nor a volume name", spec, source)
+	}
+	return mount.Mount{Type: mount.TypeVolume, Source: source, Target: target, ReadOnly: readOnly}, nil
+}
+
+// Mounts parses every spec, rejecting two mounts on the same target
+func Mounts(specs []string) ([]mount.Mount, error) {
+	var mounts []mount.Mount
+	targets := map[string]bool{}
+	for _, spec := range specs {
+		m, err := Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		if targets[m.Target] {
+			return nil, fmt.Errorf("volume %q: %s is mounted twice", spec, m.Target)
+		}
+		targets[m.Target] = true
+		mounts = append(mounts, m)
+	}
+	return mounts, nil
+}
+
+// NamedVolumes returns the Docker volume names referenced by specs
+func NamedVolumes(specs []string) []string {
+	var names []string
+	for _, spec := range specs {
+		if m, err := Parse(spec); err == nil && m.Type == mount.TypeVolume {
+			names = append(names, m.Source)
+		}
+	}
+	return names
+}
@@ -0,0 +1,72 @@
+package volumes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec string
+		want mount.Mount
+	}{
+		{"/srv/data:/data", mount.Mount{Type: mount.TypeBind, Source: "/srv/data", Target: "/data"}},
+		{"/srv/data:/data:ro", mount.Mount{Type: mount.TypeBind, Source: "/srv/data", Target: "/data", ReadOnly: true}},
+		{"/srv/data:/data:rw", mount.Mount{Type: mount.TypeBind, Source: "/srv/data", Target: "/data"}},
+		{"app-data:/var/lib/app", mount.Mount{Type: mount.TypeVolume, Source: "app-data", Target: "/var/lib/app"}},
+		{"app_data.1:/data:ro", mount.Mount{Type: mount.TypeVolume, Source: "app_data.1", Target: "/data", ReadOnly: true}},
+		{"tmpfs:/tmp", mount.Mount{Type: mount.TypeTmpfs, Target: "/tmp"}},
+		{"tmpfs:/tmp:64m", mount.Mount{Type: mount.TypeTmpfs, Target: "/tmp", TmpfsOptions: &mount.TmpfsOptions{SizeBytes: 64 << 20}}},
+		{" /legacy ", mount.Mount{Type: mount.TypeBind, Source: "/legacy", Target: "/legacy"}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"relative",
+		"data:relative",
+		"/a:/b:ro:extra",
+		"/a:/b:rx",
+		"tmpfs:/tmp:lots",
+		"tmpfs:/tmp:0",
+		"-bad:/data",
+		"bad name:/data",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestMounts(t *testing.T) {
+	if _, err := Mounts([]string{"a:/data", "/srv:/data:ro"}); err == nil {
+		t.Error("Mounts accepted two mounts on /data")
+	}
+	mounts, err := Mounts([]string{"a:/data", "tmpfs:/tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mounts) != 2 {
+		t.Errorf("Mounts returned %d mounts, want 2", len(mounts))
+	}
+}
+
+func TestNamedVolumes(t *testing.T) {
+	got := NamedVolumes([]string{"a:/a", "/srv:/srv", "tmpfs:/tmp", "b:/b:ro", "invalid"})
+	if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("NamedVolumes = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,22 @@
+#!/bin/bash
+
+set -e
+
+log() {
+  echo "[$(date '+%Y-%m-%d %H:%M:%S')] $1"
+}
+
+# sqlite_fts5 compiles SQLite with FTS5, which the stored log search needs;
+# without it searches fall back to scanning every line
+TAGS="sqlite_fts5"
+OUTPUT="${1:-bin/gakwaya-panel-api}"
+
+cd "$(dirname "$0")/.."
+
+command -v go >/dev/null || { log "Error: Go is not installed."; exit 1; }
+command -v gcc >/dev/null || command -v cc >/dev/null || { log "Error: a C compiler is required for SQLite (cgo)."; exit 1; }
+
+log "Building API with tags: $TAGS..."
+CGO_ENABLED=1 go build -tags "$TAGS" -o "$OUTPUT" ./cmd
+
+log "Built $OUTPUT."